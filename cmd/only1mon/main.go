@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +18,7 @@ import (
 	"github.com/playok/only1mon/internal/api"
 	"github.com/playok/only1mon/internal/collector"
 	"github.com/playok/only1mon/internal/config"
+	"github.com/playok/only1mon/internal/exporter"
 	"github.com/playok/only1mon/internal/model"
 	"github.com/playok/only1mon/internal/store"
 )
@@ -166,10 +168,52 @@ func cmdRun(isDaemon bool) {
 		log.Fatalf("failed to open database: %v", err)
 	}
 	defer db.Close()
+	db.SetQueryTimeout(time.Duration(cfg.QueryTimeout) * time.Second)
+	db.SetMaxSeries(cfg.MaxQuerySeries)
+	db.SetMaxPoints(cfg.MaxQueryPoints)
+	db.SetSeriesInfo(func(name string) (string, string) {
+		typ := "gauge"
+		if collector.IsCounter(name) {
+			typ = "counter"
+		}
+		return collector.LookupMetricDesc(name).Unit, typ
+	})
 
 	// Create collector registry and restore state
 	registry := collector.NewRegistry(db)
 	registerAllCollectors(registry)
+	registry.Register(collector.NewLogWatchCollector(db))
+	selfCollector := collector.NewSelfCollector(db)
+	registry.Register(selfCollector)
+	var listeners []string // IDs of the protocol listeners started from config
+	var statsd *collector.StatsDCollector
+	if cfg.StatsD.Listen != "" {
+		statsd = collector.NewStatsDCollector(cfg.StatsD.Listen)
+		if err := statsd.Start(); err != nil {
+			log.Printf("[startup] statsd listener on %s failed: %v", cfg.StatsD.Listen, err)
+			statsd = nil
+		} else {
+			registry.Register(statsd)
+			listeners = append(listeners, statsd.ID())
+			log.Printf("[startup] statsd listening on udp %s", cfg.StatsD.Listen)
+		}
+	}
+	var graphite *collector.GraphiteCollector
+	if cfg.Graphite.Listen != "" {
+		graphite = collector.NewGraphiteCollector(cfg.Graphite.Listen)
+		if err := graphite.Listen(); err != nil {
+			log.Printf("[startup] graphite listener on %s failed: %v", cfg.Graphite.Listen, err)
+			graphite = nil
+		} else {
+			registry.Register(graphite)
+			listeners = append(listeners, graphite.ID())
+			log.Printf("[startup] graphite listening on tcp %s", cfg.Graphite.Listen)
+		}
+	}
+	registry.AllowExec(cfg.AllowExec)
+	if err := registry.RegisterStored(); err != nil {
+		log.Printf("warning: failed to restore runtime collectors: %v", err)
+	}
 	if err := registry.RestoreState(); err != nil {
 		log.Printf("warning: failed to restore collector state: %v", err)
 	}
@@ -182,7 +226,17 @@ func cmdRun(isDaemon bool) {
 		bootstrapDefaults(registry, db)
 	}
 
-	// Seed default alert rules if none exist
+	// Configured listeners collect unless they have been disabled in the UI
+	for _, id := range listeners {
+		if registry.HasState(id) {
+			continue
+		}
+		if err := registry.Enable(id); err != nil {
+			log.Printf("[startup] failed to enable %s: %v", id, err)
+		}
+	}
+
+	// Seed default alert rules that are missing
 	seedDefaultAlertRules(db)
 
 	// Apply DB-persisted settings (override config defaults)
@@ -192,11 +246,12 @@ func cmdRun(isDaemon bool) {
 	log.Println("[startup] discovering available metrics...")
 	registry.DiscoverMetrics(context.Background())
 
-	// Apply top_process_count from DB to process collector
+	// Migrate a legacy top_process_count setting into the process collector config
 	applyTopProcessCount(db, registry)
 
 	// Create scheduler
 	sched := collector.NewScheduler(registry, db, cfg.CollectInterval)
+	selfCollector.SetWriter(sched.Writer())
 
 	// Load alert rules from DB
 	sched.AlertEngine().LoadRules(db)
@@ -204,6 +259,7 @@ func cmdRun(isDaemon bool) {
 	// Create WebSocket hub
 	hub := api.NewHub()
 	go hub.Run()
+	selfCollector.SetWSStats(hub.Stats)
 
 	// Wire scheduler broadcast to hub
 	sched.SetBroadcast(func(samples []model.MetricSample) {
@@ -213,6 +269,30 @@ func cmdRun(isDaemon bool) {
 		hub.BroadcastAlerts(alerts)
 	})
 
+	if graphite != nil {
+		graphite.Start(sched)
+	}
+
+	// Forward samples to a Prometheus remote_write endpoint
+	var remoteWrite *exporter.RemoteWrite
+	if rwc := cfg.RemoteWrite; rwc.URL != "" {
+		host := rwc.Host
+		if host == "" {
+			host, _ = os.Hostname()
+		}
+		remoteWrite = exporter.NewRemoteWrite(db, exporter.RemoteWriteConfig{
+			URL:           rwc.URL,
+			Host:          host,
+			Headers:       rwc.Headers,
+			BatchInterval: time.Duration(rwc.BatchInterval) * time.Second,
+			Timeout:       time.Duration(rwc.Timeout) * time.Second,
+			MaxQueue:      rwc.MaxQueue,
+		})
+		remoteWrite.Start()
+		sched.AddExporter(remoteWrite)
+		log.Printf("[startup] remote_write to %s (host=%s)", rwc.URL, host)
+	}
+
 	// Start scheduler
 	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
 	defer stop()
@@ -245,6 +325,15 @@ func cmdRun(isDaemon bool) {
 	defer cancel()
 
 	sched.Stop()
+	if remoteWrite != nil {
+		remoteWrite.Close()
+	}
+	if statsd != nil {
+		statsd.Close()
+	}
+	if graphite != nil {
+		graphite.Close()
+	}
 	srv.Shutdown(shutCtx)
 
 	// Clean up PID file
@@ -302,30 +391,93 @@ func registerAllCollectors(registry *collector.Registry) {
 	registry.Register(collector.NewProcessCollector())
 	registry.Register(collector.NewKernelCollector())
 	registry.Register(collector.NewGPUCollector())
+	registry.Register(collector.NewPromScrapeCollector())
+	registry.Register(collector.NewProbeCollector())
+	registry.Register(collector.NewContainerCollector())
+	registry.Register(collector.NewCustomCollector())
+	registry.Register(collector.NewInfluxCollector())
 }
 
+// seededAlertRulesKey is the setting listing the default alert rules that have
+// already been offered, so a default the user deleted is not recreated.
+const seededAlertRulesKey = "seeded_alert_rules"
+
+// seedDefaultAlertRules inserts every default alert rule that is missing.
+// Defaults are identified by pattern, operator and threshold, so rules added
+// in a later release reach existing databases too.
 func seedDefaultAlertRules(db *store.Store) {
 	rules, err := db.ListAlertRules()
 	if err != nil {
 		log.Printf("[bootstrap] failed to list alert rules: %v", err)
 		return
 	}
-	if len(rules) > 0 {
+	existing := make(map[string]bool, len(rules))
+	patterns := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		existing[defaultAlertRuleID(r)] = true
+		patterns[r.MetricPattern] = true
+	}
+	seeded := make(map[string]bool)
+	v, err := db.GetSetting(seededAlertRulesKey)
+	if err != nil {
+		log.Printf("[bootstrap] failed to read seeded alert rules: %v", err)
 		return
 	}
-	defaults := collector.DefaultAlertRuleModels()
-	for i := range defaults {
-		if _, err := db.CreateAlertRule(&defaults[i]); err != nil {
-			log.Printf("[bootstrap] failed to seed alert rule: %v", err)
+	if v != "" {
+		for _, id := range strings.Split(v, "\n") {
+			seeded[id] = true
+		}
+	}
+	// Databases seeded before defaults were tracked: a pattern that already
+	// has a rule counts as seeded even if the user edited its threshold.
+	legacy := v == "" && len(rules) > 0
+
+	added := 0
+	var ids []string
+	for _, r := range collector.DefaultAlertRuleModels() {
+		id := defaultAlertRuleID(r)
+		ids = append(ids, id)
+		if seeded[id] || existing[id] || (legacy && patterns[r.MetricPattern]) {
+			continue
+		}
+		if _, err := db.CreateAlertRule(&r); err != nil {
+			log.Printf("[bootstrap] failed to seed alert rule %s: %v", id, err)
+			return
+		}
+		added++
+	}
+	for id := range seeded {
+		if !containsString(ids, id) {
+			ids = append(ids, id) // keep defaults removed in a later release
+		}
+	}
+	sort.Strings(ids)
+	if err := db.SetSetting(seededAlertRulesKey, strings.Join(ids, "\n")); err != nil {
+		log.Printf("[bootstrap] failed to record seeded alert rules: %v", err)
+	}
+	if added > 0 {
+		log.Printf("[bootstrap] seeded %d default alert rules", added)
+	}
+}
+
+// defaultAlertRuleID identifies a default alert rule across releases.
+func defaultAlertRuleID(r model.AlertRule) string {
+	return fmt.Sprintf("%s %s %g", r.MetricPattern, r.Operator, r.Threshold)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
 	}
-	log.Printf("[bootstrap] seeded %d default alert rules", len(defaults))
+	return false
 }
 
 func bootstrapDefaults(registry *collector.Registry, db *store.Store) {
 	log.Println("[bootstrap] first run detected, enabling default collectors")
 
-	defaults := []string{"cpu", "memory", "disk"}
+	defaults := []string{"cpu", "memory", "disk", collector.CustomCollectorID, collector.InfluxCollectorID}
 	for _, id := range defaults {
 		if err := registry.Enable(id); err != nil {
 			log.Printf("[bootstrap] failed to enable %s: %v", id, err)
@@ -379,6 +531,9 @@ func bootstrapDefaults(registry *collector.Registry, db *store.Store) {
 }
 
 func applyTopProcessCount(db *store.Store, registry *collector.Registry) {
+	if registry.HasOptions("process") {
+		return // collector config takes precedence
+	}
 	v, err := db.GetSetting("top_process_count")
 	if err != nil || v == "" {
 		return
@@ -387,7 +542,11 @@ func applyTopProcessCount(db *store.Store, registry *collector.Registry) {
 	if err != nil || n < 1 {
 		return
 	}
-	registry.SetProcessTopN(n)
+	n = collector.ClampTopN(n)
+	if err := registry.MergeConfig("process", map[string]interface{}{"top_n": n}); err != nil {
+		log.Printf("[settings] failed to apply top_process_count: %v", err)
+		return
+	}
 	log.Printf("[settings] top_process_count from DB: %d", n)
 }
 
@@ -4,6 +4,7 @@ go 1.25.6
 
 require (
 	github.com/ebitengine/purego v0.9.1
+	github.com/klauspost/compress v1.20.1
 	github.com/shirou/gopsutil/v4 v4.25.12
 	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.44.3
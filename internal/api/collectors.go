@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -20,7 +21,7 @@ func (a *collectorsAPI) list(w http.ResponseWriter, r *http.Request) {
 func (a *collectorsAPI) enable(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if err := a.registry.Enable(id); err != nil {
-		if err == collector.ErrCollectorNotFound {
+		if errors.Is(err, collector.ErrCollectorNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "collector not found"})
 			return
 		}
@@ -33,7 +34,7 @@ func (a *collectorsAPI) enable(w http.ResponseWriter, r *http.Request) {
 func (a *collectorsAPI) disable(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if err := a.registry.Disable(id); err != nil {
-		if err == collector.ErrCollectorNotFound {
+		if errors.Is(err, collector.ErrCollectorNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "collector not found"})
 			return
 		}
@@ -43,6 +44,129 @@ func (a *collectorsAPI) disable(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "disabled"})
 }
 
+// create handles POST /api/v1/collectors with a body like
+// {"type": "exec", "name": "raid", "interval": 60, "options": {...}}.
+// The collector is enabled right away and kept across restarts.
+func (a *collectorsAPI) create(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Type     string          `json:"type"`
+		Name     string          `json:"name"`
+		Interval int             `json:"interval"`
+		Options  json.RawMessage `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	id, err := a.registry.Create(body.Type, body.Name, body.Interval, body.Options)
+	if err != nil {
+		switch {
+		case errors.Is(err, collector.ErrExecNotAllowed):
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		case errors.Is(err, collector.ErrCollectorExists):
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		case errors.Is(err, collector.ErrUnknownCollectorType), errors.Is(err, collector.ErrInvalidCollectorName),
+			errors.Is(err, collector.ErrInvalidInterval), errors.Is(err, collector.ErrInvalidConfig):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "created", "id": id})
+}
+
+// remove handles DELETE /api/v1/collectors/{id} for collectors created
+// through create.
+func (a *collectorsAPI) remove(w http.ResponseWriter, r *http.Request) {
+	if err := a.registry.Remove(r.PathValue("id")); err != nil {
+		switch {
+		case errors.Is(err, collector.ErrCollectorNotFound):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "collector not found"})
+		case errors.Is(err, collector.ErrNotRemovable):
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// update handles PUT /api/v1/collectors/{id} with a body like {"interval": 10}.
+// An interval of 0 reverts the collector to the global collect_interval.
+func (a *collectorsAPI) update(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var body struct {
+		Interval *int `json:"interval"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if body.Interval != nil {
+		if err := a.registry.SetInterval(id, *body.Interval); err != nil {
+			switch {
+			case errors.Is(err, collector.ErrCollectorNotFound):
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "collector not found"})
+			case errors.Is(err, collector.ErrInvalidInterval):
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			default:
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			}
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// getConfig handles GET /api/v1/collectors/{id}/config and returns the
+// option schema together with the current options.
+func (a *collectorsAPI) getConfig(w http.ResponseWriter, r *http.Request) {
+	schema, cfg, err := a.registry.GetConfig(r.PathValue("id"))
+	if err != nil {
+		writeConfigError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schema": schema,
+		"config": cfg,
+	})
+}
+
+// setConfig handles PUT /api/v1/collectors/{id}/config. The body replaces
+// all options; omitted options revert to their defaults.
+func (a *collectorsAPI) setConfig(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if err := a.registry.SetConfig(id, raw); err != nil {
+		writeConfigError(w, err)
+		return
+	}
+	_, cfg, _ := a.registry.GetConfig(id)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "updated",
+		"config": cfg,
+	})
+}
+
+func writeConfigError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, collector.ErrCollectorNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "collector not found"})
+	case errors.Is(err, collector.ErrNotConfigurable):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, collector.ErrInvalidConfig):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
 // metricState handles PUT /api/v1/metrics/state/{rest...}
 // where rest is "<metric.name>/enable" or "<metric.name>/disable".
 func (a *collectorsAPI) metricState(w http.ResponseWriter, r *http.Request) {
@@ -74,7 +198,7 @@ func (a *collectorsAPI) metricState(w http.ResponseWriter, r *http.Request) {
 func (a *collectorsAPI) enableCollectorMetrics(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if err := a.registry.SetCollectorMetrics(id, true); err != nil {
-		if err == collector.ErrCollectorNotFound {
+		if errors.Is(err, collector.ErrCollectorNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "collector not found"})
 			return
 		}
@@ -87,7 +211,7 @@ func (a *collectorsAPI) enableCollectorMetrics(w http.ResponseWriter, r *http.Re
 func (a *collectorsAPI) disableCollectorMetrics(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if err := a.registry.SetCollectorMetrics(id, false); err != nil {
-		if err == collector.ErrCollectorNotFound {
+		if errors.Is(err, collector.ErrCollectorNotFound) {
 			writeJSON(w, http.StatusNotFound, map[string]string{"error": "collector not found"})
 			return
 		}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Responses are compressed with zstd or gzip, whichever the client accepts
+// (zstd preferred). Only JSON and NDJSON bodies are compressed; static files
+// and WebSocket upgrades pass through untouched.
+
+var gzipPool = sync.Pool{New: func() interface{} {
+	w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+	return w
+}}
+
+var zstdPool = sync.Pool{New: func() interface{} {
+	w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+	return w
+}}
+
+// encoder is the part of gzip.Writer and zstd.Encoder the middleware uses.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// pickEncoding returns the preferred supported encoding in an
+// Accept-Encoding header, or "" for none. q=0 entries are excluded.
+func pickEncoding(header string) string {
+	var gz, zs bool
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "zstd":
+			zs = true
+		case "gzip":
+			gz = true
+		}
+	}
+	switch {
+	case zs:
+		return "zstd"
+	case gz:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter compresses the body once WriteHeader has seen a JSON
+// Content-Type.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	enc         encoder
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+	ct := h.Get("Content-Type")
+	compressible := strings.HasPrefix(ct, "application/json") || strings.HasPrefix(ct, ndjsonType)
+	if compressible && code != http.StatusNoContent && code != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == "zstd" {
+			w.enc = zstdPool.Get().(*zstd.Encoder)
+		} else {
+			w.enc = gzipPool.Get().(*gzip.Writer)
+		}
+		w.enc.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush pushes compressed data written so far to the client, for streamed
+// responses.
+func (w *compressWriter) Flush() {
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the compressed stream and returns the encoder to its pool.
+func (w *compressWriter) close() {
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	w.enc.Reset(io.Discard)
+	if w.encoding == "zstd" {
+		zstdPool.Put(w.enc)
+	} else {
+		gzipPool.Put(w.enc)
+	}
+	w.enc = nil
+}
+
+// withCompression compresses JSON API responses for clients that accept it.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := pickEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || !strings.Contains(r.URL.Path, "/api/") || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
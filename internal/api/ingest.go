@@ -0,0 +1,198 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/playok/only1mon/internal/collector"
+	"github.com/playok/only1mon/internal/model"
+)
+
+const (
+	// maxIngestBody bounds the size of one ingest request.
+	maxIngestBody = 5 << 20
+	// maxIngestSamples bounds the samples in one ingest request.
+	maxIngestSamples = 10000
+)
+
+type ingestAPI struct {
+	scheduler *collector.Scheduler
+}
+
+// ingestSample is one pushed sample. Timestamp is in Unix seconds
+// (milliseconds are recognized and converted); 0 or absent means now.
+type ingestSample struct {
+	Name      string       `json:"name"`
+	Value     *float64     `json:"value"`
+	Timestamp float64      `json:"timestamp"`
+	Labels    ingestLabels `json:"labels"`
+}
+
+// ingestLabels accepts either a plain string or an object of string values,
+// which is stored as sorted k=v pairs: {"queue":"mail","env":"prod"} becomes
+// "env=prod,queue=mail".
+type ingestLabels string
+
+func (l *ingestLabels) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*l = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = ingestLabels(s)
+		return nil
+	}
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return errors.New("labels must be a string or an object of strings")
+	}
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	*l = ingestLabels(strings.Join(pairs, ","))
+	return nil
+}
+
+// ingest accepts a JSON array of samples (or a single sample object) and feeds
+// them through the normal pipeline as metrics of the custom collector. The
+// whole batch is rejected if any sample is invalid.
+func (a *ingestAPI) ingest(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxIngestBody)
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	var batch []ingestSample
+	var err error
+	if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '{' {
+		batch = make([]ingestSample, 1)
+		err = json.Unmarshal(raw, &batch[0])
+	} else {
+		err = json.Unmarshal(raw, &batch)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if len(batch) > maxIngestSamples {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+			"error": fmt.Sprintf("too many samples: %d, limit is %d", len(batch), maxIngestSamples),
+		})
+		return
+	}
+
+	now := time.Now()
+	samples := make([]model.MetricSample, len(batch))
+	for i, in := range batch {
+		ts, err := ingestTimestamp(in, now)
+		if err == nil {
+			err = collector.ValidatePushedName(in.Name)
+		}
+		if err == nil && in.Value == nil {
+			err = errors.New("value is required")
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("sample %d: %v", i, err)})
+			return
+		}
+		samples[i] = model.MetricSample{
+			Timestamp:  ts,
+			MetricName: in.Name,
+			Value:      *in.Value,
+			Labels:     string(in.Labels),
+		}
+	}
+
+	accepted, ok := a.feed(w, collector.CustomCollectorID, samples)
+	if !ok {
+		return
+	}
+	// Samples of metrics disabled on the Collectors page are dropped.
+	writeJSON(w, http.StatusOK, map[string]int{"accepted": accepted, "dropped": len(samples) - accepted})
+}
+
+// write accepts InfluxDB line protocol (optionally gzip-compressed), as sent
+// by Telegraf's influxdb output, and answers 204 like InfluxDB does. The
+// precision query parameter (ns, us, ms, s, m, h; default ns) sets the unit of
+// the timestamps.
+func (a *ingestAPI) write(w http.ResponseWriter, r *http.Request) {
+	precision := r.URL.Query().Get("precision")
+	if !collector.ValidInfluxPrecision(precision) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown precision " + precision})
+		return
+	}
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxIngestBody)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid gzip body: " + err.Error()})
+			return
+		}
+		defer zr.Close()
+		body = io.LimitReader(zr, maxIngestBody+1)
+	}
+	data, err := io.ReadAll(body)
+	if err == nil && len(data) > maxIngestBody {
+		err = errors.New("body too large")
+	}
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	samples, err := collector.ParseInflux(string(data), precision, now)
+	if err == nil && len(samples) > maxIngestSamples {
+		err = fmt.Errorf("too many samples: %d, limit is %d", len(samples), maxIngestSamples)
+	}
+	for i := 0; err == nil && i < len(samples); i++ {
+		if samples[i].Timestamp > now.Add(collector.MaxPushFuture).Unix() {
+			err = fmt.Errorf("%s: timestamp is in the future (check the precision parameter)", samples[i].MetricName)
+		}
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if _, ok := a.feed(w, collector.InfluxCollectorID, samples); ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// feed hands validated samples to the scheduler. On failure it writes the
+// error response and returns false.
+func (a *ingestAPI) feed(w http.ResponseWriter, id string, samples []model.MetricSample) (int, bool) {
+	accepted, err := a.scheduler.Ingest(id, samples)
+	if err != nil {
+		if errors.Is(err, collector.ErrCollectorDisabled) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "the " + id + " collector is disabled; enable it on the Collectors page"})
+			return 0, false
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return 0, false
+	}
+	return accepted, true
+}
+
+func ingestTimestamp(in ingestSample, now time.Time) (int64, error) {
+	ts := int64(in.Timestamp)
+	switch {
+	case ts == 0:
+		return now.Unix(), nil
+	case ts < 0:
+		return 0, errors.New("timestamp must be positive")
+	}
+	return collector.PushTimestamp(ts, now)
+}
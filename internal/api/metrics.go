@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"sort"
 	"strconv"
@@ -8,6 +10,7 @@ import (
 	"time"
 
 	"github.com/playok/only1mon/internal/collector"
+	"github.com/playok/only1mon/internal/mql"
 	"github.com/playok/only1mon/internal/store"
 )
 
@@ -49,22 +52,126 @@ func (a *metricsAPI) query(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Support comma-separated names
-	names := strings.Split(name, ",")
-	if len(names) == 1 {
-		samples, err := a.store.QueryMetrics(names[0], from, to, step)
-		if err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	q := store.Query{
+		Names:  splitNames(name),
+		From:   from,
+		To:     to,
+		Step:   step,
+		Agg:    r.URL.Query().Get("agg"),
+		Fn:     r.URL.Query().Get("fn"),
+		Reduce: r.URL.Query().Get("reduce"),
+	}
+	q.Step = a.store.AutoStep(q.From, q.To, q.Step)
+
+	sw := newSeriesWriter(w, r, q.Step)
+	if err := a.store.StreamSeries(r.Context(), q, sw.write); err != nil {
+		if !sw.started {
+			writeQueryError(w, err)
 			return
 		}
-		writeJSON(w, http.StatusOK, samples)
-	} else {
-		samples, err := a.store.QueryMultiMetrics(names, from, to, step)
-		if err != nil {
-			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		sw.fail(err)
+		return
+	}
+	sw.finish()
+}
+
+// splitNames splits the comma-separated name parameter. Commas inside a
+// /regex/ selector do not separate names.
+func splitNames(s string) []string {
+	var names []string
+	for s != "" {
+		end := strings.IndexByte(s, ',')
+		if s[0] == '/' {
+			// A regex runs to the first "/," or the final "/".
+			if i := strings.Index(s[1:], "/,"); i >= 0 {
+				end = i + 2
+			} else {
+				end = -1
+			}
+		}
+		if end < 0 {
+			end = len(s)
+		}
+		if n := strings.TrimSpace(s[:end]); n != "" {
+			names = append(names, n)
+		}
+		s = s[min(end+1, len(s)):]
+	}
+	return names
+}
+
+// eval evaluates a metric expression, e.g. expr=mem.used / mem.total * 100.
+// The response has the same shape as query.
+func (a *metricsAPI) eval(w http.ResponseWriter, r *http.Request) {
+	exprStr := r.URL.Query().Get("expr")
+	if exprStr == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expr parameter required"})
+		return
+	}
+	expr, err := mql.Parse(exprStr)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "parse error: " + err.Error()})
+		return
+	}
+
+	now := time.Now().Unix()
+	rng := mql.Range{From: now - 3600, To: now}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64); err == nil {
+		rng.From = v
+	}
+	if v, err := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64); err == nil {
+		rng.To = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("step")); err == nil && v > 0 {
+		rng.Step = v
+	}
+
+	series, err := mql.Eval(r.Context(), storeSource{a.store}, expr, rng)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) ||
+			errors.Is(err, store.ErrInvalidQuery) || errors.Is(err, store.ErrTooManySeries) {
+			writeQueryError(w, err)
 			return
 		}
-		writeJSON(w, http.StatusOK, samples)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if series == nil {
+		series = []*mql.Series{}
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+// storeSource adapts the store to mql.Source.
+type storeSource struct {
+	store *store.Store
+}
+
+func (s storeSource) Select(ctx context.Context, pattern, fn string, from, to int64, step int) ([]*mql.Series, error) {
+	series, err := s.store.QuerySeries(ctx, store.Query{Names: []string{pattern}, From: from, To: to, Step: step, Fn: fn})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*mql.Series, len(series))
+	for i, sp := range series {
+		out[i] = &mql.Series{Name: sp.Name, Collector: sp.Collector, Labels: sp.Labels, Timestamps: sp.Timestamps, Values: sp.Values}
+	}
+	return out, nil
+}
+
+// writeQueryError reports a failed store read. Invalid parameters and
+// selectors matching too many series map to 400 and timeouts to 504; a
+// cancelled request means the client has gone, so nothing is written.
+func writeQueryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidQuery), errors.Is(err, store.ErrTooManySeries):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, context.DeadlineExceeded):
+		writeJSON(w, http.StatusGatewayTimeout, map[string]string{"error": "query timed out"})
+	case errors.Is(err, context.Canceled):
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 }
 
@@ -87,9 +194,9 @@ type metricGroup struct {
 // It merges collector-declared patterns with actually-collected metric names.
 func (a *metricsAPI) available(w http.ResponseWriter, r *http.Request) {
 	// 1. Get actually collected distinct metrics from DB
-	metas, err := a.store.GetDistinctMetrics()
+	metas, err := a.store.GetDistinctMetrics(r.Context())
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		writeQueryError(w, err)
 		return
 	}
 
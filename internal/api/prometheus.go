@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/playok/only1mon/internal/collector"
+)
+
+const (
+	promTextType        = "text/plain; version=0.0.4; charset=utf-8"
+	promOpenMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+type promAPI struct {
+	scheduler *collector.Scheduler
+}
+
+// promFamily is one Prometheus metric family and its samples.
+type promFamily struct {
+	name    string
+	help    string
+	counter bool
+	samples []promSample
+}
+
+type promSample struct {
+	labels string // rendered {k="v",...} or ""
+	value  float64
+}
+
+// metrics serves the latest value of every enabled metric in the Prometheus
+// text format, or OpenMetrics when the scraper asks for it.
+func (a *promAPI) metrics(w http.ResponseWriter, r *http.Request) {
+	families := map[string]*promFamily{}
+	seen := map[string]bool{}
+	for _, m := range a.scheduler.Latest() {
+		name, labels := collector.PromName(m.MetricName)
+		labels = collector.PromSampleLabels(labels, m.Labels)
+		rendered := renderLabels(labels)
+		if seen[name+rendered] {
+			continue
+		}
+		seen[name+rendered] = true
+
+		f := families[name]
+		if f == nil {
+			f = &promFamily{
+				name:    name,
+				help:    collector.LookupMetricDesc(m.MetricName).Description,
+				counter: collector.IsCounter(m.MetricName),
+			}
+			families[name] = f
+		}
+		f.samples = append(f.samples, promSample{labels: rendered, value: m.Value})
+	}
+
+	names := make([]string, 0, len(families))
+	for n := range families {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	var buf bytes.Buffer
+	for _, n := range names {
+		f := families[n]
+		sort.Slice(f.samples, func(i, j int) bool { return f.samples[i].labels < f.samples[j].labels })
+		writePromFamily(&buf, f, openMetrics)
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", promOpenMetricsType)
+	} else {
+		w.Header().Set("Content-Type", promTextType)
+	}
+	w.Write(buf.Bytes())
+}
+
+func writePromFamily(buf *bytes.Buffer, f *promFamily, openMetrics bool) {
+	typ := "gauge"
+	sampleName := f.name
+	if f.counter {
+		typ = "counter"
+		// OpenMetrics counter samples carry the _total suffix.
+		if openMetrics {
+			sampleName += "_total"
+		}
+	}
+	if f.help != "" {
+		buf.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	}
+	buf.WriteString("# TYPE " + f.name + " " + typ + "\n")
+	for _, s := range f.samples {
+		buf.WriteString(sampleName + s.labels + " " + formatPromValue(s.value) + "\n")
+	}
+}
+
+func renderLabels(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l[0] + `="` + escapeLabelValue(l[1]) + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
+
+func formatPromValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
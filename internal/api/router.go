@@ -20,9 +20,11 @@ func NewRouter(registry *collector.Registry, db *store.Store, hub *Hub, alertEng
 
 	ca := &collectorsAPI{registry: registry}
 	ma := &metricsAPI{store: db, registry: registry}
-	sa := &settingsAPI{store: db, scheduler: scheduler}
+	sa := &settingsAPI{store: db, scheduler: scheduler, registry: registry}
 	da := &dashboardAPI{store: db}
 	aa := &alertsAPI{alertEngine: alertEngine, store: db}
+	pa := &promAPI{scheduler: scheduler}
+	ia := &ingestAPI{scheduler: scheduler}
 
 	// Prefix for direct access (empty when base_path is "/")
 	bp := ""
@@ -45,6 +47,11 @@ func NewRouter(registry *collector.Registry, db *store.Store, hub *Hub, alertEng
 
 	// Collectors
 	register("GET /api/v1/collectors", ca.list)
+	register("POST /api/v1/collectors", ca.create)
+	register("PUT /api/v1/collectors/{id}", ca.update)
+	register("DELETE /api/v1/collectors/{id}", ca.remove)
+	register("GET /api/v1/collectors/{id}/config", ca.getConfig)
+	register("PUT /api/v1/collectors/{id}/config", ca.setConfig)
 	register("PUT /api/v1/collectors/{id}/enable", ca.enable)
 	register("PUT /api/v1/collectors/{id}/disable", ca.disable)
 	register("PUT /api/v1/collectors/{id}/metrics/enable", ca.enableCollectorMetrics)
@@ -53,6 +60,9 @@ func NewRouter(registry *collector.Registry, db *store.Store, hub *Hub, alertEng
 	// Metrics
 	register("GET /api/v1/metrics/available", ma.available)
 	register("GET /api/v1/metrics/query", ma.query)
+	register("GET /api/v1/metrics/eval", ma.eval)
+	register("POST /api/v1/metrics/ingest", ia.ingest)
+	register("POST /api/v1/write", ia.write)
 	register("PUT /api/v1/metrics/state/{rest...}", ca.metricState)
 	register("PUT /api/v1/metrics/ensure-enabled", ca.ensureMetricsEnabled)
 
@@ -81,6 +91,9 @@ func NewRouter(registry *collector.Registry, db *store.Store, hub *Hub, alertEng
 	// WebSocket
 	register("GET /api/v1/ws", hub.HandleWS)
 
+	// Prometheus exposition
+	register("GET /metrics", pa.metrics)
+
 	// Static files (embedded) — inject base_path into index.html
 	staticHandler := web.StaticHandler(basePath)
 	mux.Handle("/", staticHandler)
@@ -88,7 +101,7 @@ func NewRouter(registry *collector.Registry, db *store.Store, hub *Hub, alertEng
 		mux.Handle(bp+"/", http.StripPrefix(bp, staticHandler))
 	}
 
-	return withMiddleware(mux)
+	return withMiddleware(withCompression(mux))
 }
 
 // statusWriter wraps http.ResponseWriter to capture the status code.
@@ -13,6 +13,7 @@ import (
 type settingsAPI struct {
 	store     *store.Store
 	scheduler *collector.Scheduler
+	registry  *collector.Registry
 }
 
 func (a *settingsAPI) list(w http.ResponseWriter, r *http.Request) {
@@ -26,6 +27,17 @@ func (a *settingsAPI) list(w http.ResponseWriter, r *http.Request) {
 	for _, s := range settings {
 		m[s.Key] = s.Value
 	}
+	// top_process_count mirrors the process collector's top_n option
+	if a.registry != nil {
+		if _, cfg, err := a.registry.GetConfig("process"); err == nil {
+			var opts struct {
+				TopN int `json:"top_n"`
+			}
+			if data, err := json.Marshal(cfg); err == nil && json.Unmarshal(data, &opts) == nil && opts.TopN > 0 {
+				m["top_process_count"] = strconv.Itoa(opts.TopN)
+			}
+		}
+	}
 	writeJSON(w, http.StatusOK, m)
 }
 
@@ -36,6 +48,16 @@ func (a *settingsAPI) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// top_process_count is a shortcut for the process collector's top_n
+	// option; out-of-range values are clamped before anything is saved
+	topN := 0
+	if v, ok := body["top_process_count"]; ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			topN = collector.ClampTopN(n)
+			body["top_process_count"] = strconv.Itoa(topN)
+		}
+	}
+
 	for k, v := range body {
 		if err := a.store.SetSetting(k, v); err != nil {
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -50,10 +72,10 @@ func (a *settingsAPI) update(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Apply top_process_count change to running scheduler
-	if v, ok := body["top_process_count"]; ok && a.scheduler != nil {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			a.scheduler.UpdateTopN(n)
+	if topN > 0 && a.registry != nil {
+		if err := a.registry.MergeConfig("process", map[string]interface{}{"top_n": topN}); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
 		}
 	}
 
@@ -77,6 +99,14 @@ func (a *settingsAPI) dbInfo(w http.ResponseWriter, r *http.Request) {
 		info["wal_size"] = fi.Size()
 	}
 
+	if a.scheduler != nil {
+		info["write_queue"] = a.scheduler.Writer().Stats()
+	}
+
+	if st, err := a.store.StorageStats(r.Context()); err == nil {
+		info["storage"] = st
+	}
+
 	writeJSON(w, http.StatusOK, info)
 }
 
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/playok/only1mon/internal/collector"
+	"github.com/playok/only1mon/internal/store"
+)
+
+const ndjsonType = "application/x-ndjson"
+
+// seriesWriter streams query results as they are read from the database:
+// a JSON array written one element at a time, or one JSON object per line
+// when the client accepts NDJSON. Headers are sent with the first series, so
+// errors before that still get a proper status code.
+type seriesWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	ndjson  bool
+	compact bool
+	step    int
+	started bool
+}
+
+func newSeriesWriter(w http.ResponseWriter, r *http.Request, step int) *seriesWriter {
+	return &seriesWriter{
+		w:       w,
+		rc:      http.NewResponseController(w),
+		ndjson:  strings.Contains(r.Header.Get("Accept"), ndjsonType),
+		compact: r.URL.Query().Get("format") == "compact",
+		step:    step,
+	}
+}
+
+// compactSeries is the format=compact encoding of a series: no collector, a
+// unit, and timestamps delta-encoded (the first is absolute, each following
+// one is the difference from its predecessor).
+type compactSeries struct {
+	Name       string    `json:"name"`
+	Labels     string    `json:"labels,omitempty"`
+	Unit       string    `json:"unit,omitempty"`
+	Timestamps []int64   `json:"timestamps"`
+	Values     []float64 `json:"values"`
+}
+
+func compactOf(sp *store.Series) *compactSeries {
+	deltas := make([]int64, len(sp.Timestamps))
+	var prev int64
+	for i, t := range sp.Timestamps {
+		deltas[i] = t - prev
+		prev = t
+	}
+	return &compactSeries{
+		Name:       sp.Name,
+		Labels:     sp.Labels,
+		Unit:       collector.LookupMetricDesc(sp.Name).Unit,
+		Timestamps: deltas,
+		Values:     sp.Values,
+	}
+}
+
+func (sw *seriesWriter) start() {
+	sw.started = true
+	if sw.ndjson {
+		sw.w.Header().Set("Content-Type", ndjsonType)
+	} else {
+		sw.w.Header().Set("Content-Type", "application/json")
+	}
+	// Effective step after AutoStep; 0 means raw samples.
+	sw.w.Header().Set("X-Query-Step", strconv.Itoa(sw.step))
+	sw.w.WriteHeader(http.StatusOK)
+	if !sw.ndjson {
+		sw.w.Write([]byte("["))
+	}
+}
+
+// write sends one series and flushes it to the client. A write error (the
+// client has gone) is returned so the query stops reading.
+func (sw *seriesWriter) write(sp *store.Series) error {
+	sep := ","
+	if !sw.started {
+		sw.start()
+		sep = ""
+	}
+	var v interface{} = sp
+	if sw.compact {
+		v = compactOf(sp)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if sw.ndjson {
+		b = append(b, '\n')
+	} else {
+		b = append([]byte(sep), b...)
+	}
+	if _, err := sw.w.Write(b); err != nil {
+		return err
+	}
+	sw.rc.Flush()
+	return nil
+}
+
+// finish completes a successful response.
+func (sw *seriesWriter) finish() {
+	if !sw.started {
+		sw.start()
+	}
+	if !sw.ndjson {
+		sw.w.Write([]byte("]\n"))
+	}
+}
+
+// fail ends a response that has already started. NDJSON gets a final error
+// line; a JSON array is left unterminated so clients cannot mistake the
+// partial result for a complete one.
+func (sw *seriesWriter) fail(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	log.Printf("[http] query aborted mid-stream: %v", err)
+	if sw.ndjson {
+		b, _ := json.Marshal(map[string]string{"error": err.Error()})
+		sw.w.Write(append(b, '\n'))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/playok/only1mon/internal/model"
@@ -23,6 +24,7 @@ type Hub struct {
 	clients map[*wsClient]struct{}
 	reg     chan *wsClient
 	unreg   chan *wsClient
+	dropped atomic.Uint64 // messages not delivered because a client's send buffer was full
 }
 
 type wsClient struct {
@@ -59,6 +61,15 @@ func (h *Hub) Run() {
 	}
 }
 
+// Stats returns the number of connected clients and the cumulative number of
+// messages dropped for slow clients.
+func (h *Hub) Stats() (clients int, dropped uint64) {
+	h.mu.RLock()
+	clients = len(h.clients)
+	h.mu.RUnlock()
+	return clients, h.dropped.Load()
+}
+
 // Broadcast sends samples to all connected clients that have matching subscriptions.
 func (h *Hub) Broadcast(samples []model.MetricSample) {
 	h.mu.RLock()
@@ -84,6 +95,7 @@ func (h *Hub) Broadcast(samples []model.MetricSample) {
 			case c.send <- data:
 			default:
 				// client too slow, skip
+				h.dropped.Add(1)
 			}
 		}
 	}
@@ -110,6 +122,7 @@ func (h *Hub) BroadcastAlerts(alerts []model.Alert) {
 		select {
 		case c.send <- data:
 		default:
+			h.dropped.Add(1)
 		}
 	}
 }
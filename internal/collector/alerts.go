@@ -33,17 +33,27 @@ type AlertRule struct {
 	MessageKO     string
 }
 
+// alertStaleIntervals is the number of collection intervals after which an
+// alert on a metric that is no longer reported is resolved.
+const alertStaleIntervals = 3
+
 // AlertEngine evaluates metric samples against rules and generates alerts.
 type AlertEngine struct {
-	mu     sync.RWMutex
-	rules  []AlertRule
-	active map[string]model.Alert // keyed by metric name to deduplicate
+	mu      sync.RWMutex
+	rules   []AlertRule
+	active  map[string]model.Alert // keyed by metric name to deduplicate
+	expires map[string]int64       // metric name → Unix time its alert goes stale
+
+	// staleAfter returns how long an alert raised from a collector's sample
+	// stays active without the metric being reported again; nil never expires.
+	staleAfter func(collectorID string) time.Duration
 }
 
 // NewAlertEngine creates an engine with default performance rules.
 func NewAlertEngine() *AlertEngine {
 	e := &AlertEngine{
-		active: make(map[string]model.Alert),
+		active:  make(map[string]model.Alert),
+		expires: make(map[string]int64),
 	}
 	e.rules = defaultRules()
 	return e
@@ -145,6 +155,9 @@ func DefaultAlertRuleModels() []model.AlertRule {
 		{MetricPattern: "net.total.errout", Operator: "gt", Threshold: 100, Severity: model.SeverityWarning, Enabled: true,
 			MessageEN: "Network transmit errors detected (%.0f), possible network issues",
 			MessageKO: "네트워크 송신 오류가 감지되었습니다 (%.0f). 네트워크 문제가 있을 수 있습니다"},
+		{MetricPattern: "net.conntrack.used_pct", Operator: "gt", Threshold: 80, Severity: model.SeverityWarning, Enabled: true,
+			MessageEN: "Connection tracking table is %.1f%% full, new connections will be dropped when it reaches 100%%",
+			MessageKO: "연결 추적 테이블이 %.1f%% 찼습니다. 100%%에 도달하면 새 연결이 버려집니다"},
 
 		// Kernel
 		{MetricPattern: "kernel.procs_blocked", Operator: "gt", Threshold: 5, Severity: model.SeverityWarning, Enabled: true,
@@ -161,16 +174,32 @@ func DefaultAlertRuleModels() []model.AlertRule {
 		{MetricPattern: "gpu.*.util_pct", Operator: "gt", Threshold: 95, Severity: model.SeverityInfo, Enabled: true,
 			MessageEN: "GPU utilization is %.1f%%, running at near full capacity",
 			MessageKO: "GPU 사용률이 %.1f%%로 거의 최대 용량으로 실행 중입니다"},
+
+		// Probes
+		{MetricPattern: "probe.*.up", Operator: "lt", Threshold: 1, Severity: model.SeverityCritical, Enabled: true,
+			MessageEN: "Probe check is failing (up=%.0f), the service is not answering as expected",
+			MessageKO: "프로브 검사가 실패하고 있습니다 (up=%.0f). 서비스가 예상대로 응답하지 않습니다"},
+		// The last matching rule wins, so the critical rule comes last
+		{MetricPattern: "probe.*.cert_expiry_days", Operator: "lt", Threshold: 21, Severity: model.SeverityWarning, Enabled: true,
+			MessageEN: "TLS certificate expires in %.1f days, plan its renewal",
+			MessageKO: "TLS 인증서가 %.1f일 후 만료됩니다. 갱신을 계획하세요"},
+		{MetricPattern: "probe.*.cert_expiry_days", Operator: "lt", Threshold: 7, Severity: model.SeverityCritical, Enabled: true,
+			MessageEN: "TLS certificate expires in %.1f days, renew it now",
+			MessageKO: "TLS 인증서가 %.1f일 후 만료됩니다. 지금 갱신하세요"},
 	}
 }
 
 // Evaluate checks samples against rules and returns any new/updated alerts.
+// Active alerts for metrics not present in samples are left untouched until
+// they go stale (see ExpireStale).
 func (e *AlertEngine) Evaluate(samples []model.MetricSample) []model.Alert {
 	now := time.Now().Unix()
 	triggered := make(map[string]model.Alert)
+	sources := make(map[string]string)
 
 	e.mu.RLock()
 	rules := e.rules
+	staleAfter := e.staleAfter
 	e.mu.RUnlock()
 
 	for _, s := range samples {
@@ -193,6 +222,7 @@ func (e *AlertEngine) Evaluate(samples []model.MetricSample) []model.Alert {
 					MessageKO: fmt.Sprintf(rule.MessageKO, s.Value),
 				}
 				triggered[s.MetricName] = alert
+				sources[s.MetricName] = s.Collector
 			}
 		}
 	}
@@ -200,10 +230,12 @@ func (e *AlertEngine) Evaluate(samples []model.MetricSample) []model.Alert {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	// Remove alerts that are no longer triggered
-	for key := range e.active {
-		if _, still := triggered[key]; !still {
-			delete(e.active, key)
+	// Remove alerts that are no longer triggered. Collectors run on their own
+	// intervals, so only metrics present in this batch can be resolved.
+	for _, s := range samples {
+		if _, still := triggered[s.MetricName]; !still {
+			delete(e.active, s.MetricName)
+			delete(e.expires, s.MetricName)
 		}
 	}
 
@@ -211,12 +243,32 @@ func (e *AlertEngine) Evaluate(samples []model.MetricSample) []model.Alert {
 	var result []model.Alert
 	for key, alert := range triggered {
 		e.active[key] = alert
+		if staleAfter != nil {
+			e.expires[key] = now + int64(staleAfter(sources[key])/time.Second)
+		}
 		result = append(result, alert)
 	}
 
 	return result
 }
 
+// ExpireStale resolves the alerts whose metric has not been reported since
+// they went stale: the metric disappeared, or its collector was disabled or
+// keeps failing. It reports whether any alert was resolved.
+func (e *AlertEngine) ExpireStale(now int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	expired := false
+	for key, at := range e.expires {
+		if now >= at {
+			delete(e.active, key)
+			delete(e.expires, key)
+			expired = true
+		}
+	}
+	return expired
+}
+
 // ActiveAlerts returns all currently active alerts.
 func (e *AlertEngine) ActiveAlerts() []model.Alert {
 	e.mu.RLock()
@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+)
+
+// Configurable is implemented by collectors that expose user-editable options.
+// Options are exchanged as a JSON object described by ConfigSchema; the
+// registry validates input against the schema before calling ApplyConfig and
+// persists the result in collector_state.config_json.
+type Configurable interface {
+	// ConfigSchema describes the options accepted by ApplyConfig.
+	ConfigSchema() ConfigSchema
+	// Config returns the current options as a JSON-serializable value.
+	Config() interface{}
+	// ApplyConfig replaces the options. Omitted fields revert to their defaults.
+	ApplyConfig(raw json.RawMessage) error
+}
+
+// ConfigSchema is the subset of JSON Schema used to describe collector
+// options: an object of typed properties with no additional properties.
+type ConfigSchema struct {
+	Type       string                    `json:"type"`
+	Properties map[string]ConfigProperty `json:"properties"`
+}
+
+// ConfigProperty describes a single option.
+type ConfigProperty struct {
+	Type        string                    `json:"type"` // "string", "integer", "number", "boolean", "array" or "object"
+	Description string                    `json:"description,omitempty"`
+	Default     interface{}               `json:"default,omitempty"`
+	Minimum     *float64                  `json:"minimum,omitempty"`
+	Maximum     *float64                  `json:"maximum,omitempty"`
+	Enum        []string                  `json:"enum,omitempty"`
+	Items       *ConfigProperty           `json:"items,omitempty"`      // element schema for "array"
+	Properties  map[string]ConfigProperty `json:"properties,omitempty"` // fields of an "object"
+}
+
+// objectSchema builds a ConfigSchema from its properties.
+func objectSchema(props map[string]ConfigProperty) ConfigSchema {
+	return ConfigSchema{Type: "object", Properties: props}
+}
+
+// bound returns a pointer for use as ConfigProperty.Minimum/Maximum.
+func bound(v float64) *float64 { return &v }
+
+// validateConfig checks a JSON options object against a schema.
+func validateConfig(schema ConfigSchema, raw json.RawMessage) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return fmt.Errorf("%w: expected a JSON object", ErrInvalidConfig)
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		prop, ok := schema.Properties[k]
+		if !ok {
+			return fmt.Errorf("%w: unknown option %q", ErrInvalidConfig, k)
+		}
+		if err := validateProperty(k, prop, obj[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateProperty(name string, prop ConfigProperty, raw json.RawMessage) error {
+	if string(bytes.TrimSpace(raw)) == "null" {
+		return nil // null resets the option to its default
+	}
+	switch prop.Type {
+	case "string":
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("%w: %s must be a string", ErrInvalidConfig, name)
+		}
+		if len(prop.Enum) > 0 {
+			for _, e := range prop.Enum {
+				if v == e {
+					return nil
+				}
+			}
+			return fmt.Errorf("%w: %s must be one of %v", ErrInvalidConfig, name, prop.Enum)
+		}
+	case "integer", "number":
+		var v float64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("%w: %s must be a %s", ErrInvalidConfig, name, prop.Type)
+		}
+		if prop.Type == "integer" && v != math.Trunc(v) {
+			return fmt.Errorf("%w: %s must be an integer", ErrInvalidConfig, name)
+		}
+		if prop.Minimum != nil && v < *prop.Minimum {
+			return fmt.Errorf("%w: %s must be >= %v", ErrInvalidConfig, name, *prop.Minimum)
+		}
+		if prop.Maximum != nil && v > *prop.Maximum {
+			return fmt.Errorf("%w: %s must be <= %v", ErrInvalidConfig, name, *prop.Maximum)
+		}
+	case "boolean":
+		var v bool
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("%w: %s must be a boolean", ErrInvalidConfig, name)
+		}
+	case "array":
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return fmt.Errorf("%w: %s must be an array", ErrInvalidConfig, name)
+		}
+		if prop.Items != nil {
+			for i, item := range items {
+				if err := validateProperty(fmt.Sprintf("%s[%d]", name, i), *prop.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+			return fmt.Errorf("%w: %s must be an object", ErrInvalidConfig, name)
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p, ok := prop.Properties[k]
+			if !ok {
+				return fmt.Errorf("%w: unknown option %q", ErrInvalidConfig, name+"."+k)
+			}
+			if err := validateProperty(name+"."+k, p, obj[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeOptions unmarshals raw options into v, which should already hold the
+// defaults. Empty input leaves v unchanged.
+func decodeOptions(raw json.RawMessage, v interface{}) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// matchAny reports whether s matches any of the glob patterns (path.Match syntax).
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validGlobs returns an error if any pattern is malformed.
+func validGlobs(name string, patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%s: bad pattern %q", name, p)
+		}
+	}
+	return nil
+}
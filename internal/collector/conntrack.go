@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// conntrackStats holds netfilter connection tracking table usage and
+// the cumulative error counters summed across all CPUs.
+type conntrackStats struct {
+	count        uint64
+	max          uint64
+	drop         uint64
+	insertFailed uint64
+	earlyDrop    uint64
+	hasStats     bool // per-CPU stat counters were readable
+}
+
+// readConntrack reads sys/net/netfilter/nf_conntrack_{count,max} and
+// net/stat/nf_conntrack under procRoot (normally /proc). Returns ok=false
+// when the nf_conntrack module is not loaded (the sysctl files do not exist).
+func readConntrack(procRoot string) (conntrackStats, bool) {
+	var st conntrackStats
+	count, err := readUintFile(filepath.Join(procRoot, "sys/net/netfilter/nf_conntrack_count"))
+	if err != nil {
+		return st, false
+	}
+	max, err := readUintFile(filepath.Join(procRoot, "sys/net/netfilter/nf_conntrack_max"))
+	if err != nil {
+		return st, false
+	}
+	st.count = count
+	st.max = max
+
+	// net/stat/nf_conntrack has a header row of field names followed by one
+	// row of hex-encoded counters per CPU.
+	f, err := os.Open(filepath.Join(procRoot, "net/stat/nf_conntrack"))
+	if err != nil {
+		return st, true
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return st, true
+	}
+	header := strings.Fields(scanner.Text())
+	col := make(map[string]int, len(header))
+	for i, h := range header {
+		col[h] = i
+	}
+	field := func(fields []string, name string) uint64 {
+		i, ok := col[name]
+		if !ok || i >= len(fields) {
+			return 0
+		}
+		v, _ := strconv.ParseUint(fields[i], 16, 64)
+		return v
+	}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != len(header) {
+			continue
+		}
+		st.drop += field(fields, "drop")
+		st.insertFailed += field(fields, "insert_failed")
+		st.earlyDrop += field(fields, "early_drop")
+		st.hasStats = true
+	}
+	return st, true
+}
+
+// sockstat holds socket counts and buffer memory from /proc/net/sockstat.
+// Memory values are converted from pages to bytes.
+type sockstat struct {
+	socketsUsed uint64
+	tcpInuse    uint64
+	tcpOrphan   uint64
+	tcpTW       uint64
+	tcpAlloc    uint64
+	tcpMem      uint64
+	udpInuse    uint64
+	udpMem      uint64
+}
+
+// readSockstat parses net/sockstat under procRoot. Each line is a protocol
+// name followed by "key value" pairs, e.g. "TCP: inuse 9 orphan 0 tw 0 alloc 12 mem 1".
+func readSockstat(procRoot string) (sockstat, bool) {
+	var st sockstat
+	f, err := os.Open(filepath.Join(procRoot, "net/sockstat"))
+	if err != nil {
+		return st, false
+	}
+	defer f.Close()
+
+	pageSize := uint64(os.Getpagesize())
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		kv := make(map[string]uint64, (len(fields)-1)/2)
+		for i := 1; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err == nil {
+				kv[fields[i]] = v
+			}
+		}
+		switch fields[0] {
+		case "sockets:":
+			st.socketsUsed = kv["used"]
+		case "TCP:":
+			st.tcpInuse = kv["inuse"]
+			st.tcpOrphan = kv["orphan"]
+			st.tcpTW = kv["tw"]
+			st.tcpAlloc = kv["alloc"]
+			st.tcpMem = kv["mem"] * pageSize
+		case "UDP:":
+			st.udpInuse = kv["inuse"]
+			st.udpMem = kv["mem"] * pageSize
+		}
+	}
+	return st, scanner.Err() == nil
+}
+
+// readUintFile reads a single unsigned integer from a file such as a sysctl.
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"os"
+	"testing"
+)
+
+const (
+	conntrackCount = "sys/net/netfilter/nf_conntrack_count"
+	conntrackMax   = "sys/net/netfilter/nf_conntrack_max"
+	conntrackStat  = "net/stat/nf_conntrack"
+)
+
+func TestReadConntrack(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		want   conntrackStats
+		wantOK bool
+	}{
+		{
+			// Two CPUs; the counters are hex
+			name: "table and per-CPU stats",
+			files: map[string]string{
+				conntrackCount: "1532",
+				conntrackMax:   "262144",
+				conntrackStat: "entries  clashres found new invalid ignore delete delete_list insert insert_failed drop early_drop error search_restart\n" +
+					"000005fc  00000000 00000000 00000000 0000002a 00000000 00000000 00000000 00000000 00000003 0000000a 00000001 00000000 00000000\n" +
+					"000005fc  00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000001 000000f0 00000000 00000000 00000000",
+			},
+			want:   conntrackStats{count: 1532, max: 262144, drop: 0x0a + 0xf0, insertFailed: 4, earlyDrop: 1, hasStats: true},
+			wantOK: true,
+		},
+		{
+			// Older kernels have more columns in a different order
+			name: "older stat layout",
+			files: map[string]string{
+				conntrackCount: "10",
+				conntrackMax:   "65536",
+				conntrackStat: "entries  searched found new invalid ignore delete delete_list insert insert_failed drop early_drop icmp_error  expect_new expect_create expect_delete search_restart\n" +
+					"0000000a  00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000002 00000010 00000005 00000000 00000000 00000000 00000000 00000000",
+			},
+			want:   conntrackStats{count: 10, max: 65536, drop: 16, insertFailed: 2, earlyDrop: 5, hasStats: true},
+			wantOK: true,
+		},
+		{
+			name: "rows not matching the header are skipped",
+			files: map[string]string{
+				conntrackCount: "10",
+				conntrackMax:   "65536",
+				conntrackStat:  "entries drop early_drop insert_failed\n0000000a 00000001\n0000000a 00000002 00000003 00000004",
+			},
+			want:   conntrackStats{count: 10, max: 65536, drop: 2, insertFailed: 4, earlyDrop: 3, hasStats: true},
+			wantOK: true,
+		},
+		{
+			name:   "no per-CPU stats",
+			files:  map[string]string{conntrackCount: "0", conntrackMax: "65536"},
+			want:   conntrackStats{max: 65536},
+			wantOK: true,
+		},
+		{
+			name:   "header only",
+			files:  map[string]string{conntrackCount: "0", conntrackMax: "65536", conntrackStat: "entries drop"},
+			want:   conntrackStats{max: 65536},
+			wantOK: true,
+		},
+		{name: "module not loaded", files: map[string]string{}},
+		{name: "max missing", files: map[string]string{conntrackCount: "10"}},
+		{name: "bad count", files: map[string]string{conntrackCount: "many", conntrackMax: "65536"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeSysfs(t, root, tt.files)
+			got, ok := readConntrack(root)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSockstat(t *testing.T) {
+	page := uint64(os.Getpagesize())
+	tests := []struct {
+		name   string
+		file   string
+		want   sockstat
+		wantOK bool
+	}{
+		{
+			name: "kernel format",
+			file: "sockets: used 412\n" +
+				"TCP: inuse 23 orphan 1 tw 17 alloc 30 mem 5\n" +
+				"UDP: inuse 4 mem 2\n" +
+				"UDPLITE: inuse 0\n" +
+				"RAW: inuse 0\n" +
+				"FRAG: inuse 0 memory 0",
+			want: sockstat{
+				socketsUsed: 412, tcpInuse: 23, tcpOrphan: 1, tcpTW: 17, tcpAlloc: 30,
+				tcpMem: 5 * page, udpInuse: 4, udpMem: 2 * page,
+			},
+			wantOK: true,
+		},
+		{
+			name:   "unparsable values and short lines are ignored",
+			file:   "sockets: used x\nTCP: inuse 3 orphan\nUDP:\n",
+			want:   sockstat{tcpInuse: 3},
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeSysfs(t, root, map[string]string{"net/sockstat": tt.file})
+			got, ok := readSockstat(root)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := readSockstat(t.TempDir()); ok {
+		t.Error("ok without a sockstat file")
+	}
+}
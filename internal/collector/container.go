@@ -0,0 +1,346 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+const (
+	// ContainerCollectorID is the collector ID of the Docker container collector.
+	ContainerCollectorID = "container"
+	// defaultDockerSocket is the Docker Engine API socket.
+	defaultDockerSocket = "/var/run/docker.sock"
+	// dockerRequestTimeout bounds one Docker API request.
+	dockerRequestTimeout = 5 * time.Second
+	// dockerParallel bounds the containers queried at the same time.
+	dockerParallel = 8
+)
+
+// containerOptions are the configurable options of the container collector.
+type containerOptions struct {
+	// Socket is the path of the Docker Engine API unix socket.
+	Socket string `json:"socket"`
+	// IgnoreContainers holds container name patterns to skip.
+	IgnoreContainers []string `json:"ignore_containers"`
+}
+
+// containerCollector reads per-container stats from the Docker Engine API
+// (also served by Podman's Docker-compatible socket). Every running
+// container reports under container.<name>: cpu_pct (of one CPU, like
+// docker stats), mem_used, mem_limit, mem_used_pct, net_rx/net_tx and
+// blk_read/blk_write bytes per second, pids, restart_count and, for
+// containers with a healthcheck, healthy (1 healthy, 0 unhealthy).
+type containerCollector struct {
+	mu     sync.Mutex
+	opts   containerOptions
+	client *http.Client
+	names  map[string]bool
+
+	// Only used by Collect
+	rates *counterTracker[string, float64] // keyed by "<container ID>.<counter>"
+}
+
+func NewContainerCollector() Collector {
+	c := &containerCollector{
+		opts:  containerOptions{Socket: defaultDockerSocket},
+		names: make(map[string]bool),
+		rates: newCounterTracker[string, float64](),
+	}
+	c.client = dockerClient(defaultDockerSocket)
+	return c
+}
+
+// dockerClient returns an HTTP client that sends every request to the unix
+// socket at path.
+func dockerClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: dockerRequestTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+			MaxIdleConnsPerHost: dockerParallel,
+		},
+	}
+}
+
+func (c *containerCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"socket":            {Type: "string", Description: "Path of the Docker Engine API socket", Default: defaultDockerSocket},
+		"ignore_containers": {Type: "array", Items: &ConfigProperty{Type: "string"}, Description: "Container name patterns to skip (e.g. \"buildx_*\")"},
+	})
+}
+
+func (c *containerCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *containerCollector) ApplyConfig(raw json.RawMessage) error {
+	opts := containerOptions{Socket: defaultDockerSocket}
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	if opts.Socket == "" {
+		opts.Socket = defaultDockerSocket
+	}
+	if err := validGlobs("ignore_containers", opts.IgnoreContainers); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if opts.Socket != c.opts.Socket {
+		c.client.CloseIdleConnections()
+		c.client = dockerClient(opts.Socket)
+	}
+	c.opts = opts
+	return nil
+}
+
+func (c *containerCollector) ID() string   { return ContainerCollectorID }
+func (c *containerCollector) Name() string { return "Containers" }
+func (c *containerCollector) Description() string {
+	return "Per-container CPU, memory, network, block I/O, restarts and health from the Docker socket"
+}
+func (c *containerCollector) Impact() model.ImpactLevel { return model.ImpactLow }
+func (c *containerCollector) Warning() string {
+	return "Needs read access to the Docker socket, which grants root-equivalent access to the host"
+}
+
+func (c *containerCollector) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.names) == 0 {
+		return []string{"container.*.cpu_pct", "container.*.mem_used", "container.*.net_rx_bytes_sec", "container.*.restart_count"}
+	}
+	names := make([]string, 0, len(c.names))
+	for n := range c.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dockerContainer is an entry of GET /containers/json.
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+}
+
+// dockerInspect holds the fields used from GET /containers/{id}/json.
+type dockerInspect struct {
+	RestartCount int `json:"RestartCount"`
+	State        struct {
+		Health *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+// dockerStats holds the fields used from GET /containers/{id}/stats.
+type dockerStats struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage  float64   `json:"total_usage"`
+			PercpuUsage []float64 `json:"percpu_usage"`
+		} `json:"cpu_usage"`
+		SystemCPUUsage float64 `json:"system_cpu_usage"`
+		OnlineCPUs     float64 `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage float64            `json:"usage"`
+		Limit float64            `json:"limit"`
+		Stats map[string]float64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes float64 `json:"rx_bytes"`
+		TxBytes float64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string  `json:"op"`
+			Value float64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current float64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+func (c *containerCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	return c.collect(ctx, time.Now().Unix())
+}
+
+// collect queries the running containers and converts their stats to
+// samples at timestamp ts.
+func (c *containerCollector) collect(ctx context.Context, ts int64) ([]model.MetricSample, error) {
+	c.mu.Lock()
+	client := c.client
+	ignore := c.opts.IgnoreContainers
+	c.mu.Unlock()
+
+	var list []dockerContainer
+	if err := dockerGet(ctx, client, "/containers/json", &list); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		id, name string
+		stats    dockerStats
+		inspect  dockerInspect
+		ok       bool
+	}
+	var results []*result
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dockerParallel)
+	for _, ct := range list {
+		name := containerName(ct)
+		if name == "" || matchAny(ignore, name) {
+			continue
+		}
+		r := &result{id: ct.ID, name: name}
+		results = append(results, r)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// A container that stopped since the listing is skipped
+			r.ok = dockerGet(ctx, client, "/containers/"+r.id+"/stats?stream=false&one-shot=true", &r.stats) == nil &&
+				dockerGet(ctx, client, "/containers/"+r.id+"/json", &r.inspect) == nil
+		}()
+	}
+	wg.Wait()
+
+	// Counters of containers that are gone are forgotten on commit
+	c.rates.begin(ts)
+	var samples []model.MetricSample
+	for _, r := range results {
+		if r.ok {
+			samples = append(samples, containerSamples(ts, "container."+r.name, r.id, &r.stats, &r.inspect, c.rates)...)
+		}
+	}
+	c.rates.commit()
+
+	c.mu.Lock()
+	for _, s := range samples {
+		c.names[s.MetricName] = true
+	}
+	c.mu.Unlock()
+	return samples, nil
+}
+
+// containerSamples converts the stats of one container. Rates are derived
+// from the counters recorded in rates under the container's ID, so they are
+// skipped on the first collection and after the container restarted.
+func containerSamples(ts int64, base, id string, st *dockerStats, in *dockerInspect, rates *counterTracker[string, float64]) []model.MetricSample {
+	var netRx, netTx, blkRead, blkWrite float64
+	for _, n := range st.Networks {
+		netRx += n.RxBytes
+		netTx += n.TxBytes
+	}
+	for _, e := range st.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			blkRead += e.Value
+		case "write":
+			blkWrite += e.Value
+		}
+	}
+
+	// Page cache that can be reclaimed is not counted, as docker stats does
+	// (cgroup v2 reports inactive_file, v1 total_inactive_file)
+	memUsed := st.MemoryStats.Usage
+	if v, ok := st.MemoryStats.Stats["inactive_file"]; ok && v < memUsed {
+		memUsed -= v
+	} else if v, ok := st.MemoryStats.Stats["total_inactive_file"]; ok && v < memUsed {
+		memUsed -= v
+	}
+
+	samples := []model.MetricSample{
+		makeSample(ts, ContainerCollectorID, base+".mem_used", memUsed),
+		makeSample(ts, ContainerCollectorID, base+".pids", st.PidsStats.Current),
+		makeSample(ts, ContainerCollectorID, base+".restart_count", float64(in.RestartCount)),
+	}
+	if st.MemoryStats.Limit > 0 {
+		samples = append(samples,
+			makeSample(ts, ContainerCollectorID, base+".mem_limit", st.MemoryStats.Limit),
+			makeSample(ts, ContainerCollectorID, base+".mem_used_pct", memUsed/st.MemoryStats.Limit*100))
+	}
+	if h := in.State.Health; h != nil {
+		switch h.Status {
+		case "healthy":
+			samples = append(samples, makeSample(ts, ContainerCollectorID, base+".healthy", 1))
+		case "unhealthy":
+			samples = append(samples, makeSample(ts, ContainerCollectorID, base+".healthy", 0))
+		}
+	}
+
+	// As in docker stats, 100% is one fully used CPU
+	cpuDelta, cpuOK := rates.delta(id+".cpu", st.CPUStats.CPUUsage.TotalUsage)
+	sysDelta, sysOK := rates.delta(id+".system_cpu", st.CPUStats.SystemCPUUsage)
+	if cpuOK && sysOK && sysDelta > 0 {
+		cpus := st.CPUStats.OnlineCPUs
+		if cpus == 0 {
+			cpus = float64(len(st.CPUStats.CPUUsage.PercpuUsage))
+		}
+		samples = append(samples, makeSample(ts, ContainerCollectorID, base+".cpu_pct", cpuDelta/sysDelta*cpus*100))
+	}
+	for _, r := range []struct {
+		name  string
+		value float64
+	}{
+		{"net_rx_bytes_sec", netRx},
+		{"net_tx_bytes_sec", netTx},
+		{"blk_read_bytes_sec", blkRead},
+		{"blk_write_bytes_sec", blkWrite},
+	} {
+		if v, ok := rates.rate(id+"."+r.name, r.value); ok {
+			samples = append(samples, makeSample(ts, ContainerCollectorID, base+"."+r.name, v))
+		}
+	}
+	return samples
+}
+
+// containerName returns the sanitized primary name of a container.
+func containerName(ct dockerContainer) string {
+	for _, n := range ct.Names {
+		n = strings.TrimPrefix(n, "/")
+		// Names of linked containers contain further slashes
+		if n != "" && !strings.Contains(n, "/") {
+			return sanitizeMetricName(strings.ReplaceAll(n, ".", "_"))
+		}
+	}
+	if len(ct.ID) >= 12 {
+		return ct.ID[:12]
+	}
+	return ""
+}
+
+// dockerGet sends a GET request to the Docker API and decodes the JSON answer.
+func dockerGet(ctx context.Context, client *http.Client, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("docker API %s: HTTP %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
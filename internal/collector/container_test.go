@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDocker serves the Docker Engine API endpoints used by the container
+// collector on a unix socket.
+type fakeDocker struct {
+	mu      sync.Mutex
+	list    string            // body of /containers/json
+	stats   map[string]string // container ID → body of /containers/{id}/stats
+	inspect map[string]string // container ID → body of /containers/{id}/json
+}
+
+func (d *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r.URL.Path == "/containers/json" {
+		fmt.Fprint(w, d.list)
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/containers/")
+	id, endpoint, _ := strings.Cut(rest, "/")
+	var body string
+	switch {
+	case ok && endpoint == "stats" && r.URL.Query().Get("stream") == "false":
+		body, ok = d.stats[id]
+	case ok && endpoint == "json":
+		body, ok = d.inspect[id]
+	default:
+		ok = false
+	}
+	if !ok {
+		http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+		return
+	}
+	fmt.Fprint(w, body)
+}
+
+// serveFakeDocker starts d on a unix socket and returns its path.
+func serveFakeDocker(t *testing.T, d *fakeDocker) string {
+	t.Helper()
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir
+	// can exceed
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "docker.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(d)
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return sock
+}
+
+// dockerStatsJSON renders a stats answer. inactive is reported as cgroup v2
+// inactive_file, or as v1 total_inactive_file when v1 is set.
+func dockerStatsJSON(cpu, systemCPU, memUsage, inactive, memLimit, rx, tx, read, write float64, v1 bool) string {
+	key := "inactive_file"
+	if v1 {
+		key = "total_inactive_file"
+	}
+	return fmt.Sprintf(`{
+		"cpu_stats": {"cpu_usage": {"total_usage": %g, "percpu_usage": [1, 2]}, "system_cpu_usage": %g},
+		"memory_stats": {"usage": %g, "limit": %g, "stats": {%q: %g}},
+		"networks": {"eth0": {"rx_bytes": %g, "tx_bytes": %g}, "eth1": {"rx_bytes": 0, "tx_bytes": 0}},
+		"blkio_stats": {"io_service_bytes_recursive": [{"op": "Read", "value": %g}, {"op": "Write", "value": %g}, {"op": "Total", "value": 1e12}]},
+		"pids_stats": {"current": 5}
+	}`, cpu, systemCPU, memUsage, memLimit, key, inactive, rx, tx, read, write)
+}
+
+func dockerInspectJSON(restarts int, health string) string {
+	if health == "" {
+		return fmt.Sprintf(`{"RestartCount": %d, "State": {"Status": "running"}}`, restarts)
+	}
+	return fmt.Sprintf(`{"RestartCount": %d, "State": {"Status": "running", "Health": {"Status": %q}}}`, restarts, health)
+}
+
+func TestContainerCollect(t *testing.T) {
+	const webID, dbID, skipID = "aaaaaaaaaaaa1111", "bbbbbbbbbbbb2222", "cccccccccccc3333"
+	d := &fakeDocker{
+		list: fmt.Sprintf(`[
+			{"Id": %q, "Names": ["/web"]},
+			{"Id": %q, "Names": ["/db", "/web/db"]},
+			{"Id": %q, "Names": ["/buildx_builder0"]},
+			{"Id": "dddddddddddd4444", "Names": ["/gone"]}
+		]`, webID, dbID, skipID),
+		stats: map[string]string{
+			dbID:   dockerStatsJSON(5e9, 1000e9, 300, 50, 0, 0, 0, 0, 0, true),
+			skipID: dockerStatsJSON(0, 0, 0, 0, 0, 0, 0, 0, 0, false),
+		},
+		inspect: map[string]string{
+			dbID:   dockerInspectJSON(0, ""),
+			skipID: dockerInspectJSON(0, ""),
+		},
+	}
+	c := NewContainerCollector().(*containerCollector)
+	raw, _ := json.Marshal(containerOptions{Socket: serveFakeDocker(t, d), IgnoreContainers: []string{"buildx_*"}})
+	if err := c.ApplyConfig(raw); err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+
+	const mb = 1 << 20
+	rates := []string{"cpu_pct", "net_rx_bytes_sec", "net_tx_bytes_sec", "blk_read_bytes_sec", "blk_write_bytes_sec"}
+	tests := []struct {
+		name    string
+		ts      int64
+		stats   string
+		inspect string
+		want    map[string]float64 // samples of container.web
+		absent  []string
+	}{
+		{
+			name:    "first collection has no rates",
+			ts:      1000,
+			stats:   dockerStatsJSON(1e9, 100e9, 500*mb, 100*mb, 1000*mb, 1000, 2000, 0, 100, false),
+			inspect: dockerInspectJSON(2, "healthy"),
+			want: map[string]float64{
+				"mem_used": 400 * mb, "mem_limit": 1000 * mb, "mem_used_pct": 40,
+				"pids": 5, "restart_count": 2, "healthy": 1,
+			},
+			absent: rates,
+		},
+		{
+			name:    "rates",
+			ts:      1010,
+			stats:   dockerStatsJSON(3e9, 110e9, 500*mb, 100*mb, 1000*mb, 11000, 2000, 5000, 1100, false),
+			inspect: dockerInspectJSON(3, "unhealthy"),
+			want: map[string]float64{
+				"cpu_pct":          40, // 2s of CPU in 10s of system time, over 2 CPUs
+				"net_rx_bytes_sec": 1000, "net_tx_bytes_sec": 0,
+				"blk_read_bytes_sec": 500, "blk_write_bytes_sec": 100,
+				"restart_count": 3, "healthy": 0,
+			},
+		},
+		{
+			name:    "counter reset after a restart",
+			ts:      1020,
+			stats:   dockerStatsJSON(0.1e9, 120e9, 200*mb, 300*mb, 1000*mb, 10, 20, 0, 0, false),
+			inspect: dockerInspectJSON(4, "starting"),
+			want: map[string]float64{
+				// inactive_file larger than the usage is not subtracted
+				"mem_used": 200 * mb, "mem_used_pct": 20, "restart_count": 4,
+			},
+			absent: append([]string{"healthy"}, rates...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d.mu.Lock()
+			d.stats[webID], d.inspect[webID] = tt.stats, tt.inspect
+			d.mu.Unlock()
+
+			samples, err := c.collect(context.Background(), tt.ts)
+			if err != nil {
+				t.Fatalf("collect: %v", err)
+			}
+			got := sampleValues(samples)
+			for name, want := range tt.want {
+				if v, ok := got["container.web."+name]; !ok || math.Abs(v-want) > 1e-6 {
+					t.Errorf("%s = %v (present %v), want %v", name, v, ok, want)
+				}
+			}
+			for _, name := range tt.absent {
+				if v, ok := got["container.web."+name]; ok {
+					t.Errorf("%s = %v, want no sample", name, v)
+				}
+			}
+
+			// The db container uses cgroup v1 stats and has no limit or
+			// healthcheck; ignored and vanished containers are skipped.
+			if v := got["container.db.mem_used"]; v != 250 {
+				t.Errorf("db mem_used = %v, want 250", v)
+			}
+			for name := range got {
+				if strings.HasPrefix(name, "container.db.") {
+					if n := strings.TrimPrefix(name, "container.db."); n == "mem_limit" || n == "healthy" {
+						t.Errorf("unexpected %s", name)
+					}
+				} else if !strings.HasPrefix(name, "container.web.") {
+					t.Errorf("unexpected %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestContainerCollectSocketError(t *testing.T) {
+	c := NewContainerCollector().(*containerCollector)
+	raw, _ := json.Marshal(containerOptions{Socket: filepath.Join(t.TempDir(), "missing.sock")})
+	if err := c.ApplyConfig(raw); err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	if _, err := c.collect(context.Background(), 1000); err == nil {
+		t.Error("collect succeeded without a socket")
+	}
+}
@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// CustomCollectorID is the collector ID attached to metrics pushed by
+// applications through the ingest API.
+const CustomCollectorID = "custom"
+
+// maxMetricNameLen bounds the length of a pushed metric name.
+const maxMetricNameLen = 200
+
+// MaxPushFuture is how far ahead of the server clock a pushed timestamp may
+// be.
+const MaxPushFuture = 10 * time.Minute
+
+// reservedPrefixes are the namespaces of the built-in collectors. Pushed
+// metrics may not use them, so applications cannot overwrite system metrics.
+var reservedPrefixes = []string{
+	"cpu.", "mem.", "disk.", "net.", "proc.", "kernel.", "gpu.", "ebpf.", "only1mon.",
+	"statsd.", "influx.", "graphite.", "prom.", "exec.", "probe.", "log.", "container.",
+}
+
+// metricNameRe matches dot-separated segments of letters, digits, '_', ':'
+// and '-'. Glob and regex characters are excluded so a pushed name can always
+// be queried as an exact name.
+var metricNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_:-]*(\.[A-Za-z0-9_:-]+)*$`)
+
+// ValidatePushedName checks that a metric name pushed from outside is well
+// formed and not in a reserved namespace.
+func ValidatePushedName(name string) error {
+	if name == "" {
+		return fmt.Errorf("metric name is required")
+	}
+	if len(name) > maxMetricNameLen {
+		return fmt.Errorf("metric name longer than %d characters", maxMetricNameLen)
+	}
+	if !metricNameRe.MatchString(name) {
+		return fmt.Errorf("invalid metric name %q: use dot-separated segments of letters, digits, '_', ':' and '-'", name)
+	}
+	for _, p := range reservedPrefixes {
+		if strings.HasPrefix(name, p) {
+			return fmt.Errorf("metric name %q uses the reserved prefix %q", name, p)
+		}
+	}
+	return nil
+}
+
+// PushTimestamp validates a positive Unix timestamp pushed from outside,
+// converting one in milliseconds to seconds, and rejects one more than
+// MaxPushFuture ahead of now.
+func PushTimestamp(ts int64, now time.Time) (int64, error) {
+	if ts > 1e11 {
+		ts /= 1000 // milliseconds
+	}
+	if ts > now.Add(MaxPushFuture).Unix() {
+		return 0, errors.New("timestamp is in the future")
+	}
+	return ts, nil
+}
+
+// PushCollector is a collector fed from outside rather than polled. The
+// scheduler does not run it; its samples enter the pipeline through
+// Scheduler.Ingest.
+type PushCollector interface {
+	Collector
+	// Observe is called with every batch accepted for the collector.
+	Observe(samples []model.MetricSample)
+}
+
+// pushedCollector is a PushCollector whose metrics are the names pushed to it
+// since startup. It backs the ingest API and the line-protocol listeners.
+type pushedCollector struct {
+	id, name, desc string
+
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func newPushedCollector(id, name, desc string) *pushedCollector {
+	return &pushedCollector{id: id, name: name, desc: desc, names: make(map[string]bool)}
+}
+
+// NewCustomCollector returns the virtual collector that owns application
+// metrics pushed through POST /api/v1/metrics/ingest.
+func NewCustomCollector() PushCollector {
+	return newPushedCollector(CustomCollectorID, "Custom",
+		"Application metrics pushed through the ingest API (POST /api/v1/metrics/ingest)")
+}
+
+func (c *pushedCollector) ID() string                { return c.id }
+func (c *pushedCollector) Name() string              { return c.name }
+func (c *pushedCollector) Description() string       { return c.desc }
+func (c *pushedCollector) Impact() model.ImpactLevel { return model.ImpactNone }
+func (c *pushedCollector) Warning() string           { return "" }
+
+func (c *pushedCollector) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.names))
+	for n := range c.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Collect returns nothing: samples are pushed, not gathered.
+func (c *pushedCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	return nil, nil
+}
+
+func (c *pushedCollector) Observe(samples []model.MetricSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range samples {
+		c.names[s.MetricName] = true
+	}
+}
+
+// sanitizeMetricName maps a name from an external protocol onto the
+// characters allowed in metric names and drops empty segments.
+func sanitizeMetricName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '_', r == '-', r == ':', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(name))
+	parts := strings.Split(name, ".")
+	kept := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, ".")
+}
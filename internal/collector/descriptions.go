@@ -318,6 +318,53 @@ var metricDescriptions = map[string]MetricDesc{
 		"bytes",
 	},
 
+	"net.conntrack.count": {
+		"Number of entries currently in the netfilter connection tracking table (Linux only, requires the nf_conntrack module). Every connection passing through iptables/nftables with stateful rules, NAT, or Docker networking occupies one entry until it times out. Compare against net.conntrack.max — when the table is full, the kernel silently drops new connections.",
+		"현재 netfilter 연결 추적 테이블의 항목 수 (Linux 전용, nf_conntrack 모듈 필요). 상태 기반 iptables/nftables 규칙, NAT, Docker 네트워킹을 거치는 모든 연결은 타임아웃될 때까지 항목 하나를 차지합니다. net.conntrack.max와 비교하세요 — 테이블이 가득 차면 커널이 새 연결을 조용히 버립니다.",
+		"count",
+	},
+	"net.conntrack.max": {
+		"Maximum size of the connection tracking table (net.netfilter.nf_conntrack_max sysctl). On busy NAT gateways and load balancers the default is often too small. Raise it with sysctl if net.conntrack.used_pct regularly approaches 100%.",
+		"연결 추적 테이블의 최대 크기 (net.netfilter.nf_conntrack_max sysctl). 트래픽이 많은 NAT 게이트웨이나 로드밸런서에서는 기본값이 너무 작은 경우가 많습니다. net.conntrack.used_pct가 자주 100%에 근접하면 sysctl로 값을 늘리세요.",
+		"count",
+	},
+	"net.conntrack.used_pct": {
+		"Connection tracking table utilization (count / max × 100). This is the key metric for NAT gateways and container hosts. When it reaches 100%, new connections are dropped with only a 'nf_conntrack: table full, dropping packet' kernel log message. Act well before that: raise nf_conntrack_max, shorten conntrack timeouts, or exclude high-volume traffic with NOTRACK rules.",
+		"연결 추적 테이블 사용률 (count / max × 100). NAT 게이트웨이와 컨테이너 호스트의 핵심 지표입니다. 100%에 도달하면 'nf_conntrack: table full, dropping packet' 커널 로그만 남기고 새 연결이 버려집니다. 그 전에 nf_conntrack_max 증가, conntrack 타임아웃 단축, NOTRACK 규칙으로 대량 트래픽 제외 등의 조치를 하세요.",
+		"%",
+	},
+	"net.conntrack.drop": {
+		"Cumulative number of packets dropped because a conntrack entry could not be created, summed across all CPUs (from /proc/net/stat/nf_conntrack). Any increase means connections are being lost — usually because the table is full.",
+		"conntrack 항목을 생성하지 못해 버려진 패킷의 누적 수, 모든 CPU 합계 (/proc/net/stat/nf_conntrack에서 수집). 값이 증가하면 연결이 유실되고 있다는 뜻이며, 대개 테이블이 가득 찼기 때문입니다.",
+		"count",
+	},
+	"net.conntrack.insert_failed": {
+		"Cumulative number of conntrack entries that could not be inserted into the table, summed across all CPUs. Increases under table pressure or due to races between simultaneous packets of the same new connection (common with UDP DNS traffic through NAT).",
+		"테이블에 삽입하지 못한 conntrack 항목의 누적 수, 모든 CPU 합계. 테이블 압박이 있거나 같은 새 연결의 패킷이 동시에 도착하는 경쟁 상황(NAT를 통한 UDP DNS 트래픽에서 흔함)에서 증가합니다.",
+		"count",
+	},
+	"net.conntrack.early_drop": {
+		"Cumulative number of existing conntrack entries evicted early to make room for new connections when the table was full, summed across all CPUs. A rising value means the table is saturated and established flows are being sacrificed.",
+		"테이블이 가득 찼을 때 새 연결 공간을 만들기 위해 조기 제거된 기존 conntrack 항목의 누적 수, 모든 CPU 합계. 값이 증가하면 테이블이 포화되어 기존 흐름이 희생되고 있다는 의미입니다.",
+		"count",
+	},
+	"net.sockstat.sockets_used": {"Total number of sockets of all protocols currently allocated (from /proc/net/sockstat).", "현재 할당된 모든 프로토콜의 소켓 총 수 (/proc/net/sockstat에서 수집).", "count"},
+	"net.sockstat.tcp_inuse":    {"TCP sockets currently in use (listening and connected). See net.tcp.established for connected sockets only.", "현재 사용 중인 TCP 소켓 수 (리스닝 및 연결 포함). 연결된 소켓만 보려면 net.tcp.established를 참고하세요.", "count"},
+	"net.sockstat.tcp_orphan": {
+		"TCP sockets no longer attached to any process but still held by the kernel (e.g. waiting for FIN/ACK after close). Orphans consume memory; when net.ipv4.tcp_max_orphans is exceeded the kernel resets connections and logs 'too many orphaned sockets'.",
+		"더 이상 어떤 프로세스에도 연결되지 않았지만 커널이 아직 보유 중인 TCP 소켓 (예: close 후 FIN/ACK 대기). 고아 소켓은 메모리를 소비하며, net.ipv4.tcp_max_orphans를 초과하면 커널이 연결을 리셋하고 'too many orphaned sockets'를 기록합니다.",
+		"count",
+	},
+	"net.sockstat.tcp_tw":    {"TCP sockets in TIME_WAIT as counted by the kernel socket allocator. Should track net.tcp.time_wait closely.", "커널 소켓 할당자가 집계한 TIME_WAIT 상태 TCP 소켓 수. net.tcp.time_wait와 거의 같은 추세를 보여야 합니다.", "count"},
+	"net.sockstat.tcp_alloc": {"Total TCP sockets allocated by the kernel, including orphans and TIME_WAIT.", "고아 소켓과 TIME_WAIT를 포함하여 커널이 할당한 TCP 소켓 총 수.", "count"},
+	"net.sockstat.tcp_mem": {
+		"Memory used by TCP socket buffers across the whole system. When this approaches the net.ipv4.tcp_mem pressure threshold, the kernel shrinks buffers and throughput drops; at the hard limit new allocations fail and packets are dropped.",
+		"시스템 전체 TCP 소켓 버퍼가 사용하는 메모리. net.ipv4.tcp_mem 압박 임계치에 근접하면 커널이 버퍼를 줄여 처리량이 떨어지고, 최대 한계에 도달하면 새 할당이 실패하고 패킷이 버려집니다.",
+		"bytes",
+	},
+	"net.sockstat.udp_inuse": {"UDP sockets currently in use.", "현재 사용 중인 UDP 소켓 수.", "count"},
+	"net.sockstat.udp_mem":   {"Memory used by UDP socket buffers across the whole system. Limited by net.ipv4.udp_mem; exceeding it causes UDP receive drops.", "시스템 전체 UDP 소켓 버퍼가 사용하는 메모리. net.ipv4.udp_mem으로 제한되며, 초과하면 UDP 수신 패킷이 버려집니다.", "bytes"},
+
 	// ========================== Process ==========================
 	"proc.total_count": {
 		"Total number of processes currently running on the system. A steadily increasing process count without corresponding decreases may indicate a process fork bomb, runaway script spawning children, or zombie processes not being reaped. Typical servers run 100-500 processes.",
@@ -406,6 +453,169 @@ var metricDescriptions = map[string]MetricDesc{
 		"W",
 	},
 
+	"gpu.*.freq_mhz": {
+		"Current GPU core clock in MHz (AMD and Intel). The clock rises under load and drops when idle; a clock that stays low under load points to power or thermal throttling.",
+		"현재 GPU 코어 클럭(MHz, AMD 및 Intel). 부하가 있으면 올라가고 유휴 시 내려갑니다. 부하 중에도 클럭이 낮게 유지되면 전력 또는 발열 쓰로틀링을 의심하세요.",
+		"MHz",
+	},
+
+	// ========================== Containers ==========================
+	"container.*.cpu_pct": {
+		"CPU used by the container as a percentage of one CPU, like docker stats: 200% means two cores fully busy. Compare against the container's CPU limit; a container pinned at its limit is being throttled.",
+		"docker stats와 같이 CPU 1개 기준 백분율로 나타낸 컨테이너의 CPU 사용량. 200%는 코어 2개가 모두 사용 중이라는 뜻입니다. 컨테이너의 CPU 제한과 비교하세요. 제한에 붙어 있으면 스로틀링되고 있습니다.",
+		"%",
+	},
+	"container.*.mem_used": {
+		"Memory used by the container, excluding reclaimable page cache (as docker stats reports it). When it reaches mem_limit the kernel OOM-kills a process in the container.",
+		"회수 가능한 페이지 캐시를 제외한 컨테이너의 메모리 사용량 (docker stats와 동일). mem_limit에 도달하면 커널이 컨테이너 안의 프로세스를 OOM으로 종료합니다.",
+		"bytes",
+	},
+	"container.*.mem_limit":           {"Memory limit of the container; the host's memory when no limit is set.", "컨테이너의 메모리 제한. 제한이 없으면 호스트 메모리 크기입니다.", "bytes"},
+	"container.*.mem_used_pct":        {"mem_used as a percentage of mem_limit. Near 100% the container is about to be OOM-killed.", "mem_limit 대비 mem_used 백분율. 100%에 가까우면 컨테이너가 곧 OOM으로 종료됩니다.", "%"},
+	"container.*.net_rx_bytes_sec":    {"Bytes received per second over all of the container's network interfaces.", "컨테이너의 모든 네트워크 인터페이스에서 초당 수신한 바이트.", "bytes/s"},
+	"container.*.net_tx_bytes_sec":    {"Bytes sent per second over all of the container's network interfaces.", "컨테이너의 모든 네트워크 인터페이스에서 초당 송신한 바이트.", "bytes/s"},
+	"container.*.blk_read_bytes_sec":  {"Bytes read per second from block devices by the container.", "컨테이너가 블록 장치에서 초당 읽은 바이트.", "bytes/s"},
+	"container.*.blk_write_bytes_sec": {"Bytes written per second to block devices by the container.", "컨테이너가 블록 장치에 초당 쓴 바이트.", "bytes/s"},
+	"container.*.pids":                {"Number of processes and threads in the container.", "컨테이너 안의 프로세스와 스레드 수.", "count"},
+	"container.*.restart_count": {
+		"Times Docker has restarted the container under its restart policy. A rising count means the container keeps crashing.",
+		"재시작 정책에 따라 Docker가 컨테이너를 재시작한 횟수. 계속 증가하면 컨테이너가 반복해서 비정상 종료되고 있다는 뜻입니다.",
+		"count",
+	},
+	"container.*.healthy": {"1 if the container's healthcheck passes, 0 if it is unhealthy. Only reported for containers with a healthcheck, once it has run.", "컨테이너 헬스체크가 통과하면 1, unhealthy이면 0. 헬스체크가 있는 컨테이너에서 헬스체크가 실행된 후에만 보고됩니다.", ""},
+
+	// ========================== Prometheus Scrape ==========================
+	"prom.*.scrape_up": {
+		"1 if the last scrape of the target succeeded, 0 if the endpoint could not be reached, answered with an error or returned unparsable data. The reason is logged when it changes.",
+		"대상의 마지막 스크레이프가 성공하면 1, 엔드포인트에 연결할 수 없거나 오류를 응답했거나 해석할 수 없는 데이터를 반환하면 0. 원인은 바뀔 때마다 로그에 기록됩니다.",
+		"",
+	},
+	"prom.*.scrape_duration_ms": {
+		"Time taken to fetch and parse the target's exposition. Slow exporters delay the collector run; consider a longer per-target interval or an allowlist.",
+		"대상의 메트릭을 가져와 해석하는 데 걸린 시간. 느린 익스포터는 수집기 실행을 지연시키므로 대상별 간격을 늘리거나 allowlist를 사용하세요.",
+		"ms",
+	},
+
+	// ========================== Probes ==========================
+	"probe.*.up": {
+		"1 if the last check succeeded: the TCP connection was accepted, or the HTTP request answered with an expected status and a body matching body_regex. 0 otherwise; the reason is logged when it changes.",
+		"마지막 검사가 성공하면 1: TCP 연결이 수락되었거나 HTTP 요청이 기대한 상태 코드와 body_regex에 맞는 본문으로 응답한 경우입니다. 그 외에는 0이며 원인은 바뀔 때마다 로그에 기록됩니다.",
+		"",
+	},
+	"probe.*.duration_ms": {
+		"Time taken by the last check: the TCP connect, or the whole HTTP request including DNS, connect, TLS handshake and reading the body. A rising value means the service or the network path is getting slower.",
+		"마지막 검사에 걸린 시간: TCP 연결 시간, 또는 DNS·연결·TLS 핸드셰이크·본문 읽기를 포함한 전체 HTTP 요청 시간입니다. 값이 증가하면 서비스나 네트워크 경로가 느려지고 있다는 뜻입니다.",
+		"ms",
+	},
+	"probe.*.status_code":      {"HTTP status code of the last response (after redirects unless no_follow_redirects is set).", "마지막 응답의 HTTP 상태 코드 (no_follow_redirects가 없으면 리다이렉트 이후).", ""},
+	"probe.*.tls_handshake_ms": {"Time taken by the TLS handshake of the last https check.", "마지막 https 검사의 TLS 핸드셰이크에 걸린 시간.", "ms"},
+	"probe.*.cert_expiry_days": {
+		"Days until the server certificate expires; negative once it has expired. Renew before it reaches zero, or clients will refuse to connect.",
+		"서버 인증서가 만료되기까지 남은 일수. 만료되면 음수가 됩니다. 0이 되기 전에 갱신하지 않으면 클라이언트가 연결을 거부합니다.",
+		"days",
+	},
+
+	// ========================== Log Watch ==========================
+	"log.*.matches_per_sec": {
+		"Lines per second matching the pattern in its log file over the last interval. A burst of error lines often shows up here before the system metrics degrade.",
+		"마지막 간격 동안 로그 파일에서 패턴과 일치한 초당 줄 수. 오류 로그의 급증은 시스템 지표가 나빠지기 전에 여기서 먼저 나타나는 경우가 많습니다.",
+		"lines/s",
+	},
+	"log.*.value_avg": {"Average of the numbers captured by the pattern's value_group in the last interval (e.g. response time).", "마지막 간격 동안 패턴의 value_group으로 추출한 숫자의 평균 (예: 응답 시간).", ""},
+	"log.*.value_max": {"Largest number captured by the pattern's value_group in the last interval.", "마지막 간격 동안 패턴의 value_group으로 추출한 숫자 중 최댓값.", ""},
+
+	// ========================== Self ==========================
+	"only1mon.collector.*.duration_ms": {
+		"Wall-clock time the collector took to gather its metrics in the last run. Compare against the collector's interval: a run that approaches or exceeds the interval delays the next one. Slow collectors (e.g. process with thousands of PIDs) are good candidates for a longer per-collector interval.",
+		"직전 실행에서 수집기가 지표를 수집하는 데 걸린 실제 시간. 수집기의 수집 간격과 비교하세요: 실행 시간이 간격에 근접하거나 초과하면 다음 실행이 지연됩니다. 느린 수집기(예: PID가 수천 개인 process)는 수집기별 간격을 길게 설정하는 것이 좋습니다.",
+		"ms",
+	},
+	"only1mon.goroutines": {
+		"Number of goroutines in the only1mon process. Should stay roughly flat; steady growth points to a leak, e.g. WebSocket connections that are never cleaned up.",
+		"only1mon 프로세스의 고루틴 수. 대체로 일정해야 하며, 꾸준히 증가하면 정리되지 않는 WebSocket 연결 등 누수를 의미합니다.",
+		"count",
+	},
+	"only1mon.heap.alloc": {
+		"Bytes occupied by live and not-yet-swept heap objects in only1mon (Go runtime).",
+		"only1mon에서 살아있거나 아직 회수되지 않은 힙 객체가 차지하는 바이트 (Go 런타임).",
+		"bytes",
+	},
+	"only1mon.heap.goal": {
+		"Heap size at which the Go garbage collector will start its next cycle. Governed by GOGC and GOMEMLIMIT.",
+		"Go 가비지 컬렉터가 다음 사이클을 시작하는 힙 크기. GOGC와 GOMEMLIMIT에 의해 결정됩니다.",
+		"bytes",
+	},
+	"only1mon.mem.runtime_total": {
+		"Total memory mapped by the Go runtime for only1mon (heap, stacks, runtime metadata). Compare with RSS to see memory held outside the Go runtime, e.g. by SQLite.",
+		"Go 런타임이 only1mon을 위해 매핑한 전체 메모리(힙, 스택, 런타임 메타데이터). RSS와 비교하면 SQLite 등 Go 런타임 외부에서 사용하는 메모리를 알 수 있습니다.",
+		"bytes",
+	},
+	"only1mon.gc.cycles": {
+		"Cumulative number of completed GC cycles since only1mon started.",
+		"only1mon 시작 이후 완료된 GC 사이클 누적 수.",
+		"count",
+	},
+	"only1mon.gc.pause_ms": {
+		"Total stop-the-world GC pause time during the last collection interval (approximated from the runtime's pause histogram).",
+		"직전 수집 간격 동안의 stop-the-world GC 일시정지 시간 합계 (런타임 일시정지 히스토그램 기반 근사치).",
+		"ms",
+	},
+	"only1mon.cpu.usage_pct": {
+		"CPU time used by the only1mon process (user + system) as a percentage of one core. Values above 100% mean more than one core is busy.",
+		"only1mon 프로세스가 사용한 CPU 시간(user + system), 코어 1개 기준 백분율. 100%를 넘으면 여러 코어를 사용 중입니다.",
+		"%",
+	},
+	"only1mon.mem.rss": {
+		"Resident set size of the only1mon process — physical memory actually in use.",
+		"only1mon 프로세스의 상주 메모리(RSS) — 실제로 사용 중인 물리 메모리.",
+		"bytes",
+	},
+	"only1mon.store.samples_per_sec": {
+		"Rate of metric samples written to the SQLite database.",
+		"SQLite 데이터베이스에 기록되는 메트릭 샘플 속도.",
+		"samples/s",
+	},
+	"only1mon.store.insert_latency_ms": {
+		"Average time of a sample insert transaction during the last interval. Rising latency means the disk or database is struggling to keep up with the write load.",
+		"직전 간격 동안 샘플 삽입 트랜잭션의 평균 시간. 지연이 증가하면 디스크나 데이터베이스가 쓰기 부하를 따라가지 못하는 것입니다.",
+		"ms",
+	},
+	"only1mon.store.db_size": {
+		"Size of the only1mon SQLite database file.",
+		"only1mon SQLite 데이터베이스 파일 크기.",
+		"bytes",
+	},
+	"only1mon.store.wal_size": {
+		"Size of the SQLite write-ahead log. It is normally truncated by checkpoints; a WAL that keeps growing means checkpoints are blocked by long-running reads.",
+		"SQLite WAL(write-ahead log) 파일 크기. 보통 체크포인트로 정리되며, 계속 커지면 오래 실행되는 읽기가 체크포인트를 막고 있는 것입니다.",
+		"bytes",
+	},
+	"only1mon.store.queue_depth": {
+		"Samples waiting in the write-behind queue to be committed to SQLite. It normally drains every second; a queue that keeps growing means the disk cannot keep up with the write load.",
+		"SQLite에 기록되기를 기다리는 write-behind 큐의 샘플 수. 보통 매초 비워지며, 계속 증가하면 디스크가 쓰기 부하를 따라가지 못하는 것입니다.",
+		"count",
+	},
+	"only1mon.store.dropped_samples": {
+		"Cumulative number of samples discarded because the write queue was full. Any increase means history has gaps.",
+		"쓰기 큐가 가득 차서 버려진 샘플 누적 수. 증가하면 이력 데이터에 공백이 생긴 것입니다.",
+		"count",
+	},
+	"only1mon.store.failed_samples": {
+		"Cumulative number of samples lost because the database insert failed (e.g. disk full). Check the log for the error.",
+		"데이터베이스 삽입 실패(예: 디스크 가득 참)로 유실된 샘플 누적 수. 로그에서 오류를 확인하세요.",
+		"count",
+	},
+	"only1mon.ws.clients": {
+		"Number of connected dashboard WebSocket clients.",
+		"연결된 대시보드 WebSocket 클라이언트 수.",
+		"count",
+	},
+	"only1mon.ws.dropped": {
+		"Cumulative number of WebSocket messages dropped because a client could not keep up. A rising value means some dashboards are missing live updates.",
+		"클라이언트가 따라가지 못해 버려진 WebSocket 메시지 누적 수. 값이 증가하면 일부 대시보드가 실시간 업데이트를 놓치고 있습니다.",
+		"count",
+	},
+
 	// ========================== eBPF ==========================
 	"ebpf.bio_latency_us.p50": {
 		"Block I/O latency median (50th percentile) in microseconds. This is the 'typical' latency for disk I/O operations measured at the kernel level using eBPF. For SSDs, p50 should be under 200μs. For HDDs, 2000-5000μs is typical. Significantly higher values indicate disk performance issues.",
@@ -441,12 +651,46 @@ var metricDescriptions = map[string]MetricDesc{
 	},
 }
 
+// counterMetrics lists the description patterns whose values are cumulative,
+// monotonically increasing counters. Every other metric is a gauge.
+var counterMetrics = map[string]bool{
+	"cpu.context_switches": true, "cpu.interrupts": true,
+	"disk.*.read_bytes": true, "disk.*.write_bytes": true,
+	"disk.*.read_count": true, "disk.*.write_count": true, "disk.*.io_time": true,
+	"net.total.bytes_sent": true, "net.total.bytes_recv": true,
+	"net.total.packets_sent": true, "net.total.packets_recv": true,
+	"net.total.errin": true, "net.total.errout": true, "net.total.dropin": true, "net.total.dropout": true,
+	"net.*.bytes_sent": true, "net.*.bytes_recv": true,
+	"net.*.packets_sent": true, "net.*.packets_recv": true,
+	"net.*.errin": true, "net.*.errout": true, "net.*.dropin": true, "net.*.dropout": true,
+	"net.tcp.retransmits": true,
+	"net.conntrack.drop": true, "net.conntrack.insert_failed": true, "net.conntrack.early_drop": true,
+	"only1mon.gc.cycles": true,
+	"only1mon.store.dropped_samples": true, "only1mon.store.failed_samples": true,
+	"only1mon.ws.dropped": true,
+}
+
 // LookupMetricDesc finds the best matching description for a concrete metric name.
 // It tries exact match first, then pattern matching with "*" wildcard.
 func LookupMetricDesc(name string) MetricDesc {
+	if key, ok := MetricPattern(name); ok {
+		return metricDescriptions[key]
+	}
+	return MetricDesc{}
+}
+
+// IsCounter reports whether a metric is a cumulative counter rather than a gauge.
+func IsCounter(name string) bool {
+	key, ok := MetricPattern(name)
+	return ok && counterMetrics[key]
+}
+
+// MetricPattern returns the metricDescriptions key that describes name,
+// e.g. "disk.*.used_pct" for "disk.root.used_pct".
+func MetricPattern(name string) (string, bool) {
 	// Exact match
-	if d, ok := metricDescriptions[name]; ok {
-		return d
+	if _, ok := metricDescriptions[name]; ok {
+		return name, true
 	}
 
 	// Pattern match: replace variable segments with "*"
@@ -456,8 +700,8 @@ func LookupMetricDesc(name string) MetricDesc {
 		copy(trial, parts)
 		trial[i] = "*"
 		key := strings.Join(trial, ".")
-		if d, ok := metricDescriptions[key]; ok {
-			return d
+		if _, ok := metricDescriptions[key]; ok {
+			return key, true
 		}
 	}
 
@@ -469,11 +713,11 @@ func LookupMetricDesc(name string) MetricDesc {
 				trial[k] = "*"
 			}
 			key := strings.Join(trial, ".")
-			if d, ok := metricDescriptions[key]; ok {
-				return d
+			if _, ok := metricDescriptions[key]; ok {
+				return key, true
 			}
 		}
 	}
 
-	return MetricDesc{}
+	return "", false
 }
@@ -2,17 +2,32 @@ package collector
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/playok/only1mon/internal/model"
 	"github.com/shirou/gopsutil/v4/disk"
 )
 
-type diskCollector struct{}
+type diskCollector struct {
+	rates *counterTracker[string, uint64] // keyed by "<device>.<counter>"
+	mu    sync.Mutex                      // guards opts
+	opts  diskOptions
+}
+
+// diskOptions are the configurable options of the disk collector.
+type diskOptions struct {
+	IgnoreDevices []string `json:"ignore_devices"` // glob patterns on device names, e.g. "loop*"
+	IgnoreMounts  []string `json:"ignore_mounts"`  // glob patterns on mount points, e.g. "/snap/*"
+	IgnoreFSTypes []string `json:"ignore_fstypes"` // filesystem types, e.g. "squashfs"
+}
 
-func NewDiskCollector() Collector { return &diskCollector{} }
+func NewDiskCollector() Collector {
+	return &diskCollector{rates: newCounterTracker[string, uint64]()}
+}
 
 func (c *diskCollector) ID() string          { return "disk" }
 func (c *diskCollector) Name() string        { return "Disk" }
@@ -20,6 +35,43 @@ func (c *diskCollector) Description() string { return "Disk I/O stats and filesy
 func (c *diskCollector) Impact() model.ImpactLevel { return model.ImpactNone }
 func (c *diskCollector) Warning() string     { return "" }
 
+func (c *diskCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"ignore_devices": {Type: "array", Items: &ConfigProperty{Type: "string"},
+			Description: "Block device name patterns to skip for I/O stats (e.g. \"loop*\")"},
+		"ignore_mounts": {Type: "array", Items: &ConfigProperty{Type: "string"},
+			Description: "Mount point patterns to skip for usage stats (e.g. \"/snap/*\")"},
+		"ignore_fstypes": {Type: "array", Items: &ConfigProperty{Type: "string"},
+			Description: "Filesystem type patterns to skip for usage stats (e.g. \"squashfs\")"},
+	})
+}
+
+func (c *diskCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *diskCollector) ApplyConfig(raw json.RawMessage) error {
+	var opts diskOptions
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	if err := validGlobs("ignore_devices", opts.IgnoreDevices); err != nil {
+		return err
+	}
+	if err := validGlobs("ignore_mounts", opts.IgnoreMounts); err != nil {
+		return err
+	}
+	if err := validGlobs("ignore_fstypes", opts.IgnoreFSTypes); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.opts = opts
+	c.mu.Unlock()
+	return nil
+}
+
 func (c *diskCollector) MetricNames() []string {
 	return []string{
 		"disk.*.read_bytes_sec", "disk.*.write_bytes_sec",
@@ -32,10 +84,18 @@ func (c *diskCollector) Collect(ctx context.Context) ([]model.MetricSample, erro
 	now := time.Now().Unix()
 	var samples []model.MetricSample
 
+	c.mu.Lock()
+	opts := c.opts
+	c.mu.Unlock()
+
 	// IO counters per device
 	counters, err := disk.IOCountersWithContext(ctx)
 	if err == nil {
+		c.rates.begin(now)
 		for name, io := range counters {
+			if matchAny(opts.IgnoreDevices, name) {
+				continue
+			}
 			dev := sanitizeName(name)
 			samples = append(samples,
 				makeSample(now, "disk", fmt.Sprintf("disk.%s.read_bytes", dev), float64(io.ReadBytes)),
@@ -44,13 +104,31 @@ func (c *diskCollector) Collect(ctx context.Context) ([]model.MetricSample, erro
 				makeSample(now, "disk", fmt.Sprintf("disk.%s.write_count", dev), float64(io.WriteCount)),
 				makeSample(now, "disk", fmt.Sprintf("disk.%s.io_time", dev), float64(io.IoTime)),
 			)
+
+			// Rates (delta / elapsed seconds)
+			if r, ok := c.rates.rate(dev+".read_bytes", io.ReadBytes); ok {
+				samples = append(samples, makeSample(now, "disk", fmt.Sprintf("disk.%s.read_bytes_sec", dev), r))
+			}
+			if r, ok := c.rates.rate(dev+".write_bytes", io.WriteBytes); ok {
+				samples = append(samples, makeSample(now, "disk", fmt.Sprintf("disk.%s.write_bytes_sec", dev), r))
+			}
+			if r, ok := c.rates.rate(dev+".read_count", io.ReadCount); ok {
+				samples = append(samples, makeSample(now, "disk", fmt.Sprintf("disk.%s.read_iops", dev), r))
+			}
+			if r, ok := c.rates.rate(dev+".write_count", io.WriteCount); ok {
+				samples = append(samples, makeSample(now, "disk", fmt.Sprintf("disk.%s.write_iops", dev), r))
+			}
 		}
+		c.rates.commit()
 	}
 
 	// Filesystem usage
 	partitions, err := disk.PartitionsWithContext(ctx, false)
 	if err == nil {
 		for _, p := range partitions {
+			if matchAny(opts.IgnoreMounts, p.Mountpoint) || matchAny(opts.IgnoreFSTypes, p.Fstype) {
+				continue
+			}
 			usage, err := disk.UsageWithContext(ctx, p.Mountpoint)
 			if err != nil {
 				continue
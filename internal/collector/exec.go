@@ -0,0 +1,336 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+const (
+	// ExecCollectorType is the collector type of exec plugins.
+	ExecCollectorType = "exec"
+	// execIDPrefix starts the collector ID of every exec plugin: exec:<name>.
+	execIDPrefix = "exec:"
+	// execMaxOutput bounds the stdout read from a plugin.
+	execMaxOutput = 1 << 20
+)
+
+// execNameRe matches plugin names.
+var execNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// execOptions are the configurable options of an exec plugin.
+type execOptions struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// Timeout in seconds; bounded by the scheduler's collect timeout.
+	Timeout int `json:"timeout"`
+	// Format of stdout: "simple" (name value lines), "json" or "nagios".
+	Format string `json:"format"`
+	// Prefix of the metric names (default exec.<name>).
+	Prefix string `json:"prefix"`
+}
+
+// execCollector runs a command and turns its output into samples. Each plugin
+// is its own collector, so it has its own interval, health and errors.
+//
+// Formats:
+//
+//	simple   one "name value" pair per line → <prefix>.<name>
+//	json     an object; numbers and booleans are flattened → <prefix>.<a>.<b>
+//	nagios   plugin exit code → <prefix>.status (0 OK, 1 WARNING, 2 CRITICAL,
+//	         3 UNKNOWN) and perfdata 'label'=value[uom];... → <prefix>.<label>
+type execCollector struct {
+	name string
+
+	mu    sync.Mutex
+	opts  execOptions
+	names map[string]bool
+}
+
+// NewExecCollector creates the exec plugin with the given name. It runs
+// nothing until a command is configured.
+func NewExecCollector(name string) Collector {
+	return &execCollector{name: name, opts: defaultExecOptions(name), names: make(map[string]bool)}
+}
+
+// IsExecCollectorID reports whether id names an exec plugin.
+func IsExecCollectorID(id string) bool { return strings.HasPrefix(id, execIDPrefix) }
+
+func defaultExecOptions(name string) execOptions {
+	return execOptions{Timeout: 5, Format: "simple", Prefix: "exec." + name}
+}
+
+func (c *execCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"command": {Type: "string", Description: "Executable to run (absolute path or a name on PATH); run directly, not through a shell"},
+		"args":    {Type: "array", Items: &ConfigProperty{Type: "string"}, Description: "Command arguments"},
+		"timeout": {Type: "integer", Description: "Seconds before the command is killed", Default: 5, Minimum: bound(1), Maximum: bound(collectTimeout.Seconds())},
+		"format":  {Type: "string", Description: "Output format", Default: "simple", Enum: []string{"simple", "json", "nagios"}},
+		"prefix":  {Type: "string", Description: "Metric name prefix (default exec.<name>)"},
+	})
+}
+
+func (c *execCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *execCollector) ApplyConfig(raw json.RawMessage) error {
+	opts := defaultExecOptions(c.name)
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	if strings.TrimSpace(opts.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if opts.Timeout < 1 || time.Duration(opts.Timeout)*time.Second > collectTimeout {
+		return fmt.Errorf("timeout must be between 1 and %d seconds", int(collectTimeout.Seconds()))
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "exec." + c.name
+	}
+	if !strings.HasPrefix(opts.Prefix, "exec.") {
+		if err := ValidatePushedName(opts.Prefix); err != nil {
+			return fmt.Errorf("prefix: %v", err)
+		}
+	} else if !metricNameRe.MatchString(opts.Prefix) {
+		return fmt.Errorf("prefix: invalid metric name %q", opts.Prefix)
+	}
+	c.mu.Lock()
+	c.opts = opts
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *execCollector) ID() string   { return execIDPrefix + c.name }
+func (c *execCollector) Name() string { return "Exec: " + c.name }
+func (c *execCollector) Description() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.opts.Command == "" {
+		return "Exec plugin (no command configured)"
+	}
+	return fmt.Sprintf("Runs %s (%s output)", strings.Join(append([]string{c.opts.Command}, c.opts.Args...), " "), c.opts.Format)
+}
+func (c *execCollector) Impact() model.ImpactLevel { return model.ImpactLow }
+func (c *execCollector) Warning() string {
+	return "Runs an external command on every collection"
+}
+
+func (c *execCollector) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.names) == 0 {
+		return []string{c.opts.Prefix + ".*"}
+	}
+	names := make([]string, 0, len(c.names))
+	for n := range c.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *execCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	c.mu.Lock()
+	opts := c.opts
+	c.mu.Unlock()
+	if opts.Command == "" {
+		return nil, fmt.Errorf("no command configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(opts.Timeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, opts.Command, opts.Args...)
+	// Do not wait forever on children that keep the pipes open after a kill
+	cmd.WaitDelay = time.Second
+	var stdout, stderr limitedBuffer
+	stdout.max, stderr.max = execMaxOutput, 4096
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %ds", opts.Timeout)
+	}
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(runErr, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case runErr != nil:
+		return nil, runErr
+	}
+	if exitCode != 0 && opts.Format != "nagios" {
+		return nil, fmt.Errorf("exit status %d: %s", exitCode, firstLine(stderr.String()))
+	}
+
+	var values [][2]interface{}
+	var err error
+	switch opts.Format {
+	case "json":
+		values, err = parseExecJSON(stdout.Bytes())
+	case "nagios":
+		if exitCode < 0 || exitCode > 3 {
+			return nil, fmt.Errorf("exit status %d is not a Nagios state: %s", exitCode, firstLine(stderr.String()))
+		}
+		values = append([][2]interface{}{{"status", float64(exitCode)}}, parseNagiosPerfdata(stdout.String())...)
+	default:
+		values, err = parseExecSimple(stdout.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	samples := make([]model.MetricSample, 0, len(values))
+	c.mu.Lock()
+	for _, v := range values {
+		name := opts.Prefix + "." + v[0].(string)
+		c.names[name] = true
+		samples = append(samples, makeSample(now, c.ID(), name, v[1].(float64)))
+	}
+	c.mu.Unlock()
+	return samples, nil
+}
+
+// parseExecSimple parses "name value" lines; blank lines and # comments are
+// skipped.
+func parseExecSimple(out string) ([][2]interface{}, error) {
+	var values [][2]interface{}
+	for i, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			return nil, fmt.Errorf("line %d: expected \"name value\"", i+1)
+		}
+		v, err := strconv.ParseFloat(f[1], 64)
+		name := sanitizeMetricName(f[0])
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) || name == "" {
+			return nil, fmt.Errorf("line %d: expected \"name value\"", i+1)
+		}
+		values = append(values, [2]interface{}{name, v})
+	}
+	return values, nil
+}
+
+// parseExecJSON flattens a JSON object: nested keys are joined with dots,
+// array elements are indexed, booleans become 1/0 and strings are skipped.
+func parseExecJSON(out []byte) ([][2]interface{}, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON output: %v", err)
+	}
+	var values [][2]interface{}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch t := v.(type) {
+		case float64:
+			values = append(values, [2]interface{}{prefix, t})
+		case bool:
+			b := 0.0
+			if t {
+				b = 1
+			}
+			values = append(values, [2]interface{}{prefix, b})
+		case map[string]interface{}:
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if seg := sanitizeMetricName(strings.ReplaceAll(k, ".", "_")); seg != "" {
+					walk(joinName(prefix, seg), t[k])
+				}
+			}
+		case []interface{}:
+			for i, e := range t {
+				walk(joinName(prefix, strconv.Itoa(i)), e)
+			}
+		}
+	}
+	walk("", doc)
+	return values, nil
+}
+
+func joinName(prefix, seg string) string {
+	if prefix == "" {
+		return seg
+	}
+	return prefix + "." + seg
+}
+
+// perfdataRe matches one Nagios perfdata item: 'label'=value[uom][;warn;crit;min;max].
+var perfdataRe = regexp.MustCompile(`('[^']+'|[^\s=']+)=(-?[0-9.]+(?:[eE][-+]?[0-9]+)?)[a-zA-Z%/]*(?:;[^\s]*)?`)
+
+// parseNagiosPerfdata extracts perfdata from plugin output: the text after '|'
+// on the first line plus any further lines after a '|' (long output).
+func parseNagiosPerfdata(out string) [][2]interface{} {
+	var perf []string
+	lines := strings.Split(out, "\n")
+	if _, p, ok := strings.Cut(lines[0], "|"); ok {
+		perf = append(perf, p)
+	}
+	inPerf := false
+	for _, line := range lines[1:] {
+		if inPerf {
+			perf = append(perf, line)
+		} else if _, p, ok := strings.Cut(line, "|"); ok {
+			perf = append(perf, p)
+			inPerf = true
+		}
+	}
+
+	var values [][2]interface{}
+	for _, m := range perfdataRe.FindAllStringSubmatch(strings.Join(perf, " "), -1) {
+		label := sanitizeMetricName(strings.ReplaceAll(strings.Trim(m[1], "'"), ".", "_"))
+		v, err := strconv.ParseFloat(m[2], 64)
+		if label == "" || err != nil {
+			continue
+		}
+		values = append(values, [2]interface{}{label, v})
+	}
+	return values
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// limitedBuffer keeps the first max bytes written and discards the rest, so
+// a chatty command cannot exhaust memory.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,324 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/playok/only1mon/internal/store"
+)
+
+func TestParseExecSimple(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    [][2]interface{}
+		wantErr string
+	}{
+		{
+			name: "pairs, comments and blank lines",
+			out:  "# queue stats\nqueue.depth 12\n\n  jobs_failed\t-3.5  \nratio 1e-3 extra fields\n",
+			want: [][2]interface{}{{"queue.depth", 12.0}, {"jobs_failed", -3.5}, {"ratio", 0.001}},
+		},
+		{
+			// Only the first field is the name
+			name:    "name with a space",
+			out:     "disk /data.used% 5\n",
+			wantErr: `line 1: expected "name value"`,
+		},
+		{
+			name: "names are sanitized",
+			out:  "my/app..hits 5",
+			want: [][2]interface{}{{"my_app.hits", 5.0}},
+		},
+		{name: "empty output", out: ""},
+		{name: "missing value", out: "a 1\nb\n", wantErr: `line 2: expected "name value"`},
+		{name: "bad value", out: "a one", wantErr: `line 1: expected "name value"`},
+		{name: "NaN", out: "a NaN", wantErr: `line 1: expected "name value"`},
+		{name: "infinite", out: "a -Inf", wantErr: `line 1: expected "name value"`},
+		{name: "empty name", out: "... 1", wantErr: `line 1: expected "name value"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExecSimple(tt.out)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExecSimple: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExecJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    [][2]interface{}
+		wantErr bool
+	}{
+		{
+			name: "nested objects are flattened in key order",
+			out:  `{"queue": {"depth": 12, "workers": {"busy": 3, "idle": 1}}, "up": true, "age": 0.5}`,
+			want: [][2]interface{}{
+				{"age", 0.5}, {"queue.depth", 12.0}, {"queue.workers.busy", 3.0}, {"queue.workers.idle", 1.0}, {"up", 1.0},
+			},
+		},
+		{
+			name: "arrays are indexed",
+			out:  `{"disks": [{"used": 10}, {"used": 20}], "loads": [0.5, 1]}`,
+			want: [][2]interface{}{{"disks.0.used", 10.0}, {"disks.1.used", 20.0}, {"loads.0", 0.5}, {"loads.1", 1.0}},
+		},
+		{
+			name: "strings and nulls are skipped, booleans are 1/0",
+			out:  `{"version": "1.2", "leader": false, "ready": true, "error": null}`,
+			want: [][2]interface{}{{"leader", 0.0}, {"ready", 1.0}},
+		},
+		{
+			// Dots in keys do not create segments; other characters are
+			// sanitized and keys without any valid character are dropped
+			name: "keys are sanitized",
+			out:  `{"a.b": 1, "rx bytes": 2, "%": 3, "": 4}`,
+			want: [][2]interface{}{{"_", 3.0}, {"a_b", 1.0}, {"rx_bytes", 2.0}},
+		},
+		{name: "empty object", out: `{}`},
+		{name: "not an object", out: `[1, 2]`, wantErr: true},
+		{name: "invalid JSON", out: `{"a": `, wantErr: true},
+		{name: "plain text", out: "a 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExecJSON([]byte(tt.out))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExecJSON: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNagiosPerfdata(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want [][2]interface{}
+	}{
+		{
+			name: "no perfdata",
+			out:  "OK - all good\n",
+		},
+		{
+			// Units are dropped and thresholds, min and max are ignored
+			name: "units and thresholds",
+			out:  "DISK OK - free space: / 3326 MB (56%);| /=2643MB;5948;5958;0;5968 time=0.012s;;;0 load1=0.5;1.0;2.0 util=85%;80;90;0;100\n",
+			want: [][2]interface{}{{"_", 2643.0}, {"time", 0.012}, {"load1", 0.5}, {"util", 85.0}},
+		},
+		{
+			name: "quoted labels",
+			out:  "OK | 'free space'=42GB;10:;5: 'cpu.user'=1.5e1%\n",
+			want: [][2]interface{}{{"free_space", 42.0}, {"cpu_user", 15.0}},
+		},
+		{
+			name: "negative values and counters",
+			out:  "OK | temp=-4.5;;;-40;80 packets=1234c\n",
+			want: [][2]interface{}{{"temp", -4.5}, {"packets", 1234.0}},
+		},
+		{
+			// U marks an unknown value
+			name: "unknown and malformed values are skipped",
+			out:  "UNKNOWN | a=U b=1.2.3 c=7 =5\n",
+			want: [][2]interface{}{{"c", 7.0}},
+		},
+		{
+			name: "long output with more perfdata",
+			out:  "OK - summary | a=1\nfirst detail line\nsecond detail line | b=2\nc=3;4;5\n",
+			want: [][2]interface{}{{"a", 1.0}, {"b", 2.0}, {"c", 3.0}},
+		},
+		{
+			name: "long output before any perfdata",
+			out:  "OK - summary\nrx=5 in the details is not perfdata\ndetail | d=4\n",
+			want: [][2]interface{}{{"d", 4.0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNagiosPerfdata(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecApplyConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       string
+		wantPrefix string
+		wantErr    string
+	}{
+		{name: "default prefix", opts: `{"command": "/bin/true"}`, wantPrefix: "exec.queue"},
+		{name: "exec prefix", opts: `{"command": "/bin/true", "prefix": "exec.jobs.main"}`, wantPrefix: "exec.jobs.main"},
+		{name: "own namespace", opts: `{"command": "/bin/true", "prefix": "app.queue"}`, wantPrefix: "app.queue"},
+		{name: "no command", opts: `{"command": "  "}`, wantErr: "command is required"},
+		{name: "timeout too short", opts: `{"command": "/bin/true", "timeout": 0}`, wantErr: "timeout must be between 1 and 10 seconds"},
+		{name: "timeout too long", opts: `{"command": "/bin/true", "timeout": 60}`, wantErr: "timeout must be between 1 and 10 seconds"},
+		{name: "built-in namespace", opts: `{"command": "/bin/true", "prefix": "cpu.queue"}`, wantErr: `prefix: metric name "cpu.queue" uses the reserved prefix "cpu."`},
+		{name: "invalid exec prefix", opts: `{"command": "/bin/true", "prefix": "exec..x"}`, wantErr: `prefix: invalid metric name "exec..x"`},
+		{name: "invalid name", opts: `{"command": "/bin/true", "prefix": "app queue"}`, wantErr: `prefix: invalid metric name "app queue": use dot-separated segments of letters, digits, '_', ':' and '-'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewExecCollector("queue").(*execCollector)
+			err := c.ApplyConfig(json.RawMessage(tt.opts))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyConfig: %v", err)
+			}
+			if got := c.Config().(execOptions).Prefix; got != tt.wantPrefix {
+				t.Errorf("prefix = %q, want %q", got, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestExecCollect(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	tests := []struct {
+		name    string
+		script  string
+		format  string
+		want    map[string]float64
+		wantErr string
+	}{
+		{
+			name:   "simple",
+			script: "echo 'depth 12'; echo 'failed 1'",
+			format: "simple",
+			want:   map[string]float64{"exec.queue.depth": 12, "exec.queue.failed": 1},
+		},
+		{
+			name:   "json",
+			script: `echo '{"depth": 12, "ok": true}'`,
+			format: "json",
+			want:   map[string]float64{"exec.queue.depth": 12, "exec.queue.ok": 1},
+		},
+		{
+			name:   "nagios critical",
+			script: "echo 'CRITICAL - queue full | depth=950;500;900'; exit 2",
+			format: "nagios",
+			want:   map[string]float64{"exec.queue.status": 2, "exec.queue.depth": 950},
+		},
+		{
+			name:    "nagios exit code out of range",
+			script:  "echo 'broken' >&2; exit 4",
+			format:  "nagios",
+			wantErr: "exit status 4 is not a Nagios state: broken",
+		},
+		{
+			name:    "failing command",
+			script:  "echo 'no such queue' >&2; echo 'second line' >&2; exit 1",
+			format:  "simple",
+			wantErr: "exit status 1: no such queue",
+		},
+		{
+			name:    "unparsable output",
+			script:  "echo 'depth'",
+			format:  "simple",
+			wantErr: `line 1: expected "name value"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewExecCollector("queue").(*execCollector)
+			raw, _ := json.Marshal(execOptions{Command: sh, Args: []string{"-c", tt.script}, Timeout: 5, Format: tt.format})
+			if err := c.ApplyConfig(raw); err != nil {
+				t.Fatalf("ApplyConfig: %v", err)
+			}
+			samples, err := c.Collect(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Collect: %v", err)
+			}
+			if got := sampleValues(samples); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for _, s := range samples {
+				if s.Collector != "exec:queue" {
+					t.Errorf("%s: collector %q", s.MetricName, s.Collector)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistryCreateExec(t *testing.T) {
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer db.Close()
+	r := NewRegistry(db)
+	opts := json.RawMessage(`{"command": "/bin/true"}`)
+
+	if _, err := r.Create(ExecCollectorType, "queue", 0, opts); !errors.Is(err, ErrExecNotAllowed) {
+		t.Fatalf("Create without allow_exec: err = %v, want ErrExecNotAllowed", err)
+	}
+	if _, ok := r.GetCollector("exec:queue"); ok {
+		t.Fatal("collector registered although exec is not allowed")
+	}
+
+	r.AllowExec(true)
+	tests := []struct {
+		typ, name string
+		opts      string
+		wantErr   error
+	}{
+		{ExecCollectorType, "queue", `{"command": "/bin/true"}`, nil},
+		{ExecCollectorType, "queue", `{"command": "/bin/true"}`, ErrCollectorExists},
+		{"shell", "other", `{"command": "/bin/true"}`, ErrUnknownCollectorType},
+		{ExecCollectorType, "Bad Name", `{"command": "/bin/true"}`, ErrInvalidCollectorName},
+		{ExecCollectorType, "other", `{"command": ""}`, ErrInvalidConfig},
+		{ExecCollectorType, "other", `{"command": "/bin/true", "format": "xml"}`, ErrInvalidConfig},
+	}
+	for _, tt := range tests {
+		id, err := r.Create(tt.typ, tt.name, 0, json.RawMessage(tt.opts))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Create(%s, %s, %s): err = %v, want %v", tt.typ, tt.name, tt.opts, err, tt.wantErr)
+		}
+		if err == nil && (id != "exec:"+tt.name || !r.IsEnabled(id)) {
+			t.Errorf("Create(%s, %s): id %q, enabled %v", tt.typ, tt.name, id, r.IsEnabled(id))
+		}
+	}
+}
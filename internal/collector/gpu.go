@@ -3,41 +3,167 @@ package collector
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/playok/only1mon/internal/model"
 )
 
-type gpuCollector struct{}
+// gpuBackend reads the GPUs of one vendor. Every backend reports the same
+// metric names, gpu.<id>.<metric>; NVIDIA GPUs are identified by their
+// nvidia-smi index, DRM devices by their card name (card0).
+type gpuBackend interface {
+	name() string
+	// detect reports whether GPUs of the backend are present.
+	detect(opts gpuOptions) bool
+	collect(ctx context.Context, opts gpuOptions, now int64) ([]model.MetricSample, error)
+}
+
+// gpuBackendNames lists the backends in detection order.
+var gpuBackendNames = []string{"nvidia", "amdgpu", "intel"}
+
+type gpuCollector struct {
+	sysfsRoot string // "/sys"; a fixture directory in tests
+
+	mu       sync.Mutex // guards opts
+	opts     gpuOptions
+	backends map[string]gpuBackend
+}
 
-func NewGPUCollector() Collector { return &gpuCollector{} }
+// gpuOptions are the configurable options of the GPU collector.
+type gpuOptions struct {
+	NvidiaSmiPath string   `json:"nvidia_smi_path"` // empty = look up in PATH
+	Backends      []string `json:"backends"`        // empty = auto-detect
+}
+
+func NewGPUCollector() Collector { return newGPUCollector("/sys") }
+
+func newGPUCollector(sysfsRoot string) *gpuCollector {
+	c := &gpuCollector{sysfsRoot: sysfsRoot}
+	c.backends = map[string]gpuBackend{
+		"nvidia": &nvidiaGPUBackend{},
+		"amdgpu": &amdGPUBackend{sysfsRoot: sysfsRoot},
+		"intel":  &intelGPUBackend{sysfsRoot: sysfsRoot, rates: newCounterTracker[string, float64]()},
+	}
+	return c
+}
 
-func (c *gpuCollector) ID() string          { return "gpu" }
-func (c *gpuCollector) Name() string        { return "GPU (NVIDIA)" }
-func (c *gpuCollector) Description() string { return "NVIDIA GPU utilization, memory, temperature, power via nvidia-smi" }
+func (c *gpuCollector) ID() string   { return "gpu" }
+func (c *gpuCollector) Name() string { return "GPU" }
+func (c *gpuCollector) Description() string {
+	return "GPU utilization, memory, temperature, power via nvidia-smi (NVIDIA) and sysfs (AMD, Intel)"
+}
 func (c *gpuCollector) Impact() model.ImpactLevel { return model.ImpactMedium }
 func (c *gpuCollector) Warning() string {
-	return "Runs nvidia-smi subprocess; requires NVIDIA drivers"
+	return "Runs nvidia-smi subprocess on NVIDIA hosts"
+}
+
+func (c *gpuCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"nvidia_smi_path": {Type: "string", Description: "Absolute path to the nvidia-smi binary, e.g. /usr/local/nvidia/bin/nvidia-smi (empty = search PATH)"},
+		"backends": {Type: "array", Items: &ConfigProperty{Type: "string", Enum: gpuBackendNames},
+			Description: "GPU backends to read (empty = detect automatically)"},
+	})
+}
+
+func (c *gpuCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *gpuCollector) ApplyConfig(raw json.RawMessage) error {
+	var opts gpuOptions
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	for _, b := range opts.Backends {
+		if _, ok := c.backends[b]; !ok {
+			return fmt.Errorf("backends: unknown backend %q", b)
+		}
+	}
+	// The config API is unauthenticated: only let it relocate nvidia-smi, not
+	// run arbitrary programs (that is what allow_exec guards)
+	if p := opts.NvidiaSmiPath; p != "" && (!filepath.IsAbs(p) || filepath.Base(p) != "nvidia-smi") {
+		return fmt.Errorf("nvidia_smi_path must be an absolute path to a file named nvidia-smi")
+	}
+	c.mu.Lock()
+	c.opts = opts
+	c.mu.Unlock()
+	return nil
 }
 
 func (c *gpuCollector) MetricNames() []string {
 	return []string{
 		"gpu.*.util_pct", "gpu.*.mem_util_pct", "gpu.*.temp_c",
-		"gpu.*.mem_used", "gpu.*.mem_total", "gpu.*.power_watts",
+		"gpu.*.mem_used", "gpu.*.mem_total", "gpu.*.power_watts", "gpu.*.freq_mhz",
 	}
 }
 
+// Collect reads the configured backends, or every detected one. Without a
+// GPU it returns nothing; a backend that was configured but finds no GPU is
+// an error.
 func (c *gpuCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
 	now := time.Now().Unix()
 
-	// Check if nvidia-smi exists
-	path, err := exec.LookPath("nvidia-smi")
+	c.mu.Lock()
+	opts := c.opts
+	c.mu.Unlock()
+	names := opts.Backends
+	explicit := len(names) > 0
+	if !explicit {
+		names = gpuBackendNames
+	}
+
+	var samples []model.MetricSample
+	var errs []string
+	for _, name := range names {
+		b := c.backends[name]
+		if !b.detect(opts) {
+			if explicit {
+				errs = append(errs, name+": no GPU found")
+			}
+			continue
+		}
+		s, err := b.collect(ctx, opts, now)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		samples = append(samples, s...)
+	}
+	if len(errs) > 0 {
+		return samples, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return samples, nil
+}
+
+// nvidiaGPUBackend queries NVIDIA GPUs with nvidia-smi.
+type nvidiaGPUBackend struct{}
+
+func (b *nvidiaGPUBackend) name() string { return "nvidia" }
+
+func (b *nvidiaGPUBackend) binary(opts gpuOptions) (string, error) {
+	if opts.NvidiaSmiPath != "" {
+		return exec.LookPath(filepath.Clean(opts.NvidiaSmiPath))
+	}
+	return exec.LookPath("nvidia-smi")
+}
+
+func (b *nvidiaGPUBackend) detect(opts gpuOptions) bool {
+	_, err := b.binary(opts)
+	return err == nil
+}
+
+func (b *nvidiaGPUBackend) collect(ctx context.Context, opts gpuOptions, now int64) ([]model.MetricSample, error) {
+	path, err := b.binary(opts)
 	if err != nil {
-		return nil, nil // no NVIDIA GPU, skip silently
+		return nil, fmt.Errorf("nvidia-smi: %w", err)
 	}
 
 	cmd := exec.CommandContext(ctx, path,
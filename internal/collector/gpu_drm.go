@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// drmCard is a DRM device under <sysfs>/class/drm.
+type drmCard struct {
+	name   string // e.g. card0
+	dir    string // <sysfs>/class/drm/card0
+	driver string // kernel driver of the device, e.g. amdgpu
+}
+
+// drmCards lists the DRM cards whose driver is one of drivers. Connector
+// entries (card0-HDMI-A-1) are skipped.
+func drmCards(sysfsRoot string, drivers ...string) []drmCard {
+	dirs, _ := filepath.Glob(filepath.Join(sysfsRoot, "class", "drm", "card*"))
+	var cards []drmCard
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		if strings.Contains(name, "-") {
+			continue
+		}
+		link, err := os.Readlink(filepath.Join(dir, "device", "driver"))
+		if err != nil {
+			continue
+		}
+		driver := filepath.Base(link)
+		for _, d := range drivers {
+			if driver == d {
+				cards = append(cards, drmCard{name: name, dir: dir, driver: driver})
+				break
+			}
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool { return cards[i].name < cards[j].name })
+	return cards
+}
+
+// readSysfsFloat reads a sysfs file holding a single number.
+func readSysfsFloat(path string) (float64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	return v, err == nil
+}
+
+// hwmonFloat reads a file of the card's first hwmon directory.
+func hwmonFloat(card drmCard, file string) (float64, bool) {
+	dirs, _ := filepath.Glob(filepath.Join(card.dir, "device", "hwmon", "hwmon*"))
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		if v, ok := readSysfsFloat(filepath.Join(d, file)); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// amdGPUBackend reads AMD GPUs from the amdgpu driver's sysfs files.
+type amdGPUBackend struct {
+	sysfsRoot string
+}
+
+func (b *amdGPUBackend) name() string           { return "amdgpu" }
+func (b *amdGPUBackend) detect(gpuOptions) bool { return len(drmCards(b.sysfsRoot, "amdgpu")) > 0 }
+
+func (b *amdGPUBackend) collect(ctx context.Context, _ gpuOptions, now int64) ([]model.MetricSample, error) {
+	var samples []model.MetricSample
+	for _, card := range drmCards(b.sysfsRoot, "amdgpu") {
+		base := "gpu." + card.name
+		dev := filepath.Join(card.dir, "device")
+		add := func(metric string, v float64) {
+			samples = append(samples, makeSample(now, "gpu", base+"."+metric, v))
+		}
+		if v, ok := readSysfsFloat(filepath.Join(dev, "gpu_busy_percent")); ok {
+			add("util_pct", v)
+		}
+		if v, ok := readSysfsFloat(filepath.Join(dev, "mem_busy_percent")); ok {
+			add("mem_util_pct", v)
+		}
+		if v, ok := readSysfsFloat(filepath.Join(dev, "mem_info_vram_used")); ok {
+			add("mem_used", v)
+		}
+		if v, ok := readSysfsFloat(filepath.Join(dev, "mem_info_vram_total")); ok {
+			add("mem_total", v)
+		}
+		if v, ok := hwmonFloat(card, "temp1_input"); ok {
+			add("temp_c", v/1000) // millidegrees
+		}
+		// Older kernels report power1_average, newer ones power1_input
+		if v, ok := hwmonFloat(card, "power1_average"); ok {
+			add("power_watts", v/1e6) // microwatts
+		} else if v, ok := hwmonFloat(card, "power1_input"); ok {
+			add("power_watts", v/1e6)
+		}
+		if v, ok := hwmonFloat(card, "freq1_input"); ok {
+			add("freq_mhz", v/1e6) // Hz
+		}
+	}
+	return samples, nil
+}
+
+// intelGPUBackend reads Intel GPUs driven by i915 or xe. sysfs has no busy
+// percentage for them, so util_pct is derived from the time the GT spent in
+// its RC6 idle state; power comes from the energy counter of discrete cards.
+type intelGPUBackend struct {
+	sysfsRoot string
+
+	mu    sync.Mutex
+	rates *counterTracker[string, float64] // keyed by "<card>.<counter>"
+}
+
+func (b *intelGPUBackend) name() string { return "intel" }
+func (b *intelGPUBackend) detect(gpuOptions) bool {
+	return len(drmCards(b.sysfsRoot, "i915", "xe")) > 0
+}
+
+// intelIdlePaths are the RC6 idle residency counters, in milliseconds.
+var intelIdlePaths = []string{
+	"gt/gt0/rc6_residency_ms",                   // i915
+	"power/rc6_residency_ms",                    // i915, older kernels
+	"device/tile0/gt0/gtidle/idle_residency_ms", // xe
+}
+
+// intelFreqPaths are the current GT frequency, in MHz.
+var intelFreqPaths = []string{
+	"gt/gt0/rps_act_freq_mhz",         // i915
+	"gt_act_freq_mhz",                 // i915, older kernels
+	"device/tile0/gt0/freq0/act_freq", // xe
+}
+
+func (b *intelGPUBackend) collect(ctx context.Context, _ gpuOptions, now int64) ([]model.MetricSample, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rates.begin(now)
+	defer b.rates.commit()
+	var samples []model.MetricSample
+	for _, card := range drmCards(b.sysfsRoot, "i915", "xe") {
+		base := "gpu." + card.name
+		add := func(metric string, v float64) {
+			samples = append(samples, makeSample(now, "gpu", base+"."+metric, v))
+		}
+		if idle, ok := firstSysfsFloat(card.dir, intelIdlePaths); ok {
+			// Milliseconds idle per second → percent busy
+			if r, ok := b.rates.rate(card.name+".idle_ms", idle); ok {
+				add("util_pct", clampPct(100-r/10))
+			}
+		}
+		if energy, ok := hwmonFloat(card, "energy1_input"); ok {
+			if r, ok := b.rates.rate(card.name+".energy_uj", energy); ok {
+				add("power_watts", r/1e6) // microjoules per second
+			}
+		}
+		if v, ok := firstSysfsFloat(card.dir, intelFreqPaths); ok {
+			add("freq_mhz", v)
+		}
+		if v, ok := hwmonFloat(card, "temp1_input"); ok {
+			add("temp_c", v/1000)
+		}
+	}
+	return samples, nil
+}
+
+// firstSysfsFloat reads the first of paths (relative to dir) that exists.
+func firstSysfsFloat(dir string, paths []string) (float64, bool) {
+	for _, p := range paths {
+		if v, ok := readSysfsFloat(filepath.Join(dir, p)); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func clampPct(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		return 100
+	}
+	return v
+}
@@ -0,0 +1,282 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeSysfs creates files under root; a value starting with "->" creates a
+// symlink to the rest of it instead.
+func writeSysfs(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(path)
+		var err error
+		if target, ok := strings.CutPrefix(content, "->"); ok {
+			err = os.Symlink(target, path)
+		} else {
+			err = os.WriteFile(path, []byte(content+"\n"), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// drmFixture builds a sysfs tree with an amdgpu card, its HDMI connector, an
+// i915 and an xe card, a nouveau card and a render node.
+func drmFixture(t *testing.T) string {
+	root := t.TempDir()
+	drm := "class/drm/"
+	writeSysfs(t, root, map[string]string{
+		drm + "card0/device/driver":                      "->../../../bus/pci/drivers/amdgpu",
+		drm + "card0/device/gpu_busy_percent":            "37",
+		drm + "card0/device/mem_busy_percent":            "12",
+		drm + "card0/device/mem_info_vram_used":          "1073741824",
+		drm + "card0/device/mem_info_vram_total":         "8589934592",
+		drm + "card0/device/hwmon/hwmon3/temp1_input":    "45000",
+		drm + "card0/device/hwmon/hwmon3/power1_average": "35500000",
+		drm + "card0/device/hwmon/hwmon3/freq1_input":    "1800000000",
+		// Connectors share the card's device
+		drm + "card0-HDMI-A-1/device/driver": "->../../../bus/pci/drivers/amdgpu",
+		drm + "card0-HDMI-A-1/status":        "connected",
+
+		drm + "card1/device/driver":                     "->../../../bus/pci/drivers/i915",
+		drm + "card1/gt/gt0/rc6_residency_ms":           "100000",
+		drm + "card1/gt/gt0/rps_act_freq_mhz":           "1100",
+		drm + "card1/device/hwmon/hwmon5/energy1_input": "5000000000",
+
+		drm + "card2/device/driver":                             "->../../../bus/pci/drivers/xe",
+		drm + "card2/device/tile0/gt0/gtidle/idle_residency_ms": "500000",
+		drm + "card2/device/tile0/gt0/freq0/act_freq":           "2050",
+		drm + "card2/device/hwmon/hwmon6/temp1_input":           "60500",
+		drm + "card3/device/driver":                             "->../../../bus/pci/drivers/nouveau",
+		drm + "renderD128/device/driver":                        "->../../../bus/pci/drivers/amdgpu",
+	})
+	return root
+}
+
+func TestDRMCards(t *testing.T) {
+	root := drmFixture(t)
+	tests := []struct {
+		drivers []string
+		want    []string
+	}{
+		{[]string{"amdgpu"}, []string{"card0"}},
+		{[]string{"i915", "xe"}, []string{"card1", "card2"}},
+		{[]string{"xe"}, []string{"card2"}},
+		{[]string{"nouveau"}, []string{"card3"}},
+		{[]string{"radeon"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range drmCards(root, tt.drivers...) {
+			got = append(got, c.name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("drmCards(%v) = %v, want %v", tt.drivers, got, tt.want)
+		}
+	}
+}
+
+func TestGPUDetect(t *testing.T) {
+	tests := []struct {
+		name  string
+		root  string
+		found map[string]bool
+	}{
+		{"fixture", drmFixture(t), map[string]bool{"amdgpu": true, "intel": true}},
+		{"no drm", t.TempDir(), map[string]bool{"amdgpu": false, "intel": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newGPUCollector(tt.root)
+			for backend, want := range tt.found {
+				if got := c.backends[backend].detect(gpuOptions{}); got != want {
+					t.Errorf("%s detect = %v, want %v", backend, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGPUCollectBackends(t *testing.T) {
+	tests := []struct {
+		name     string
+		root     string
+		backends []string
+		cards    []string
+		wantErr  string
+	}{
+		{"amdgpu", drmFixture(t), []string{"amdgpu"}, []string{"card0"}, ""},
+		{"intel", drmFixture(t), []string{"intel"}, []string{"card1", "card2"}, ""},
+		{"amdgpu and intel", drmFixture(t), []string{"amdgpu", "intel"}, []string{"card0", "card1", "card2"}, ""},
+		{"configured backend without GPU", t.TempDir(), []string{"amdgpu"}, nil, "amdgpu: no GPU found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newGPUCollector(tt.root)
+			raw, _ := json.Marshal(gpuOptions{Backends: tt.backends})
+			if err := c.ApplyConfig(raw); err != nil {
+				t.Fatalf("ApplyConfig: %v", err)
+			}
+			samples, err := c.Collect(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Collect: %v", err)
+			}
+			seen := map[string]bool{}
+			var cards []string
+			for _, s := range samples {
+				card := strings.Split(s.MetricName, ".")[1]
+				if !seen[card] {
+					seen[card] = true
+					cards = append(cards, card)
+				}
+			}
+			if !reflect.DeepEqual(cards, tt.cards) {
+				t.Errorf("cards = %v, want %v", cards, tt.cards)
+			}
+		})
+	}
+}
+
+func TestAMDGPUCollect(t *testing.T) {
+	c := newGPUCollector(drmFixture(t))
+	samples, err := c.backends["amdgpu"].collect(context.Background(), gpuOptions{}, 1000)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	want := map[string]float64{
+		"gpu.card0.util_pct":     37,
+		"gpu.card0.mem_util_pct": 12,
+		"gpu.card0.mem_used":     1 << 30,
+		"gpu.card0.mem_total":    8 << 30,
+		"gpu.card0.temp_c":       45,   // millidegrees
+		"gpu.card0.power_watts":  35.5, // microwatts
+		"gpu.card0.freq_mhz":     1800, // Hz
+	}
+	if got := sampleValues(samples); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, s := range samples {
+		if s.Timestamp != 1000 || s.Collector != "gpu" {
+			t.Errorf("%s: timestamp %d, collector %q", s.MetricName, s.Timestamp, s.Collector)
+		}
+	}
+}
+
+func TestAMDGPUPowerInput(t *testing.T) {
+	root := drmFixture(t)
+	hwmon := filepath.Join(root, "class/drm/card0/device/hwmon/hwmon3")
+	os.Remove(filepath.Join(hwmon, "power1_average"))
+	writeSysfs(t, hwmon, map[string]string{"power1_input": "12000000"})
+
+	c := newGPUCollector(root)
+	samples, _ := c.backends["amdgpu"].collect(context.Background(), gpuOptions{}, 1000)
+	if got := sampleValues(samples)["gpu.card0.power_watts"]; got != 12 {
+		t.Errorf("power_watts = %v, want 12", got)
+	}
+}
+
+func TestIntelGPUCollect(t *testing.T) {
+	root := drmFixture(t)
+	c := newGPUCollector(root)
+	b := c.backends["intel"]
+	const (
+		i915Idle  = "class/drm/card1/gt/gt0/rc6_residency_ms"
+		i915Power = "class/drm/card1/device/hwmon/hwmon5/energy1_input"
+		xeIdle    = "class/drm/card2/device/tile0/gt0/gtidle/idle_residency_ms"
+	)
+
+	tests := []struct {
+		name  string
+		now   int64
+		files map[string]string
+		want  map[string]float64
+	}{
+		{
+			name: "first reading has no utilization or power",
+			now:  1000,
+			want: map[string]float64{
+				"gpu.card1.freq_mhz": 1100,
+				"gpu.card2.freq_mhz": 2050,
+				"gpu.card2.temp_c":   60.5,
+			},
+		},
+		{
+			// 7.5s of 10s idle is 25% busy; 150 J in 10s is 15 W; the xe
+			// card was idle throughout
+			name:  "busy and power",
+			now:   1010,
+			files: map[string]string{i915Idle: "107500", i915Power: "5150000000", xeIdle: "510000"},
+			want: map[string]float64{
+				"gpu.card1.util_pct":    25,
+				"gpu.card1.power_watts": 15,
+				"gpu.card1.freq_mhz":    1100,
+				"gpu.card2.util_pct":    0,
+				"gpu.card2.freq_mhz":    2050,
+				"gpu.card2.temp_c":      60.5,
+			},
+		},
+		{
+			// More idle time than wall time (sampling skew) clamps to 0;
+			// no idle time at all is 100% busy
+			name:  "clamped",
+			now:   1020,
+			files: map[string]string{i915Idle: "120000", i915Power: "5150000000", xeIdle: "510000"},
+			want: map[string]float64{
+				"gpu.card1.util_pct":    0,
+				"gpu.card1.power_watts": 0,
+				"gpu.card1.freq_mhz":    1100,
+				"gpu.card2.util_pct":    100,
+				"gpu.card2.freq_mhz":    2050,
+				"gpu.card2.temp_c":      60.5,
+			},
+		},
+		{
+			// The RC6 counter restarted (e.g. after a resume): no rate
+			name:  "counter reset",
+			now:   1030,
+			files: map[string]string{i915Idle: "10", i915Power: "5160000000", xeIdle: "515000"},
+			want: map[string]float64{
+				"gpu.card1.power_watts": 1,
+				"gpu.card1.freq_mhz":    1100,
+				"gpu.card2.util_pct":    50,
+				"gpu.card2.freq_mhz":    2050,
+				"gpu.card2.temp_c":      60.5,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeSysfs(t, root, tt.files)
+			samples, err := b.collect(context.Background(), gpuOptions{}, tt.now)
+			if err != nil {
+				t.Fatalf("collect: %v", err)
+			}
+			got := sampleValues(samples)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if v, ok := got[name]; !ok || math.Abs(v-want) > 1e-9 {
+					t.Errorf("%s = %v (present %v), want %v", name, v, ok, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+const (
+	// GraphiteCollectorID is the collector ID of the Graphite listener.
+	GraphiteCollectorID = "graphite"
+	// graphiteBatchSize is the most lines ingested at once from a connection.
+	graphiteBatchSize = 1000
+	// graphiteIdleTimeout closes connections that send nothing for this long.
+	graphiteIdleTimeout = 5 * time.Minute
+	// graphiteMaxLine bounds the length of a line; longer lines are dropped.
+	graphiteMaxLine = 64 << 10
+)
+
+// GraphiteCollector accepts the Graphite plaintext protocol over TCP:
+//
+//	<path>[;tag=value...] <value> [<timestamp>]
+//
+// Each line becomes a sample named graphite.<path> with the tags as sorted
+// k=v labels. It is a PushCollector: received samples go straight through
+// Scheduler.Ingest.
+type GraphiteCollector struct {
+	*pushedCollector
+	addr  string
+	ln    net.Listener
+	sched *Scheduler
+
+	wg    sync.WaitGroup
+	mu    sync.Mutex // guards conns
+	conns map[net.Conn]bool
+}
+
+func NewGraphiteCollector(addr string) *GraphiteCollector {
+	return &GraphiteCollector{
+		pushedCollector: newPushedCollector(GraphiteCollectorID, "Graphite",
+			"Metrics received in Graphite plaintext protocol on tcp "+addr),
+		addr:  addr,
+		conns: make(map[net.Conn]bool),
+	}
+}
+
+// Listen binds the TCP listener. Connections are accepted once Start is called.
+func (c *GraphiteCollector) Listen() error {
+	ln, err := net.Listen("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.ln = ln
+	return nil
+}
+
+// Start begins accepting connections, ingesting through sched.
+func (c *GraphiteCollector) Start(sched *Scheduler) {
+	c.sched = sched
+	c.wg.Add(1)
+	go c.acceptLoop()
+}
+
+// Close stops the listener and closes open connections.
+func (c *GraphiteCollector) Close() {
+	if c.ln == nil {
+		return
+	}
+	c.ln.Close()
+	c.mu.Lock()
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+func (c *GraphiteCollector) acceptLoop() {
+	defer c.wg.Done()
+	for {
+		conn, err := c.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[graphite] accept error: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		c.mu.Lock()
+		c.conns[conn] = true
+		c.mu.Unlock()
+		c.wg.Add(1)
+		go c.serve(conn)
+	}
+}
+
+// serve ingests the lines of one connection.
+func (c *GraphiteCollector) serve(conn net.Conn) {
+	defer c.wg.Done()
+	defer func() {
+		c.mu.Lock()
+		delete(c.conns, conn)
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	readGraphite(conn, func(batch []model.MetricSample, bad int) {
+		if len(batch) > 0 {
+			if _, err := c.sched.Ingest(GraphiteCollectorID, batch); err != nil && !errors.Is(err, ErrCollectorDisabled) {
+				log.Printf("[graphite] ingest error: %v", err)
+			}
+		}
+		if bad > 0 {
+			log.Printf("[graphite] %s: dropped %d malformed lines", conn.RemoteAddr(), bad)
+		}
+	})
+}
+
+// readGraphite reads lines from conn until it is closed or idle, passing the
+// parsed samples and the number of malformed lines to flush whenever the
+// connection has no more buffered input or a batch is full. flush must not
+// keep batch. Lines longer than graphiteMaxLine count as malformed.
+func readGraphite(conn net.Conn, flush func(batch []model.MetricSample, bad int)) {
+	r := bufio.NewReaderSize(conn, graphiteMaxLine)
+	var batch []model.MetricSample
+	bad := 0
+	skipping := false // dropping the rest of an over-long line
+	defer func() {
+		if len(batch) > 0 || bad > 0 {
+			flush(batch, bad)
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(graphiteIdleTimeout))
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			if !skipping {
+				bad++
+				skipping = true
+			}
+			continue
+		}
+		if skipping {
+			skipping = false
+		} else if line := strings.TrimSpace(string(line)); line != "" {
+			s, perr := ParseGraphiteLine(line, time.Now())
+			if perr != nil {
+				bad++
+			} else {
+				batch = append(batch, s)
+			}
+		}
+		if err != nil {
+			// EOF, idle timeout and shutdown are normal ways for a connection to end
+			var ne net.Error
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !(errors.As(err, &ne) && ne.Timeout()) {
+				log.Printf("[graphite] %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if (len(batch) > 0 || bad > 0) && (len(batch) >= graphiteBatchSize || r.Buffered() == 0) {
+			flush(batch, bad)
+			batch, bad = batch[:0], 0
+		}
+	}
+}
+
+// ParseGraphiteLine parses one plaintext protocol line. A missing timestamp or
+// -1 means now; one in milliseconds is converted and one in the future is
+// rejected.
+func ParseGraphiteLine(line string, now time.Time) (model.MetricSample, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return model.MetricSample{}, fmt.Errorf("expected <path> <value> [<timestamp>]")
+	}
+	path, tagStr, _ := strings.Cut(fields[0], ";")
+	name := sanitizeMetricName(path)
+	if name == "" {
+		return model.MetricSample{}, fmt.Errorf("empty path")
+	}
+	var tags []string
+	if tagStr != "" {
+		for _, t := range strings.Split(tagStr, ";") {
+			if k, _, ok := strings.Cut(t, "="); !ok || k == "" {
+				return model.MetricSample{}, fmt.Errorf("bad tag %q", t)
+			}
+			tags = append(tags, t)
+		}
+		sort.Strings(tags)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsInf(value, 0) {
+		return model.MetricSample{}, fmt.Errorf("bad value %q", fields[1])
+	}
+	if math.IsNaN(value) {
+		return model.MetricSample{}, fmt.Errorf("value is NaN")
+	}
+	ts := now.Unix()
+	if len(fields) == 3 && fields[2] != "-1" {
+		t, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || t < 0 || math.IsInf(t, 0) {
+			return model.MetricSample{}, fmt.Errorf("bad timestamp %q", fields[2])
+		}
+		if ts, err = PushTimestamp(int64(t), now); err != nil {
+			return model.MetricSample{}, err
+		}
+	}
+	return model.MetricSample{
+		Timestamp:  ts,
+		Collector:  GraphiteCollectorID,
+		MetricName: "graphite." + name,
+		Value:      value,
+		Labels:     strings.Join(tags, ","),
+	}, nil
+}
@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+func TestParseGraphiteLine(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	sample := func(name string, v float64, ts int64, labels string) model.MetricSample {
+		return model.MetricSample{Timestamp: ts, Collector: GraphiteCollectorID, MetricName: name, Value: v, Labels: labels}
+	}
+	tests := []struct {
+		line    string
+		want    model.MetricSample
+		wantErr string
+	}{
+		{line: "servers.web1.load 0.75 1699999990", want: sample("graphite.servers.web1.load", 0.75, 1699999990, "")},
+		{line: "servers.web1.load 0.75", want: sample("graphite.servers.web1.load", 0.75, 1700000000, "")},
+		{line: "servers.web1.load 0.75 -1", want: sample("graphite.servers.web1.load", 0.75, 1700000000, "")},
+		{line: "  servers.web1.load\t-3e2   1699999990 ", want: sample("graphite.servers.web1.load", -300, 1699999990, "")},
+		{line: "disk.used;host=web1;dc=eu 42 1699999990", want: sample("graphite.disk.used", 42, 1699999990, "dc=eu,host=web1")},
+		{line: "disk.used;mount=/ 1 1699999990", want: sample("graphite.disk.used", 1, 1699999990, "mount=/")},
+		{line: "my-app..requests/s 5 1699999990", want: sample("graphite.my-app.requests_s", 5, 1699999990, "")},
+		{line: "app.x 5 1699999990123", want: sample("graphite.app.x", 5, 1699999990, "")}, // milliseconds
+		{line: "app.x 5 1699999990.9", want: sample("graphite.app.x", 5, 1699999990, "")},  // fractional seconds
+		{line: "app.x 5 1700000500", want: sample("graphite.app.x", 5, 1700000500, "")},    // within MaxPushFuture
+		{line: "app.x 5 1700001000", wantErr: "timestamp is in the future"},                // beyond it
+		{line: "app.x 5 1700001000000", wantErr: "timestamp is in the future"},             // also in milliseconds
+		{line: "app.x", wantErr: "expected <path> <value> [<timestamp>]"},                  // no value
+		{line: "app.x 1 2 3", wantErr: "expected <path> <value> [<timestamp>]"},            // too many fields
+		{line: "... 1", wantErr: "empty path"},                                             // only separators
+		{line: ";host=a 1", wantErr: "empty path"},                                         // tags without a path
+		{line: "app.x;host 1", wantErr: `bad tag "host"`},                                  // tag without =
+		{line: "app.x;=a 1", wantErr: `bad tag "=a"`},                                      // tag without a name
+		{line: "app.x one", wantErr: `bad value "one"`},                                    // not a number
+		{line: "app.x +Inf", wantErr: `bad value "+Inf"`},                                  // infinite
+		{line: "app.x NaN", wantErr: "value is NaN"},                                       // NaN
+		{line: "app.x 1 yesterday", wantErr: `bad timestamp "yesterday"`},                  // not a number
+		{line: "app.x 1 -5", wantErr: `bad timestamp "-5"`},                                // negative other than -1
+		{line: "app.x 1 Inf", wantErr: `bad timestamp "Inf"`},                              // infinite
+	}
+	for _, tt := range tests {
+		got, err := ParseGraphiteLine(tt.line, now)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%q: err = %v, want %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+// graphiteFlush records what readGraphite passes to flush.
+type graphiteFlush struct {
+	names []string
+	bad   int
+}
+
+func TestReadGraphite(t *testing.T) {
+	long := "app.long " + strings.Repeat("1", graphiteMaxLine) + "\n"
+	tests := []struct {
+		name   string
+		writes []string // written one after another
+		want   []graphiteFlush
+	}{
+		{
+			name:   "one flush per write",
+			writes: []string{"app.a 1\napp.b 2\n", "app.c 3\n"},
+			want: []graphiteFlush{
+				{names: []string{"graphite.app.a", "graphite.app.b"}},
+				{names: []string{"graphite.app.c"}},
+			},
+		},
+		{
+			name:   "malformed lines are counted",
+			writes: []string{"app.a 1\napp.b\n\n   \napp.c x\n"},
+			want:   []graphiteFlush{{names: []string{"graphite.app.a"}, bad: 2}},
+		},
+		{
+			// Input is still buffered after app.a, so both go together
+			name:   "line split across writes",
+			writes: []string{"app.a 1\napp.", "b 2\n"},
+			want:   []graphiteFlush{{names: []string{"graphite.app.a", "graphite.app.b"}}},
+		},
+		{
+			name:   "last line without a newline",
+			writes: []string{"app.a 1\r\napp.b 2"},
+			want:   []graphiteFlush{{names: []string{"graphite.app.a", "graphite.app.b"}}},
+		},
+		{
+			// The rest of an over-long line is dropped with it, and the
+			// reader picks up at the next line
+			name:   "over-long line",
+			writes: []string{"app.a 1\n" + long + "app.b 2\n"},
+			want:   []graphiteFlush{{names: []string{"graphite.app.a", "graphite.app.b"}, bad: 1}},
+		},
+		{
+			name:   "over-long line at the end",
+			writes: []string{"app.a 1\n", long[:len(long)-1]},
+			want: []graphiteFlush{
+				{names: []string{"graphite.app.a"}},
+				{bad: 1},
+			},
+		},
+		{
+			name:   "line of the maximum length",
+			writes: []string{"app.a " + strings.Repeat("0", graphiteMaxLine-len("app.a 1\n")) + "1\n"},
+			want:   []graphiteFlush{{names: []string{"graphite.app.a"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			go func() {
+				for _, w := range tt.writes {
+					client.Write([]byte(w))
+				}
+				client.Close()
+			}()
+
+			var got []graphiteFlush
+			readGraphite(server, func(batch []model.MetricSample, bad int) {
+				f := graphiteFlush{bad: bad}
+				for _, s := range batch {
+					f.names = append(f.names, s.MetricName)
+				}
+				got = append(got, f)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadGraphiteBatchSize(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte(strings.Repeat("app.a 1\n", graphiteBatchSize+5)))
+		client.Close()
+	}()
+	var sizes []int
+	readGraphite(server, func(batch []model.MetricSample, bad int) {
+		sizes = append(sizes, len(batch))
+	})
+	if want := []int{graphiteBatchSize, 5}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("flushed %v, want %v", sizes, want)
+	}
+}
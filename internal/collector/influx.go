@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// InfluxCollectorID is the collector ID of metrics written in InfluxDB line
+// protocol through POST /api/v1/write.
+const InfluxCollectorID = "influx"
+
+// NewInfluxCollector returns the virtual collector that owns metrics written
+// in InfluxDB line protocol.
+func NewInfluxCollector() PushCollector {
+	return newPushedCollector(InfluxCollectorID, "InfluxDB line protocol",
+		"Metrics written in InfluxDB line protocol to POST /api/v1/write (e.g. by Telegraf)")
+}
+
+// influxPrecision converts a timestamp in the given precision to Unix seconds.
+var influxPrecision = map[string]func(int64) int64{
+	"":   func(t int64) int64 { return t / 1e9 },
+	"ns": func(t int64) int64 { return t / 1e9 },
+	"n":  func(t int64) int64 { return t / 1e9 },
+	"us": func(t int64) int64 { return t / 1e6 },
+	"u":  func(t int64) int64 { return t / 1e6 },
+	"ms": func(t int64) int64 { return t / 1e3 },
+	"s":  func(t int64) int64 { return t },
+	"m":  func(t int64) int64 { return t * 60 },
+	"h":  func(t int64) int64 { return t * 3600 },
+}
+
+// ValidInfluxPrecision reports whether p is a supported precision parameter.
+func ValidInfluxPrecision(p string) bool {
+	_, ok := influxPrecision[p]
+	return ok
+}
+
+// ParseInflux parses InfluxDB line protocol. Every numeric field of a point
+// becomes a sample named influx.<measurement>.<field>, with the tags as sorted
+// k=v labels; booleans are stored as 1/0 and string fields are skipped. Points
+// without a timestamp get now.
+//
+//	cpu,host=web1,cpu=cpu0 usage_user=12.5,usage_system=3i 1700000000000000000
+//	→ influx.cpu.usage_user{cpu=cpu0,host=web1} 12.5
+//	  influx.cpu.usage_system{cpu=cpu0,host=web1} 3
+func ParseInflux(body string, precision string, now time.Time) ([]model.MetricSample, error) {
+	conv, ok := influxPrecision[precision]
+	if !ok {
+		return nil, fmt.Errorf("unknown precision %q", precision)
+	}
+	var samples []model.MetricSample
+	for i, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var err error
+		samples, err = parseInfluxLine(samples, line, conv, now)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return samples, nil
+}
+
+func parseInfluxLine(samples []model.MetricSample, line string, conv func(int64) int64, now time.Time) ([]model.MetricSample, error) {
+	sections := splitInflux(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, fmt.Errorf("expected measurement, fields and optional timestamp")
+	}
+
+	key := splitInflux(sections[0], ',', false)
+	measurement := sanitizeMetricName(unescapeInflux(key[0]))
+	if measurement == "" {
+		return nil, fmt.Errorf("missing measurement")
+	}
+	tags := make([]string, 0, len(key)-1)
+	for _, t := range key[1:] {
+		k, v, ok := cutInflux(t)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("bad tag %q", t)
+		}
+		tags = append(tags, unescapeInflux(k)+"="+unescapeInflux(v))
+	}
+	sort.Strings(tags)
+	labels := strings.Join(tags, ",")
+
+	ts := now.Unix()
+	if len(sections) == 3 {
+		t, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad timestamp %q", sections[2])
+		}
+		ts = conv(t)
+	}
+
+	for _, f := range splitInflux(sections[1], ',', true) {
+		k, v, ok := cutInflux(f)
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("bad field %q", f)
+		}
+		value, numeric, err := parseInfluxValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", unescapeInflux(k), err)
+		}
+		if !numeric {
+			continue
+		}
+		field := sanitizeMetricName(unescapeInflux(k))
+		if field == "" {
+			return nil, fmt.Errorf("bad field %q", f)
+		}
+		samples = append(samples, model.MetricSample{
+			Timestamp:  ts,
+			Collector:  InfluxCollectorID,
+			MetricName: "influx." + measurement + "." + field,
+			Value:      value,
+			Labels:     labels,
+		})
+	}
+	return samples, nil
+}
+
+// parseInfluxValue parses a field value. numeric is false for strings.
+func parseInfluxValue(v string) (value float64, numeric bool, err error) {
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+	if v[0] == '"' {
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return 0, false, fmt.Errorf("unterminated string")
+		}
+		return 0, false, nil
+	}
+	if last := v[len(v)-1]; last == 'i' || last == 'u' {
+		n, err := strconv.ParseFloat(v[:len(v)-1], 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return 0, false, fmt.Errorf("bad integer %q", v)
+		}
+		return n, true, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsInf(f, 0) {
+		return 0, false, fmt.Errorf("bad number %q", v)
+	}
+	if math.IsNaN(f) {
+		return 0, false, fmt.Errorf("value is NaN")
+	}
+	return f, true, nil
+}
+
+// splitInflux splits s at unescaped sep characters. With quotes set, sep
+// inside double-quoted string values does not split.
+func splitInflux(s string, sep byte, quotes bool) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quotes:
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			if sep == ' ' && i == start {
+				start = i + 1 // collapse repeated spaces
+				continue
+			}
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// cutInflux splits k=v at the first unescaped '='.
+func cutInflux(s string) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '=':
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\"`, `"`, `\\`, `\`)
+
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return influxUnescaper.Replace(s)
+}
@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+func TestParseInflux(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	sample := func(name string, v float64, ts int64, labels string) model.MetricSample {
+		return model.MetricSample{Timestamp: ts, Collector: InfluxCollectorID, MetricName: name, Value: v, Labels: labels}
+	}
+	tests := []struct {
+		name      string
+		body      string
+		precision string
+		want      []model.MetricSample
+		wantErr   string
+	}{
+		{
+			name: "tags, fields and nanoseconds",
+			body: "cpu,host=web1,cpu=cpu0 usage_user=12.5,usage_system=3i 1699999990000000000",
+			want: []model.MetricSample{
+				sample("influx.cpu.usage_user", 12.5, 1699999990, "cpu=cpu0,host=web1"),
+				sample("influx.cpu.usage_system", 3, 1699999990, "cpu=cpu0,host=web1"),
+			},
+		},
+		{
+			name: "no timestamp and no tags",
+			body: "mem used=1024u",
+			want: []model.MetricSample{sample("influx.mem.used", 1024, 1700000000, "")},
+		},
+		{
+			name: "several lines, comments and blank lines",
+			body: "# written by telegraf\n\na v=1 1699999990000000000\r\n  b v=2 1699999990000000000  \n",
+			want: []model.MetricSample{
+				sample("influx.a.v", 1, 1699999990, ""),
+				sample("influx.b.v", 2, 1699999990, ""),
+			},
+		},
+		{
+			name: "integers and unsigned",
+			body: "m a=-5i,b=7u,c=1e3,d=-0.5",
+			want: []model.MetricSample{
+				sample("influx.m.a", -5, 1700000000, ""),
+				sample("influx.m.b", 7, 1700000000, ""),
+				sample("influx.m.c", 1000, 1700000000, ""),
+				sample("influx.m.d", -0.5, 1700000000, ""),
+			},
+		},
+		{
+			name: "booleans",
+			body: "m a=t,b=T,c=true,d=True,e=TRUE,f=f,g=F,h=false,i=False,j=FALSE",
+			want: []model.MetricSample{
+				sample("influx.m.a", 1, 1700000000, ""), sample("influx.m.b", 1, 1700000000, ""),
+				sample("influx.m.c", 1, 1700000000, ""), sample("influx.m.d", 1, 1700000000, ""),
+				sample("influx.m.e", 1, 1700000000, ""), sample("influx.m.f", 0, 1700000000, ""),
+				sample("influx.m.g", 0, 1700000000, ""), sample("influx.m.h", 0, 1700000000, ""),
+				sample("influx.m.i", 0, 1700000000, ""), sample("influx.m.j", 0, 1700000000, ""),
+			},
+		},
+		{
+			// Spaces and commas in a quoted string do not split the line
+			name: "string fields are skipped",
+			body: `log,app=api msg="GET /x, took 5 ms",code=200i,note="a=b" 1699999990000000000`,
+			want: []model.MetricSample{sample("influx.log.code", 200, 1699999990, "app=api")},
+		},
+		{
+			name: "escaped quote inside a string",
+			body: `log msg="say \"a b\", ok",n=1`,
+			want: []model.MetricSample{sample("influx.log.n", 1, 1700000000, "")},
+		},
+		{
+			name: "escaped spaces, commas and equals signs",
+			body: `disk\ io,mount=/data\ 1,dev=sd\,a,k\=v=x read\ bytes=10,w\,b=2`,
+			want: []model.MetricSample{
+				sample("influx.disk_io.read_bytes", 10, 1700000000, "dev=sd,a,k=v=x,mount=/data 1"),
+				sample("influx.disk_io.w_b", 2, 1700000000, "dev=sd,a,k=v=x,mount=/data 1"),
+			},
+		},
+		{
+			name: "tags are sorted",
+			body: "m,z=1,a=2,m=3 v=1",
+			want: []model.MetricSample{sample("influx.m.v", 1, 1700000000, "a=2,m=3,z=1")},
+		},
+		{name: "seconds", body: "m v=1 1699999990", precision: "s", want: []model.MetricSample{sample("influx.m.v", 1, 1699999990, "")}},
+		{name: "milliseconds", body: "m v=1 1699999990123", precision: "ms", want: []model.MetricSample{sample("influx.m.v", 1, 1699999990, "")}},
+		{name: "microseconds", body: "m v=1 1699999990123456", precision: "us", want: []model.MetricSample{sample("influx.m.v", 1, 1699999990, "")}},
+		{name: "u is microseconds", body: "m v=1 1699999990123456", precision: "u", want: []model.MetricSample{sample("influx.m.v", 1, 1699999990, "")}},
+		{name: "n is nanoseconds", body: "m v=1 1699999990123456789", precision: "n", want: []model.MetricSample{sample("influx.m.v", 1, 1699999990, "")}},
+		{name: "minutes", body: "m v=1 28333333", precision: "m", want: []model.MetricSample{sample("influx.m.v", 1, 1699999980, "")}},
+		{name: "hours", body: "m v=1 472222", precision: "h", want: []model.MetricSample{sample("influx.m.v", 1, 1699999200, "")}},
+
+		{name: "unknown precision", body: "m v=1", precision: "d", wantErr: `unknown precision "d"`},
+		{name: "no fields", body: "m", wantErr: "line 1: expected measurement, fields and optional timestamp"},
+		{name: "too many sections", body: "m v=1 1 2", wantErr: "line 1: expected measurement, fields and optional timestamp"},
+		{name: "empty measurement", body: ",host=a v=1", wantErr: "line 1: missing measurement"},
+		{name: "tag without value", body: "m,host v=1", wantErr: `line 1: bad tag "host"`},
+		{name: "tag without key", body: "m,=a v=1", wantErr: `line 1: bad tag "=a"`},
+		{name: "field without value", body: "m v=", wantErr: `line 1: bad field "v="`},
+		{name: "field without =", body: "m v", wantErr: `line 1: bad field "v"`},
+		{name: "bad number", body: "m v=abc", wantErr: `line 1: field v: bad number "abc"`},
+		{name: "bad integer", body: "m v=1.5x", wantErr: `line 1: field v: bad number "1.5x"`},
+		{name: "empty integer", body: "m v=i", wantErr: `line 1: field v: bad integer "i"`},
+		{name: "infinite", body: "m v=+Inf", wantErr: `line 1: field v: bad number "+Inf"`},
+		{name: "NaN", body: "m v=NaN", wantErr: "line 1: field v: value is NaN"},
+		{name: "NaN integer", body: "m v=NaNi", wantErr: `line 1: field v: bad integer "NaNi"`},
+		{name: "unterminated string", body: `m v="abc`, wantErr: "line 1: field v: unterminated string"},
+		{name: "bad timestamp", body: "m v=1 now", wantErr: `line 1: bad timestamp "now"`},
+		{name: "error on a later line", body: "m v=1\n\nm v=x", wantErr: `line 3: field v: bad number "x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInflux(tt.body, tt.precision, now)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseInflux: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitInflux(t *testing.T) {
+	tests := []struct {
+		in     string
+		sep    byte
+		quotes bool
+		want   []string
+	}{
+		{"a b c", ' ', true, []string{"a", "b", "c"}},
+		{"a   b  c ", ' ', true, []string{"a", "b", "c"}},
+		{`a\ b c`, ' ', true, []string{`a\ b`, "c"}},
+		{`m s="x y" 1`, ' ', true, []string{"m", `s="x y"`, "1"}},
+		{`m s="x y" 1`, ' ', false, []string{"m", `s="x`, `y"`, "1"}},
+		{`s="a,b",n=1`, ',', true, []string{`s="a,b"`, "n=1"}},
+		{`s="a\",b",n=1`, ',', true, []string{`s="a\",b"`, "n=1"}},
+		{`m,k=a\,b,j=c`, ',', false, []string{"m", `k=a\,b`, "j=c"}},
+		{"a,,b", ',', false, []string{"a", "", "b"}},
+		{"a,", ',', false, []string{"a"}},
+		{"", ',', false, nil},
+	}
+	for _, tt := range tests {
+		if got := splitInflux(tt.in, tt.sep, tt.quotes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitInflux(%q, %q, %v) = %q, want %q", tt.in, tt.sep, tt.quotes, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeInflux(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "plain"},
+		{`a\ b`, "a b"},
+		{`a\,b`, "a,b"},
+		{`a\=b`, "a=b"},
+		{`say \"hi\"`, `say "hi"`},
+		{`C:\\temp`, `C:\temp`},
+		{`a\\\ b`, `a\ b`},
+		{`a\b`, `a\b`}, // not an escape
+	}
+	for _, tt := range tests {
+		if got := unescapeInflux(tt.in); got != tt.want {
+			t.Errorf("unescapeInflux(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
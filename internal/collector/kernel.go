@@ -23,7 +23,7 @@ func (c *kernelCollector) Warning() string           { return "" }
 
 func (c *kernelCollector) MetricNames() []string {
 	return []string{
-		"kernel.procs_running", "kernel.procs_blocked", "kernel.goroutines",
+		"kernel.procs_running", "kernel.procs_blocked",
 	}
 }
 
@@ -41,10 +41,5 @@ func (c *kernelCollector) Collect(ctx context.Context) ([]model.MetricSample, er
 		}
 	}
 
-	// On non-linux, we can still report goroutine count as a proxy
-	samples = append(samples,
-		makeSample(now, "kernel", "kernel.goroutines", float64(runtime.NumGoroutine())),
-	)
-
 	return samples, nil
 }
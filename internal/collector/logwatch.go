@@ -0,0 +1,463 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+	"github.com/playok/only1mon/internal/store"
+)
+
+const (
+	// LogWatchCollectorID is the collector ID of the log pattern counter.
+	LogWatchCollectorID = "logwatch"
+	// logWatchMaxRead bounds the bytes read from one file per collection, so
+	// a large backlog is worked off over several runs.
+	logWatchMaxRead = 32 << 20
+	// logWatchMaxLine bounds the length of a line; longer lines are skipped.
+	logWatchMaxLine = 64 << 10
+	// logWatchSaveInterval is how often read offsets are saved to DB.
+	logWatchSaveInterval = 10 * time.Second
+)
+
+// logWatchOptions are the configurable options of the logwatch collector.
+type logWatchOptions struct {
+	Files []logFileOptions `json:"files"`
+}
+
+// logFileOptions configures one watched file.
+type logFileOptions struct {
+	Path     string              `json:"path"`
+	Patterns []logPatternOptions `json:"patterns"`
+}
+
+// logPatternOptions configures one named pattern of a file.
+type logPatternOptions struct {
+	// Name names the pattern in metric names: log.<name>.<metric>.
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
+	// ValueGroup is the name or number of a capture group holding a number
+	// (e.g. a response time) to report as avg and max.
+	ValueGroup string `json:"value_group"`
+}
+
+// logPattern is a compiled pattern.
+type logPattern struct {
+	name  string
+	re    *regexp.Regexp
+	group int // capture group index of the value, 0 = none
+}
+
+// logFile is a watched file with its compiled patterns.
+type logFile struct {
+	path     string
+	patterns []logPattern
+}
+
+// logTail is the read state of a file. It is only used by Collect.
+type logTail struct {
+	f        *os.File
+	inode    uint64
+	offset   int64             // end of the last complete line read
+	partial  []byte            // incomplete last line, read past offset
+	skipping bool              // dropping the rest of an over-long line
+	seen     bool              // watched in an earlier collection
+	matches  map[string]uint64 // cumulative matches by pattern name
+	lastErr  string
+}
+
+// logCounts aggregates the matches of one pattern in a collection.
+type logCounts struct {
+	matches float64
+	values  int
+	sum     float64
+	max     float64
+}
+
+// logWatchCollector tails log files and counts lines matching named
+// patterns. Every pattern reports log.<name>.matches_per_sec; with a
+// value_group it also reports log.<name>.value_avg and log.<name>.value_max
+// over the matches of the interval. Rotation is followed by inode: the rest
+// of the old file is read before switching to the new one. Read offsets are
+// saved to DB, so lines written while only1mon was stopped are counted on
+// the next start.
+type logWatchCollector struct {
+	store *store.Store
+
+	mu    sync.Mutex
+	opts  logWatchOptions
+	files []logFile
+	names map[string]bool
+
+	// Only used by Collect
+	tails    map[string]*logTail
+	rates    *counterTracker[string, uint64] // keyed by "<path>\x00<pattern>"
+	saved    map[string]store.LogOffset
+	loaded   bool
+	lastSave time.Time
+}
+
+func NewLogWatchCollector(s *store.Store) Collector {
+	return &logWatchCollector{
+		store: s,
+		names: make(map[string]bool),
+		tails: make(map[string]*logTail),
+		rates: newCounterTracker[string, uint64](),
+	}
+}
+
+func (c *logWatchCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"files": {Type: "array", Description: "Log files to tail",
+			Items: &ConfigProperty{Type: "object", Properties: map[string]ConfigProperty{
+				"path": {Type: "string", Description: "Absolute path of the log file"},
+				"patterns": {Type: "array", Description: "Named patterns counted in the file",
+					Items: &ConfigProperty{Type: "object", Properties: map[string]ConfigProperty{
+						"name":        {Type: "string", Description: "Pattern name used in metric names (lowercase letters, digits, '_' or '-')"},
+						"regex":       {Type: "string", Description: "Regular expression matched against each line"},
+						"value_group": {Type: "string", Description: "Name or number of a capture group holding a number to report as avg/max"},
+					}}},
+			}}},
+	})
+}
+
+func (c *logWatchCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *logWatchCollector) ApplyConfig(raw json.RawMessage) error {
+	var opts logWatchOptions
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	paths := make(map[string]bool)
+	names := make(map[string]bool)
+	files := make([]logFile, 0, len(opts.Files))
+	for i, fo := range opts.Files {
+		if fo.Path == "" {
+			return fmt.Errorf("files[%d]: path is required", i)
+		}
+		if paths[fo.Path] {
+			return fmt.Errorf("files[%d]: duplicate path %q", i, fo.Path)
+		}
+		paths[fo.Path] = true
+		f := logFile{path: fo.Path}
+		for j, po := range fo.Patterns {
+			at := fmt.Sprintf("files[%d].patterns[%d]", i, j)
+			if !probeNameRe.MatchString(po.Name) {
+				return fmt.Errorf("%s: name must be lowercase letters, digits, '_' or '-'", at)
+			}
+			if names[po.Name] {
+				return fmt.Errorf("%s: duplicate name %q", at, po.Name)
+			}
+			names[po.Name] = true
+			re, err := regexp.Compile(po.Regex)
+			if err != nil || po.Regex == "" {
+				return fmt.Errorf("%s: invalid regex %q", at, po.Regex)
+			}
+			p := logPattern{name: po.Name, re: re}
+			if po.ValueGroup != "" {
+				p.group = re.SubexpIndex(po.ValueGroup)
+				if n, err := strconv.Atoi(po.ValueGroup); err == nil {
+					p.group = n
+				}
+				if p.group <= 0 || p.group > re.NumSubexp() {
+					return fmt.Errorf("%s: regex has no capture group %q", at, po.ValueGroup)
+				}
+			}
+			f.patterns = append(f.patterns, p)
+		}
+		files = append(files, f)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts = opts
+	c.files = files
+	return nil
+}
+
+func (c *logWatchCollector) ID() string   { return LogWatchCollectorID }
+func (c *logWatchCollector) Name() string { return "Log Watch" }
+func (c *logWatchCollector) Description() string {
+	return "Counts log lines matching named patterns, following rotation"
+}
+func (c *logWatchCollector) Impact() model.ImpactLevel { return model.ImpactLow }
+func (c *logWatchCollector) Warning() string {
+	return "Busy logs with many patterns cost CPU to match every line"
+}
+
+func (c *logWatchCollector) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.names) == 0 {
+		return []string{"log.*.matches_per_sec"}
+	}
+	names := make([]string, 0, len(c.names))
+	for n := range c.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *logWatchCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	c.mu.Lock()
+	files := c.files
+	c.mu.Unlock()
+
+	if !c.loaded {
+		c.loaded = true
+		if c.store != nil {
+			saved, err := c.store.GetLogOffsets()
+			if err != nil {
+				log.Printf("[logwatch] failed to load offsets: %v", err)
+			}
+			c.saved = saved
+		}
+		c.primeRates(files)
+	}
+
+	now := time.Now()
+	ts := now.Unix()
+	c.rates.begin(ts)
+	var samples []model.MetricSample
+	watched := make(map[string]bool)
+	for _, f := range files {
+		watched[f.path] = true
+		t := c.tails[f.path]
+		if t == nil {
+			t = &logTail{matches: make(map[string]uint64)}
+			c.tails[f.path] = t
+		}
+		counts := make([]logCounts, len(f.patterns))
+		err := c.read(f, t, counts)
+		if err != nil {
+			if msg := err.Error(); msg != t.lastErr {
+				log.Printf("[logwatch] %s: %v", f.path, err)
+				t.lastErr = msg
+			}
+		} else if t.lastErr != "" {
+			log.Printf("[logwatch] %s: reading again", f.path)
+			t.lastErr = ""
+		}
+
+		t.seen = true
+		for i, p := range f.patterns {
+			// The count is tracked while the file is missing, so lines of a
+			// file created meanwhile are rated against the last collection
+			t.matches[p.name] += uint64(counts[i].matches)
+			r, ok := c.rates.rate(f.path+"\x00"+p.name, t.matches[p.name])
+			if t.f == nil || !ok {
+				continue
+			}
+			base := "log." + p.name
+			samples = append(samples, makeSample(ts, LogWatchCollectorID, base+".matches_per_sec", r))
+			if p.group > 0 && counts[i].values > 0 {
+				samples = append(samples,
+					makeSample(ts, LogWatchCollectorID, base+".value_avg", counts[i].sum/float64(counts[i].values)),
+					makeSample(ts, LogWatchCollectorID, base+".value_max", counts[i].max))
+			}
+		}
+	}
+
+	// Stop tailing files that were removed from the config
+	for path, t := range c.tails {
+		if !watched[path] {
+			if t.f != nil {
+				t.f.Close()
+			}
+			delete(c.tails, path)
+		}
+	}
+	c.rates.commit()
+	if now.Sub(c.lastSave) >= logWatchSaveInterval {
+		c.lastSave = now
+		c.saveOffsets(now)
+	}
+
+	c.mu.Lock()
+	for _, s := range samples {
+		c.names[s.MetricName] = true
+	}
+	c.mu.Unlock()
+	return samples, nil
+}
+
+// read opens or reopens the file as needed and matches the lines written
+// since the last read.
+func (c *logWatchCollector) read(f logFile, t *logTail, counts []logCounts) error {
+	fi, statErr := os.Stat(f.path)
+	if t.f != nil {
+		cur, err := t.f.Stat()
+		switch {
+		case err != nil:
+			return err
+		case statErr == nil && !os.SameFile(cur, fi):
+			// Rotated: finish the old file, then switch to the new one
+			if err := c.readLines(f, t, counts); err != nil {
+				return err
+			}
+			t.f.Close()
+			t.f = nil
+		case cur.Size() < t.offset+int64(len(t.partial)):
+			// Truncated in place (copytruncate)
+			if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			t.offset, t.partial, t.skipping = 0, nil, false
+		}
+	}
+	if t.f == nil {
+		if statErr != nil {
+			// Read the file from its start once it is created
+			return statErr
+		}
+		fh, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		t.f = fh
+		t.inode = fileInode(fi)
+		t.partial, t.skipping = nil, false
+		// The first read of a file without a saved offset only finds its end
+		start := fi.Size()
+		if t.seen {
+			// A rotated or newly created file is read from its start
+			start = 0
+		} else if o, ok := c.saved[f.path]; ok {
+			// Resume after a restart; lines of a file rotated meanwhile are lost
+			start = 0
+			if o.Inode == t.inode && o.Offset <= fi.Size() {
+				start = o.Offset
+			}
+		}
+		if _, err := fh.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset = start
+	}
+	return c.readLines(f, t, counts)
+}
+
+// primeRates makes the time offsets were last saved the baseline of the
+// match counts of resumed files, so the lines written while only1mon was
+// stopped are rated over the downtime.
+func (c *logWatchCollector) primeRates(files []logFile) {
+	var updated int64
+	for _, o := range c.saved {
+		updated = max(updated, o.Updated)
+	}
+	if updated == 0 {
+		return
+	}
+	c.rates.begin(updated)
+	for _, f := range files {
+		if _, ok := c.saved[f.path]; ok {
+			for _, p := range f.patterns {
+				c.rates.rate(f.path+"\x00"+p.name, 0)
+			}
+		}
+	}
+	c.rates.commit()
+}
+
+// readLines reads up to logWatchMaxRead bytes from the current position and
+// matches every complete line.
+func (c *logWatchCollector) readLines(f logFile, t *logTail, counts []logCounts) error {
+	buf := make([]byte, 256<<10)
+	var total int
+	for total < logWatchMaxRead {
+		n, err := t.f.Read(buf)
+		total += n
+		data := buf[:n]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				if !t.skipping {
+					t.partial = append(t.partial, data...)
+					if len(t.partial) > logWatchMaxLine {
+						t.offset += int64(len(t.partial))
+						t.partial, t.skipping = nil, true
+					}
+				} else {
+					t.offset += int64(len(data))
+				}
+				break
+			}
+			line := data[:i]
+			if len(t.partial) > 0 {
+				line = append(t.partial, line...)
+			}
+			if !t.skipping && len(line) <= logWatchMaxLine {
+				matchLine(f.patterns, line, counts)
+			}
+			t.offset += int64(len(t.partial) + i + 1)
+			t.partial, t.skipping = nil, false
+			data = data[i+1:]
+		}
+		if err == io.EOF || n == 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchLine(patterns []logPattern, line []byte, counts []logCounts) {
+	for i, p := range patterns {
+		if p.group == 0 {
+			if p.re.Match(line) {
+				counts[i].matches++
+			}
+			continue
+		}
+		m := p.re.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		counts[i].matches++
+		v, err := strconv.ParseFloat(string(m[p.group]), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		if counts[i].values == 0 || v > counts[i].max {
+			counts[i].max = v
+		}
+		counts[i].values++
+		counts[i].sum += v
+	}
+}
+
+// saveOffsets saves the offsets of the open files.
+func (c *logWatchCollector) saveOffsets(now time.Time) {
+	if c.store == nil {
+		return
+	}
+	offsets := make(map[string]store.LogOffset, len(c.tails))
+	for path, t := range c.tails {
+		if t.f != nil {
+			offsets[path] = store.LogOffset{Inode: t.inode, Offset: t.offset, Updated: now.Unix()}
+		}
+	}
+	if err := c.store.SaveLogOffsets(offsets); err != nil {
+		log.Printf("[logwatch] failed to save offsets: %v", err)
+		return
+	}
+	c.saved = offsets
+}
@@ -0,0 +1,297 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/playok/only1mon/internal/store"
+)
+
+// newTestLogWatch watches path for ERROR lines ("err") and "took <n>ms"
+// lines ("lat", reporting n).
+func newTestLogWatch(t *testing.T, s *store.Store, path string) *logWatchCollector {
+	t.Helper()
+	c := NewLogWatchCollector(s).(*logWatchCollector)
+	raw, _ := json.Marshal(logWatchOptions{Files: []logFileOptions{{Path: path, Patterns: []logPatternOptions{
+		{Name: "err", Regex: `ERROR`},
+		{Name: "lat", Regex: `took (?P<ms>[0-9.]+)ms`, ValueGroup: "ms"},
+	}}}})
+	if err := c.ApplyConfig(raw); err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	return c
+}
+
+// readOnce reads f as one collection does and returns the counts.
+func readOnce(c *logWatchCollector, f logFile, t *logTail) ([]logCounts, error) {
+	counts := make([]logCounts, len(f.patterns))
+	err := c.read(f, t, counts)
+	t.seen = true
+	return counts, err
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	if _, err := fh.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogWatchRead(t *testing.T) {
+	long := "ERROR " + strings.Repeat("x", logWatchMaxLine) + "\n"
+	type step struct {
+		do         func(t *testing.T, path string)
+		want       []logCounts // err, lat
+		wantOffset int64
+		wantErr    bool
+	}
+	write := func(data string) func(*testing.T, string) {
+		return func(t *testing.T, path string) { appendFile(t, path, data) }
+	}
+	tests := []struct {
+		name    string
+		initial string // content before the first read, which is skipped
+		missing bool   // the file does not exist at the first read
+		steps   []step
+	}{
+		{
+			name:    "appended lines",
+			initial: "ERROR before start\n",
+			steps: []step{
+				{do: write("ERROR one\nok took 12ms\nERROR took 30.5ms\n"),
+					want:       []logCounts{{matches: 2}, {matches: 2, values: 2, sum: 42.5, max: 30.5}},
+					wantOffset: 19 + 41},
+				{want: []logCounts{{}, {}}, wantOffset: 60},
+				{do: write("took abc ms\ntook 1.2.3ms\nINFO\n"),
+					// 1.2.3 matches but is not a number
+					want:       []logCounts{{}, {matches: 1}},
+					wantOffset: 60 + 30},
+			},
+		},
+		{
+			name: "partial line",
+			steps: []step{
+				{do: write("ERROR first\nERROR sec"),
+					want: []logCounts{{matches: 1}, {}}, wantOffset: 12},
+				{do: write("ond took 5ms"),
+					want: []logCounts{{}, {}}, wantOffset: 12},
+				{do: write("\n"),
+					want: []logCounts{{matches: 1}, {matches: 1, values: 1, sum: 5, max: 5}}, wantOffset: 12 + 22},
+			},
+		},
+		{
+			name: "over-long line",
+			steps: []step{
+				{do: write("ERROR a\n" + long + "ERROR b\n"),
+					want: []logCounts{{matches: 2}, {}}, wantOffset: int64(16 + len(long))},
+				// An over-long line across reads is dropped through its newline
+				{do: write(long[:logWatchMaxLine/2]),
+					want: []logCounts{{}, {}}, wantOffset: int64(16 + len(long))},
+				{do: write(long[logWatchMaxLine/2 : len(long)-1]),
+					want: []logCounts{{}, {}}, wantOffset: int64(16 + 2*len(long) - 1)},
+				{do: write("\nERROR c\n"),
+					want: []logCounts{{matches: 1}, {}}, wantOffset: int64(16 + 2*len(long) + 8)},
+			},
+		},
+		{
+			name:    "rotation",
+			initial: "ERROR old\n",
+			steps: []step{
+				{do: write("ERROR one\n"), want: []logCounts{{matches: 1}, {}}, wantOffset: 20},
+				// Lines written to the old file before the switch are read
+				// before the new file, which is read from its start
+				{do: func(t *testing.T, path string) {
+					appendFile(t, path, "ERROR late\n")
+					if err := os.Rename(path, path+".1"); err != nil {
+						t.Fatal(err)
+					}
+					appendFile(t, path, "ERROR new\ntook 7ms\n")
+				}, want: []logCounts{{matches: 2}, {matches: 1, values: 1, sum: 7, max: 7}}, wantOffset: 19},
+				{do: write("ERROR again\n"), want: []logCounts{{matches: 1}, {}}, wantOffset: 31},
+			},
+		},
+		{
+			name:    "copytruncate",
+			initial: "ERROR old\nERROR old\n",
+			steps: []step{
+				{do: write("ERROR one\n"), want: []logCounts{{matches: 1}, {}}, wantOffset: 30},
+				{do: func(t *testing.T, path string) {
+					if err := os.Truncate(path, 0); err != nil {
+						t.Fatal(err)
+					}
+					appendFile(t, path, "ERROR new\n")
+				}, want: []logCounts{{matches: 1}, {}}, wantOffset: 10},
+				{do: write("ERROR two\n"), want: []logCounts{{matches: 1}, {}}, wantOffset: 20},
+			},
+		},
+		{
+			name:    "truncated while a line is partial",
+			initial: "",
+			steps: []step{
+				{do: write("ERROR one\nERROR part"), want: []logCounts{{matches: 1}, {}}, wantOffset: 10},
+				{do: func(t *testing.T, path string) {
+					if err := os.Truncate(path, 0); err != nil {
+						t.Fatal(err)
+					}
+					appendFile(t, path, "ERROR x\n")
+				}, want: []logCounts{{matches: 1}, {}}, wantOffset: 8},
+			},
+		},
+		{
+			// A file created after the first read is read from its start
+			name:    "file created later",
+			missing: true,
+			steps: []step{
+				{want: []logCounts{{}, {}}, wantErr: true},
+				{do: write("ERROR one\n"), want: []logCounts{{matches: 1}, {}}, wantOffset: 10},
+			},
+		},
+		{
+			// A deleted file is kept open until it is recreated
+			name: "deleted and recreated",
+			steps: []step{
+				{do: write("ERROR one\n"), want: []logCounts{{matches: 1}, {}}, wantOffset: 10},
+				{do: func(t *testing.T, path string) { os.Remove(path) }, want: []logCounts{{}, {}}, wantOffset: 10},
+				{do: write("ERROR two\nERROR three\n"), want: []logCounts{{matches: 2}, {}}, wantOffset: 22},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.log")
+			if !tt.missing {
+				appendFile(t, path, tt.initial)
+			}
+			c := newTestLogWatch(t, nil, path)
+			f := c.files[0]
+			tail := &logTail{matches: make(map[string]uint64)}
+			defer func() {
+				if tail.f != nil {
+					tail.f.Close()
+				}
+			}()
+			if _, err := readOnce(c, f, tail); (err != nil) != tt.missing {
+				t.Fatalf("first read: %v", err)
+			}
+			if tail.offset != int64(len(tt.initial)) {
+				t.Fatalf("first read: offset = %d, want the end %d", tail.offset, len(tt.initial))
+			}
+			for i, st := range tt.steps {
+				if st.do != nil {
+					st.do(t, path)
+				}
+				counts, err := readOnce(c, f, tail)
+				if (err != nil) != st.wantErr {
+					t.Fatalf("step %d: err = %v, want error %v", i, err, st.wantErr)
+				}
+				if !reflect.DeepEqual(counts, st.want) {
+					t.Errorf("step %d: counts = %+v, want %+v", i, counts, st.want)
+				}
+				if !st.wantErr && tail.offset != st.wantOffset {
+					t.Errorf("step %d: offset = %d, want %d", i, tail.offset, st.wantOffset)
+				}
+			}
+		})
+	}
+}
+
+func TestLogWatchResume(t *testing.T) {
+	db, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "ERROR before\n")
+
+	stop := func(c *logWatchCollector) {
+		for _, tail := range c.tails {
+			if tail.f != nil {
+				tail.f.Close()
+			}
+		}
+	}
+	collect := func(c *logWatchCollector) {
+		t.Helper()
+		if _, err := c.Collect(context.Background()); err != nil {
+			t.Fatalf("Collect: %v", err)
+		}
+	}
+
+	// The first run starts at the end and saves its offset
+	c := newTestLogWatch(t, db, path)
+	collect(c)
+	stop(c)
+
+	tests := []struct {
+		name        string
+		change      func(t *testing.T)
+		wantMatches uint64
+		wantOffset  int64
+	}{
+		{
+			// Lines written while stopped are counted after a restart
+			name:        "lines written while stopped",
+			change:      func(t *testing.T) { appendFile(t, path, "ERROR a\nERROR b\nINFO\n") },
+			wantMatches: 2,
+			wantOffset:  13 + 21,
+		},
+		{
+			name:       "nothing new",
+			wantOffset: 34,
+		},
+		{
+			// A file rotated while stopped is read from its start; the
+			// rest of the old file is lost
+			name: "rotated while stopped",
+			change: func(t *testing.T) {
+				appendFile(t, path, "ERROR lost\n")
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path, "ERROR new\n")
+			},
+			wantMatches: 1,
+			wantOffset:  10,
+		},
+		{
+			// A saved offset beyond the end of the same file (truncated
+			// while stopped) restarts from the beginning
+			name: "truncated while stopped",
+			change: func(t *testing.T) {
+				if err := os.Truncate(path, 0); err != nil {
+					t.Fatal(err)
+				}
+				appendFile(t, path, "x\n")
+			},
+			wantMatches: 0,
+			wantOffset:  2,
+		},
+	}
+	for _, tt := range tests {
+		if tt.change != nil {
+			tt.change(t)
+		}
+		c := newTestLogWatch(t, db, path)
+		collect(c)
+		tail := c.tails[path]
+		if got := tail.matches["err"]; got != tt.wantMatches {
+			t.Errorf("%s: matches = %d, want %d", tt.name, got, tt.wantMatches)
+		}
+		if tail.offset != tt.wantOffset {
+			t.Errorf("%s: offset = %d, want %d", tt.name, tail.offset, tt.wantOffset)
+		}
+		stop(c)
+	}
+}
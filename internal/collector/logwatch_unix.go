@@ -0,0 +1,16 @@
+//go:build !windows
+
+package collector
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode of a file, which changes when a log is rotated.
+func fileInode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package collector
+
+import "os"
+
+// fileInode returns 0: Windows has no inodes, so rotation is only detected
+// when the file shrinks.
+func fileInode(fi os.FileInfo) uint64 { return 0 }
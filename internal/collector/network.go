@@ -3,11 +3,13 @@ package collector
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/playok/only1mon/internal/model"
@@ -15,18 +17,58 @@ import (
 )
 
 type networkCollector struct {
-	prevTime     int64
-	prevCounters map[string]net.IOCountersStat // keyed by interface name
+	procRoot string                          // "/proc"; a fixture directory in tests
+	rates    *counterTracker[string, uint64] // keyed by "<iface>.<counter>"
+	mu       sync.Mutex                      // guards opts
+	opts     networkOptions
 }
 
-func NewNetworkCollector() Collector { return &networkCollector{} }
+// networkOptions are the configurable options of the network collector.
+type networkOptions struct {
+	IgnoreInterfaces []string `json:"ignore_interfaces"` // glob patterns, e.g. "veth*"
+}
+
+func NewNetworkCollector() Collector { return newNetworkCollector("/proc") }
+
+func newNetworkCollector(procRoot string) *networkCollector {
+	return &networkCollector{procRoot: procRoot, rates: newCounterTracker[string, uint64]()}
+}
 
 func (c *networkCollector) ID() string          { return "network" }
 func (c *networkCollector) Name() string        { return "Network" }
-func (c *networkCollector) Description() string { return "Network interface stats, TCP connection states" }
+func (c *networkCollector) Description() string {
+	return "Network interface stats, TCP connection states, conntrack and socket memory"
+}
 func (c *networkCollector) Impact() model.ImpactLevel { return model.ImpactLow }
 func (c *networkCollector) Warning() string     { return "May have slight overhead with many connections" }
 
+func (c *networkCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"ignore_interfaces": {Type: "array", Items: &ConfigProperty{Type: "string"},
+			Description: "Interface name patterns to skip, including from totals (e.g. \"lo\", \"veth*\")"},
+	})
+}
+
+func (c *networkCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *networkCollector) ApplyConfig(raw json.RawMessage) error {
+	var opts networkOptions
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	if err := validGlobs("ignore_interfaces", opts.IgnoreInterfaces); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.opts = opts
+	c.mu.Unlock()
+	return nil
+}
+
 func (c *networkCollector) MetricNames() []string {
 	return []string{
 		"net.total.bytes_sent", "net.total.bytes_recv",
@@ -43,6 +85,12 @@ func (c *networkCollector) MetricNames() []string {
 		"net.tcp.retransmits",
 		"net.tcp.tx_queue_total", "net.tcp.rx_queue_total",
 		"net.tcp.tx_queue_max", "net.tcp.rx_queue_max",
+		"net.conntrack.count", "net.conntrack.max", "net.conntrack.used_pct",
+		"net.conntrack.drop", "net.conntrack.insert_failed", "net.conntrack.early_drop",
+		"net.sockstat.sockets_used",
+		"net.sockstat.tcp_inuse", "net.sockstat.tcp_orphan", "net.sockstat.tcp_tw",
+		"net.sockstat.tcp_alloc", "net.sockstat.tcp_mem",
+		"net.sockstat.udp_inuse", "net.sockstat.udp_mem",
 	}
 }
 
@@ -50,19 +98,30 @@ func (c *networkCollector) Collect(ctx context.Context) ([]model.MetricSample, e
 	now := time.Now().Unix()
 	var samples []model.MetricSample
 
+	c.mu.Lock()
+	opts := c.opts
+	c.mu.Unlock()
+
 	// Per-interface counters + total aggregation
 	counters, err := net.IOCountersWithContext(ctx, true)
 	if err == nil {
-		curMap := make(map[string]net.IOCountersStat, len(counters))
+		c.rates.begin(now)
 
 		var totalBytesSent, totalBytesRecv uint64
 		var totalPktsSent, totalPktsRecv uint64
 		var totalErrin, totalErrout uint64
 		var totalDropin, totalDropout uint64
 
+		// Total rates are the sum of per-interface rates, so interfaces that
+		// appeared, vanished or reset since the last cycle don't skew them.
+		var totalRates [4]float64
+		haveTotalRates := false
+
 		for _, io := range counters {
 			iface := io.Name
-			curMap[iface] = io
+			if matchAny(opts.IgnoreInterfaces, iface) {
+				continue
+			}
 
 			// Cumulative counters
 			samples = append(samples,
@@ -77,17 +136,21 @@ func (c *networkCollector) Collect(ctx context.Context) ([]model.MetricSample, e
 			)
 
 			// Per-interface rate (delta / elapsed seconds)
-			if c.prevCounters != nil && c.prevTime > 0 {
-				elapsed := float64(now - c.prevTime)
-				if elapsed > 0 {
-					if prev, ok := c.prevCounters[iface]; ok {
-						samples = append(samples,
-							makeSample(now, "network", fmt.Sprintf("net.%s.bytes_sent_sec", iface), float64(io.BytesSent-prev.BytesSent)/elapsed),
-							makeSample(now, "network", fmt.Sprintf("net.%s.bytes_recv_sec", iface), float64(io.BytesRecv-prev.BytesRecv)/elapsed),
-							makeSample(now, "network", fmt.Sprintf("net.%s.packets_sent_sec", iface), float64(io.PacketsSent-prev.PacketsSent)/elapsed),
-							makeSample(now, "network", fmt.Sprintf("net.%s.packets_recv_sec", iface), float64(io.PacketsRecv-prev.PacketsRecv)/elapsed),
-						)
-					}
+			for i, rc := range []struct {
+				name  string
+				value uint64
+			}{
+				{"bytes_sent", io.BytesSent},
+				{"bytes_recv", io.BytesRecv},
+				{"packets_sent", io.PacketsSent},
+				{"packets_recv", io.PacketsRecv},
+			} {
+				if r, ok := c.rates.rate(iface+"."+rc.name, rc.value); ok {
+					samples = append(samples,
+						makeSample(now, "network", fmt.Sprintf("net.%s.%s_sec", iface, rc.name), r),
+					)
+					totalRates[i] += r
+					haveTotalRates = true
 				}
 			}
 
@@ -114,29 +177,16 @@ func (c *networkCollector) Collect(ctx context.Context) ([]model.MetricSample, e
 		)
 
 		// System-wide rate totals
-		if c.prevCounters != nil && c.prevTime > 0 {
-			elapsed := float64(now - c.prevTime)
-			if elapsed > 0 {
-				// Sum previous totals
-				var prevBytesSent, prevBytesRecv uint64
-				var prevPktsSent, prevPktsRecv uint64
-				for _, prev := range c.prevCounters {
-					prevBytesSent += prev.BytesSent
-					prevBytesRecv += prev.BytesRecv
-					prevPktsSent += prev.PacketsSent
-					prevPktsRecv += prev.PacketsRecv
-				}
-				samples = append(samples,
-					makeSample(now, "network", "net.total.bytes_sent_sec", float64(totalBytesSent-prevBytesSent)/elapsed),
-					makeSample(now, "network", "net.total.bytes_recv_sec", float64(totalBytesRecv-prevBytesRecv)/elapsed),
-					makeSample(now, "network", "net.total.packets_sent_sec", float64(totalPktsSent-prevPktsSent)/elapsed),
-					makeSample(now, "network", "net.total.packets_recv_sec", float64(totalPktsRecv-prevPktsRecv)/elapsed),
-				)
-			}
+		if haveTotalRates {
+			samples = append(samples,
+				makeSample(now, "network", "net.total.bytes_sent_sec", totalRates[0]),
+				makeSample(now, "network", "net.total.bytes_recv_sec", totalRates[1]),
+				makeSample(now, "network", "net.total.packets_sent_sec", totalRates[2]),
+				makeSample(now, "network", "net.total.packets_recv_sec", totalRates[3]),
+			)
 		}
 
-		c.prevCounters = curMap
-		c.prevTime = now
+		c.rates.commit()
 	}
 
 	// TCP connection states
@@ -182,6 +232,40 @@ func (c *networkCollector) Collect(ctx context.Context) ([]model.MetricSample, e
 			makeSample(now, "network", "net.tcp.tx_queue_max", float64(txMax)),
 			makeSample(now, "network", "net.tcp.rx_queue_max", float64(rxMax)),
 		)
+
+		// Netfilter connection tracking table (only when nf_conntrack is loaded)
+		if ct, ok := readConntrack(c.procRoot); ok {
+			usedPct := 0.0
+			if ct.max > 0 {
+				usedPct = float64(ct.count) / float64(ct.max) * 100
+			}
+			samples = append(samples,
+				makeSample(now, "network", "net.conntrack.count", float64(ct.count)),
+				makeSample(now, "network", "net.conntrack.max", float64(ct.max)),
+				makeSample(now, "network", "net.conntrack.used_pct", usedPct),
+			)
+			if ct.hasStats {
+				samples = append(samples,
+					makeSample(now, "network", "net.conntrack.drop", float64(ct.drop)),
+					makeSample(now, "network", "net.conntrack.insert_failed", float64(ct.insertFailed)),
+					makeSample(now, "network", "net.conntrack.early_drop", float64(ct.earlyDrop)),
+				)
+			}
+		}
+
+		// Socket counts and buffer memory
+		if ss, ok := readSockstat(c.procRoot); ok {
+			samples = append(samples,
+				makeSample(now, "network", "net.sockstat.sockets_used", float64(ss.socketsUsed)),
+				makeSample(now, "network", "net.sockstat.tcp_inuse", float64(ss.tcpInuse)),
+				makeSample(now, "network", "net.sockstat.tcp_orphan", float64(ss.tcpOrphan)),
+				makeSample(now, "network", "net.sockstat.tcp_tw", float64(ss.tcpTW)),
+				makeSample(now, "network", "net.sockstat.tcp_alloc", float64(ss.tcpAlloc)),
+				makeSample(now, "network", "net.sockstat.tcp_mem", float64(ss.tcpMem)),
+				makeSample(now, "network", "net.sockstat.udp_inuse", float64(ss.udpInuse)),
+				makeSample(now, "network", "net.sockstat.udp_mem", float64(ss.udpMem)),
+			)
+		}
 	}
 
 	return samples, nil
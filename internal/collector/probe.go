@@ -0,0 +1,399 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+const (
+	// ProbeCollectorID is the collector ID of the synthetic probes.
+	ProbeCollectorID = "probe"
+	// probeMaxBody bounds the response body read for body_regex.
+	probeMaxBody = 1 << 20
+)
+
+// probeNameRe matches probe names.
+var probeNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// probeOptions are the configurable options of the probe collector.
+type probeOptions struct {
+	Probes []probeTargetOptions `json:"probes"`
+}
+
+// probeTargetOptions configures one probe.
+type probeTargetOptions struct {
+	// Name names the probe in metric names: probe.<name>.<metric>.
+	Name string `json:"name"`
+	// Type is "http" or "tcp".
+	Type string `json:"type"`
+	// URL is the http(s) URL of an http probe.
+	URL string `json:"url"`
+	// Address is the host:port of a tcp probe.
+	Address string `json:"address"`
+	// Method is the HTTP method (default GET).
+	Method string `json:"method"`
+	// ExpectStatus lists the accepted status codes (empty = any 2xx).
+	ExpectStatus []int `json:"expect_status"`
+	// BodyRegex must match the response body when set.
+	BodyRegex string `json:"body_regex"`
+	// NoFollowRedirects checks the first response instead of following
+	// redirects.
+	NoFollowRedirects bool `json:"no_follow_redirects"`
+	// InsecureSkipVerify accepts any certificate; its expiry is still reported.
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// Timeout of one check in seconds.
+	Timeout int `json:"timeout"`
+	// Interval is the least time between checks in seconds; 0 checks on
+	// every run of the collector.
+	Interval int `json:"interval"`
+}
+
+// probeTarget is a probe and its check state. lastCheck is guarded by the
+// collector's mutex; lastErr is only used by the check.
+type probeTarget struct {
+	opts      probeTargetOptions
+	bodyRe    *regexp.Regexp
+	lastCheck time.Time
+	lastErr   string
+}
+
+// probeCollector runs blackbox HTTP and TCP checks. Every probe reports
+// probe.<name>.up (1/0) and probe.<name>.duration_ms; HTTP probes also report
+// status_code, and for https tls_handshake_ms and cert_expiry_days (negative
+// once the certificate has expired).
+type probeCollector struct {
+	// transport and insecure are used for probes without and with
+	// insecure_skip_verify. Keep-alives are off so every check measures a
+	// fresh connect and TLS handshake.
+	transport *http.Transport
+	insecure  *http.Transport
+	dialer    *net.Dialer
+
+	mu      sync.Mutex
+	opts    probeOptions
+	targets []*probeTarget
+	names   map[string]bool
+}
+
+func NewProbeCollector() Collector {
+	return &probeCollector{
+		transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true},
+		insecure: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		dialer: &net.Dialer{},
+		names:  make(map[string]bool),
+	}
+}
+
+func (c *probeCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"probes": {Type: "array", Description: "HTTP and TCP checks",
+			Items: &ConfigProperty{Type: "object", Properties: map[string]ConfigProperty{
+				"name":                 {Type: "string", Description: "Probe name used in metric names (lowercase letters, digits, '_' or '-')"},
+				"type":                 {Type: "string", Description: "Check type", Default: "http", Enum: []string{"http", "tcp"}},
+				"url":                  {Type: "string", Description: "URL of an http probe"},
+				"address":              {Type: "string", Description: "host:port of a tcp probe"},
+				"method":               {Type: "string", Description: "HTTP method", Default: "GET", Enum: []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"}},
+				"expect_status":        {Type: "array", Items: &ConfigProperty{Type: "integer", Minimum: bound(100), Maximum: bound(599)}, Description: "Accepted status codes (empty = any 2xx)"},
+				"body_regex":           {Type: "string", Description: "Regular expression the response body must match"},
+				"no_follow_redirects":  {Type: "boolean", Description: "Check the first response instead of following redirects", Default: false},
+				"insecure_skip_verify": {Type: "boolean", Description: "Accept invalid certificates", Default: false},
+				"timeout":              {Type: "integer", Description: "Seconds before a check fails", Default: 5, Minimum: bound(1), Maximum: bound(collectTimeout.Seconds())},
+				"interval":             {Type: "integer", Description: "Seconds between checks (0 = every collector run)", Minimum: bound(0), Maximum: bound(86400)},
+			}}},
+	})
+}
+
+func (c *probeCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *probeCollector) ApplyConfig(raw json.RawMessage) error {
+	var opts probeOptions
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	targets := make([]*probeTarget, 0, len(opts.Probes))
+	for i := range opts.Probes {
+		p := &opts.Probes[i]
+		if !probeNameRe.MatchString(p.Name) {
+			return fmt.Errorf("probes[%d]: name must be lowercase letters, digits, '_' or '-'", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("probes[%d]: duplicate name %q", i, p.Name)
+		}
+		names[p.Name] = true
+		if p.Timeout == 0 {
+			p.Timeout = 5
+		}
+		t := &probeTarget{}
+		switch p.Type {
+		case "", "http":
+			p.Type = "http"
+			u, err := url.Parse(p.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("probes[%d]: url must be an http(s) URL", i)
+			}
+			if p.Method == "" {
+				p.Method = http.MethodGet
+			}
+			if p.BodyRegex != "" {
+				if t.bodyRe, err = regexp.Compile(p.BodyRegex); err != nil {
+					return fmt.Errorf("probes[%d]: body_regex: %v", i, err)
+				}
+			}
+		case "tcp":
+			if _, _, err := net.SplitHostPort(p.Address); err != nil {
+				return fmt.Errorf("probes[%d]: address must be host:port", i)
+			}
+		default:
+			return fmt.Errorf("probes[%d]: unknown type %q", i, p.Type)
+		}
+		t.opts = *p
+		targets = append(targets, t)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Keep the check time of probes that did not change, so reconfiguring
+	// does not re-run hourly certificate checks
+	old := make(map[string]*probeTarget)
+	for _, t := range c.targets {
+		old[t.opts.Name] = t
+	}
+	for _, t := range targets {
+		if o := old[t.opts.Name]; o != nil && t.opts.Interval == o.opts.Interval {
+			t.lastCheck = o.lastCheck
+		}
+	}
+	c.opts = opts
+	c.targets = targets
+	return nil
+}
+
+func (c *probeCollector) ID() string   { return ProbeCollectorID }
+func (c *probeCollector) Name() string { return "Probes" }
+func (c *probeCollector) Description() string {
+	return "Synthetic HTTP and TCP checks: availability, latency, status and certificate expiry"
+}
+func (c *probeCollector) Impact() model.ImpactLevel { return model.ImpactNone }
+func (c *probeCollector) Warning() string           { return "" }
+
+func (c *probeCollector) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.names) == 0 {
+		return []string{"probe.*.up", "probe.*.duration_ms", "probe.*.status_code", "probe.*.tls_handshake_ms", "probe.*.cert_expiry_days"}
+	}
+	names := make([]string, 0, len(c.names))
+	for n := range c.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Collect runs the probes whose interval has elapsed, in parallel.
+func (c *probeCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	now := time.Now()
+	c.mu.Lock()
+	var due []*probeTarget
+	for _, t := range c.targets {
+		// Allow for scheduler jitter, as prom_scrape does
+		if iv := time.Duration(t.opts.Interval) * time.Second; t.lastCheck.IsZero() || now.Sub(t.lastCheck) >= iv-time.Second/2 {
+			t.lastCheck = now
+			due = append(due, t)
+		}
+	}
+	c.mu.Unlock()
+
+	results := make([][]model.MetricSample, len(due))
+	var wg sync.WaitGroup
+	for i, t := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.check(ctx, t, now)
+		}()
+	}
+	wg.Wait()
+
+	var samples []model.MetricSample
+	c.mu.Lock()
+	for _, r := range results {
+		for _, s := range r {
+			c.names[s.MetricName] = true
+		}
+		samples = append(samples, r...)
+	}
+	c.mu.Unlock()
+	return samples, nil
+}
+
+// probeResult holds the measurements of one check; zero values are not
+// reported.
+type probeResult struct {
+	duration   time.Duration
+	statusCode int
+	handshake  time.Duration
+	certExpiry time.Time
+	err        error
+}
+
+// check runs one probe. A failed check reports up 0 and is logged when its
+// error changes.
+func (c *probeCollector) check(ctx context.Context, t *probeTarget, now time.Time) []model.MetricSample {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(t.opts.Timeout)*time.Second)
+	defer cancel()
+	var res probeResult
+	if t.opts.Type == "tcp" {
+		res = c.checkTCP(ctx, t.opts.Address)
+	} else {
+		res = c.checkHTTP(ctx, t)
+	}
+
+	up := 1.0
+	target := t.opts.URL
+	if t.opts.Type == "tcp" {
+		target = t.opts.Address
+	}
+	if res.err != nil {
+		up = 0
+		if msg := res.err.Error(); msg != t.lastErr {
+			log.Printf("[probe] %s (%s): %v", t.opts.Name, target, res.err)
+			t.lastErr = msg
+		}
+	} else if t.lastErr != "" {
+		log.Printf("[probe] %s (%s): up again", t.opts.Name, target)
+		t.lastErr = ""
+	}
+
+	base := "probe." + t.opts.Name
+	ts := now.Unix()
+	samples := []model.MetricSample{
+		makeSample(ts, ProbeCollectorID, base+".up", up),
+		makeSample(ts, ProbeCollectorID, base+".duration_ms", float64(res.duration)/float64(time.Millisecond)),
+	}
+	if res.statusCode > 0 {
+		samples = append(samples, makeSample(ts, ProbeCollectorID, base+".status_code", float64(res.statusCode)))
+	}
+	if res.handshake > 0 {
+		samples = append(samples, makeSample(ts, ProbeCollectorID, base+".tls_handshake_ms", float64(res.handshake)/float64(time.Millisecond)))
+	}
+	if !res.certExpiry.IsZero() {
+		days := res.certExpiry.Sub(now).Hours() / 24
+		samples = append(samples, makeSample(ts, ProbeCollectorID, base+".cert_expiry_days", days))
+	}
+	return samples
+}
+
+func (c *probeCollector) checkTCP(ctx context.Context, addr string) probeResult {
+	start := time.Now()
+	conn, err := c.dialer.DialContext(ctx, "tcp", addr)
+	res := probeResult{duration: time.Since(start), err: err}
+	if conn != nil {
+		conn.Close()
+	}
+	return res
+}
+
+func (c *probeCollector) checkHTTP(ctx context.Context, t *probeTarget) (res probeResult) {
+	// The trace hooks run on the transport's dial goroutine, which may
+	// outlive a timed out request
+	var mu sync.Mutex
+	var tlsStart time.Time
+	var handshake time.Duration
+	var certExpiry time.Time
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if handshake == 0 && !tlsStart.IsZero() {
+				handshake = time.Since(tlsStart)
+			}
+			if len(cs.PeerCertificates) > 0 && certExpiry.IsZero() {
+				certExpiry = cs.PeerCertificates[0].NotAfter
+			}
+		},
+	}
+	defer func() {
+		mu.Lock()
+		res.handshake, res.certExpiry = handshake, certExpiry
+		mu.Unlock()
+	}()
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), t.opts.Method, t.opts.URL, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	client := &http.Client{Transport: c.transport}
+	if t.opts.InsecureSkipVerify {
+		client.Transport = c.insecure
+	}
+	if t.opts.NoFollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.duration = time.Since(start)
+		// Report the expiry of a certificate that failed verification
+		var verr *tls.CertificateVerificationError
+		if errors.As(err, &verr) && len(verr.UnverifiedCertificates) > 0 {
+			mu.Lock()
+			certExpiry = verr.UnverifiedCertificates[0].NotAfter
+			mu.Unlock()
+		}
+		res.err = err
+		return res
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, probeMaxBody))
+	res.duration = time.Since(start)
+	res.statusCode = resp.StatusCode
+	switch {
+	case err != nil:
+		res.err = fmt.Errorf("reading body: %v", err)
+	case !expectedStatus(t.opts.ExpectStatus, resp.StatusCode):
+		res.err = fmt.Errorf("unexpected status %s", resp.Status)
+	case t.bodyRe != nil && !t.bodyRe.Match(body):
+		res.err = fmt.Errorf("body does not match %q", t.opts.BodyRegex)
+	}
+	return res
+}
+
+func expectedStatus(expect []int, code int) bool {
+	if len(expect) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, e := range expect {
+		if e == code {
+			return true
+		}
+	}
+	return false
+}
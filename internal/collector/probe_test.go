@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// probeAnyValue marks a wanted metric whose value is not checked.
+var probeAnyValue = math.NaN()
+
+func newProbeTestServer(h http.Handler, tls bool) *httptest.Server {
+	if tls {
+		return httptest.NewTLSServer(h)
+	}
+	return httptest.NewServer(h)
+}
+
+func probeTestHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "status: healthy")
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	return mux // anything else is 404
+}
+
+func TestProbeCheck(t *testing.T) {
+	plain := newProbeTestServer(probeTestHandler(), false)
+	defer plain.Close()
+	secure := newProbeTestServer(probeTestHandler(), true)
+	defer secure.Close()
+	certExpiry := secure.Certificate().NotAfter
+
+	// A port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+
+	now := time.Now()
+	days := certExpiry.Sub(now).Hours() / 24
+	tests := []struct {
+		name   string
+		probe  probeTargetOptions
+		want   map[string]float64 // probeAnyValue = any value
+		absent []string
+	}{
+		{
+			name:   "http up",
+			probe:  probeTargetOptions{URL: plain.URL + "/ok"},
+			want:   map[string]float64{"up": 1, "duration_ms": probeAnyValue, "status_code": 200},
+			absent: []string{"tls_handshake_ms", "cert_expiry_days"},
+		},
+		{
+			name:  "http down on 404",
+			probe: probeTargetOptions{URL: plain.URL + "/missing"},
+			want:  map[string]float64{"up": 0, "status_code": 404},
+		},
+		{
+			name:  "expect_status accepts 404",
+			probe: probeTargetOptions{URL: plain.URL + "/missing", ExpectStatus: []int{404}},
+			want:  map[string]float64{"up": 1, "status_code": 404},
+		},
+		{
+			name:  "expect_status rejects 200",
+			probe: probeTargetOptions{URL: plain.URL + "/ok", ExpectStatus: []int{201, 204}},
+			want:  map[string]float64{"up": 0, "status_code": 200},
+		},
+		{
+			name:  "body_regex matches",
+			probe: probeTargetOptions{URL: plain.URL + "/ok", BodyRegex: `status: (healthy|ok)`},
+			want:  map[string]float64{"up": 1, "status_code": 200},
+		},
+		{
+			name:  "body_regex does not match",
+			probe: probeTargetOptions{URL: plain.URL + "/ok", BodyRegex: `^ready$`},
+			want:  map[string]float64{"up": 0, "status_code": 200},
+		},
+		{
+			name:  "redirect followed",
+			probe: probeTargetOptions{URL: plain.URL + "/redirect"},
+			want:  map[string]float64{"up": 1, "status_code": 200},
+		},
+		{
+			name:  "no_follow_redirects",
+			probe: probeTargetOptions{URL: plain.URL + "/redirect", NoFollowRedirects: true},
+			want:  map[string]float64{"up": 0, "status_code": 302},
+		},
+		{
+			name:  "no_follow_redirects with expected 302",
+			probe: probeTargetOptions{URL: plain.URL + "/redirect", NoFollowRedirects: true, ExpectStatus: []int{302}},
+			want:  map[string]float64{"up": 1, "status_code": 302},
+		},
+		{
+			name:  "https with insecure_skip_verify",
+			probe: probeTargetOptions{URL: secure.URL + "/ok", InsecureSkipVerify: true},
+			want:  map[string]float64{"up": 1, "status_code": 200, "tls_handshake_ms": probeAnyValue, "cert_expiry_days": days},
+		},
+		{
+			name:   "https with untrusted certificate",
+			probe:  probeTargetOptions{URL: secure.URL + "/ok"},
+			want:   map[string]float64{"up": 0, "cert_expiry_days": days},
+			absent: []string{"status_code"},
+		},
+		{
+			name:   "tcp open port",
+			probe:  probeTargetOptions{Type: "tcp", Address: open.Addr().String()},
+			want:   map[string]float64{"up": 1, "duration_ms": probeAnyValue},
+			absent: []string{"status_code", "tls_handshake_ms", "cert_expiry_days"},
+		},
+		{
+			name:   "tcp closed port",
+			probe:  probeTargetOptions{Type: "tcp", Address: closedAddr},
+			want:   map[string]float64{"up": 0, "duration_ms": probeAnyValue},
+			absent: []string{"status_code"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewProbeCollector().(*probeCollector)
+			tt.probe.Name = "test"
+			raw, _ := json.Marshal(probeOptions{Probes: []probeTargetOptions{tt.probe}})
+			if err := c.ApplyConfig(raw); err != nil {
+				t.Fatalf("ApplyConfig: %v", err)
+			}
+			got := sampleValues(c.check(context.Background(), c.targets[0], now))
+			for name, want := range tt.want {
+				v, ok := got["probe.test."+name]
+				switch {
+				case !ok:
+					t.Errorf("%s missing, got %v", name, got)
+				case !math.IsNaN(want) && math.Abs(v-want) > 1e-9:
+					t.Errorf("%s = %v, want %v", name, v, want)
+				}
+			}
+			for _, name := range tt.absent {
+				if v, ok := got["probe.test."+name]; ok {
+					t.Errorf("%s = %v, want no sample", name, v)
+				}
+			}
+		})
+	}
+}
+
+func TestProbeMetricNames(t *testing.T) {
+	c := NewProbeCollector()
+	want := []string{"probe.*.up", "probe.*.duration_ms", "probe.*.status_code", "probe.*.tls_handshake_ms", "probe.*.cert_expiry_days"}
+	if got := c.MetricNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, n := range want {
+		if _, ok := MetricPattern(strings.Replace(n, "*", "web", 1)); !ok {
+			t.Errorf("%s has no description", n)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package collector
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/playok/only1mon/internal/model"
@@ -11,30 +13,59 @@ import (
 )
 
 type processCollector struct {
-	prevTime int64
-	prevIO   map[int32]procIOSnapshot // keyed by PID
-	topN     int
+	ioRates *counterTracker[procIOKey, uint64]
+	mu      sync.Mutex // guards topN
+	topN    int
 }
 
-type procIOSnapshot struct {
-	readBytes  uint64
-	writeBytes uint64
+// processOptions are the configurable options of the process collector.
+type processOptions struct {
+	TopN int `json:"top_n"`
 }
 
-func NewProcessCollector() Collector { return &processCollector{topN: 10} }
+// procIOKey identifies one per-process I/O counter.
+type procIOKey struct {
+	pid   int32
+	write bool
+}
+
+// maxTopN bounds the process collector's top_n option.
+const maxTopN = 50
+
+// ClampTopN limits n to the range of the process collector's top_n option,
+// for the legacy top_process_count setting that used to be clamped silently.
+func ClampTopN(n int) int {
+	return max(1, min(n, maxTopN))
+}
+
+func NewProcessCollector() Collector {
+	return &processCollector{ioRates: newCounterTracker[procIOKey, uint64](), topN: 10}
+}
 
-// TopN returns the current top-N process count.
-func (c *processCollector) TopN() int { return c.topN }
+func (c *processCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"top_n": {Type: "integer", Description: "Number of processes reported in each top-N list", Default: 10, Minimum: bound(1), Maximum: bound(maxTopN)},
+	})
+}
+
+func (c *processCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return processOptions{TopN: c.topN}
+}
 
-// SetTopN updates the top-N process count.
-func (c *processCollector) SetTopN(n int) {
-	if n < 1 {
-		n = 1
+func (c *processCollector) ApplyConfig(raw json.RawMessage) error {
+	opts := processOptions{TopN: 10}
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
 	}
-	if n > 50 {
-		n = 50
+	if opts.TopN < 1 || opts.TopN > maxTopN {
+		return fmt.Errorf("top_n must be between 1 and %d", maxTopN)
 	}
-	c.topN = n
+	c.mu.Lock()
+	c.topN = opts.TopN
+	c.mu.Unlock()
+	return nil
 }
 
 func (c *processCollector) ID() string          { return "process" }
@@ -75,11 +106,7 @@ func (c *processCollector) Collect(ctx context.Context) ([]model.MetricSample, e
 
 	samples = append(samples, makeSample(now, "process", "proc.total_count", float64(len(procs))))
 
-	elapsed := float64(now - c.prevTime)
-	if c.prevTime == 0 || elapsed <= 0 {
-		elapsed = 0
-	}
-	curIO := make(map[int32]procIOSnapshot, len(procs))
+	c.ioRates.begin(now)
 
 	var infos []procInfo
 	for _, p := range procs {
@@ -96,26 +123,22 @@ func (c *processCollector) Collect(ctx context.Context) ([]model.MetricSample, e
 
 		// Per-process I/O counters (platform-specific)
 		if rb, wb, ok := readProcIO(p.Pid); ok {
-			curIO[p.Pid] = procIOSnapshot{readBytes: rb, writeBytes: wb}
-			if elapsed > 0 && c.prevIO != nil {
-				if prev, ok := c.prevIO[p.Pid]; ok {
-					if rb >= prev.readBytes {
-						info.readBps = float64(rb-prev.readBytes) / elapsed
-					}
-					if wb >= prev.writeBytes {
-						info.writeBps = float64(wb-prev.writeBytes) / elapsed
-					}
-				}
+			if r, ok := c.ioRates.rate(procIOKey{pid: p.Pid}, rb); ok {
+				info.readBps = r
+			}
+			if r, ok := c.ioRates.rate(procIOKey{pid: p.Pid, write: true}, wb); ok {
+				info.writeBps = r
 			}
 		}
 
 		infos = append(infos, info)
 	}
 
-	c.prevIO = curIO
-	c.prevTime = now
+	c.ioRates.commit()
 
+	c.mu.Lock()
 	topN := c.topN
+	c.mu.Unlock()
 	if topN < 1 {
 		topN = 10
 	}
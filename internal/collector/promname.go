@@ -0,0 +1,117 @@
+package collector
+
+import "strings"
+
+// promLabelNames names the label that replaces a "*" segment of a description
+// pattern, keyed by the pattern up to and including that segment. A full
+// pattern entry overrides its prefix. Unlisted wildcards are named after the
+// segment before them.
+var promLabelNames = map[string]string{
+	"cpu.core.*":           "core",
+	"disk.*":               "device",
+	"disk.*.total":         "mount",
+	"disk.*.used":          "mount",
+	"disk.*.free":          "mount",
+	"disk.*.used_pct":      "mount",
+	"net.*":                "interface",
+	"proc.top_cpu.*":       "rank",
+	"proc.top_mem.*":       "rank",
+	"proc.top_io.*":        "rank",
+	"gpu.*":                "gpu",
+	"only1mon.collector.*": "collector",
+	"prom.*":               "target",
+}
+
+// PromName converts a dotted metric name to a Prometheus metric name plus
+// labels, turning the wildcard segments of its description pattern into
+// labels: disk.root.used_pct -> only1mon_disk_used_pct{mount="root"}.
+func PromName(name string) (string, [][2]string) {
+	parts := strings.Split(name, ".")
+	var labels [][2]string
+	if pattern, ok := MetricPattern(name); ok {
+		pp := strings.Split(pattern, ".")
+		kept := parts[:0:0]
+		for i, seg := range pp {
+			if seg != "*" {
+				kept = append(kept, seg)
+				continue
+			}
+			labels = append(labels, [2]string{promLabelName(pattern, pp, i), parts[i]})
+		}
+		parts = kept
+	}
+	metric := strings.Join(parts, "_")
+	if !strings.HasPrefix(name, "only1mon.") {
+		metric = "only1mon_" + metric
+	}
+	return sanitizePromName(metric), labels
+}
+
+// PromSampleLabels appends the k=v pairs of a sample's Labels to labels. A
+// comma not followed by a k= pair belongs to the preceding value, and a value
+// with no name before it (a process name) is labeled "labels". Names are
+// sanitized like metric names; one that is reserved ("__" prefix) or already
+// present, e.g. a derived "host", gets an "exported_" prefix as Prometheus
+// does for scraped labels that clash with target labels. Empty values are
+// dropped, since Prometheus treats them as absent.
+func PromSampleLabels(labels [][2]string, sample string) [][2]string {
+	if sample == "" {
+		return labels
+	}
+	var pairs [][2]string
+	for _, p := range strings.Split(sample, ",") {
+		k, v, ok := strings.Cut(p, "=")
+		switch {
+		case ok && k != "":
+			pairs = append(pairs, [2]string{sanitizePromName(k), v})
+		case len(pairs) > 0:
+			pairs[len(pairs)-1][1] += "," + p
+		default:
+			pairs = append(pairs, [2]string{"labels", p})
+		}
+	}
+	for _, p := range pairs {
+		if p[1] == "" {
+			continue
+		}
+		name := p[0]
+		for strings.HasPrefix(name, "__") || hasPromLabel(labels, name) {
+			name = "exported_" + name
+		}
+		labels = append(labels, [2]string{name, p[1]})
+	}
+	return labels
+}
+
+func hasPromLabel(labels [][2]string, name string) bool {
+	for _, l := range labels {
+		if l[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func promLabelName(pattern string, pp []string, i int) string {
+	if l, ok := promLabelNames[pattern]; ok {
+		return l
+	}
+	if l, ok := promLabelNames[strings.Join(pp[:i+1], ".")]; ok {
+		return l
+	}
+	if i > 0 {
+		return sanitizePromName(pp[i-1])
+	}
+	return "name"
+}
+
+// sanitizePromName replaces characters not allowed in metric and label names.
+func sanitizePromName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || (c >= '0' && c <= '9' && i > 0)) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPromSampleLabels(t *testing.T) {
+	host := [][2]string{{"host", "web1"}}
+	tests := []struct {
+		name    string
+		derived [][2]string
+		sample  string
+		want    [][2]string
+	}{
+		{"no labels", host, "", host},
+		{"pairs", nil, "env=prod,route=/users", [][2]string{{"env", "prod"}, {"route", "/users"}}},
+		{"after derived labels", host, "env=prod", [][2]string{{"host", "web1"}, {"env", "prod"}}},
+		{"names are sanitized", nil, "k8s.pod=a,1st=b,a-b=c", [][2]string{{"k8s_pod", "a"}, {"_st", "b"}, {"a_b", "c"}}},
+		{"= in a value", nil, "q=a=b", [][2]string{{"q", "a=b"}}},
+		{"comma in a value", nil, "dev=sd,a,mount=/data 1", [][2]string{{"dev", "sd,a"}, {"mount", "/data 1"}}},
+		{"value without a name", nil, "nginx", [][2]string{{"labels", "nginx"}}},
+		{"names without values", nil, "canary,env=prod", [][2]string{{"labels", "canary"}, {"env", "prod"}}},
+		{"empty values are dropped", nil, "a=,b=1", [][2]string{{"b", "1"}}},
+		{"no name before =", nil, "=x", [][2]string{{"labels", "=x"}}},
+
+		{"clash with a derived label", host, "host=db1", [][2]string{{"host", "web1"}, {"exported_host", "db1"}}},
+		{"clash after sanitizing", nil, "a-b=1,a.b=2", [][2]string{{"a_b", "1"}, {"exported_a_b", "2"}}},
+		{"clash with an exported name", [][2]string{{"host", "web1"}, {"exported_host", "x"}}, "host=db1",
+			[][2]string{{"host", "web1"}, {"exported_host", "x"}, {"exported_exported_host", "db1"}}},
+		{"reserved names", [][2]string{{"__name__", "m"}}, "__name__=x,__meta=y",
+			[][2]string{{"__name__", "m"}, {"exported___name__", "x"}, {"exported___meta", "y"}}},
+	}
+	for _, tt := range tests {
+		derived := append([][2]string(nil), tt.derived...)
+		if got := PromSampleLabels(derived, tt.sample); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: PromSampleLabels(%q) = %q, want %q", tt.name, tt.sample, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// scrapedSample is one sample line of the Prometheus text exposition format.
+type scrapedSample struct {
+	name   string
+	labels [][2]string
+	value  float64
+}
+
+// label returns the value of a label, or "".
+func (s *scrapedSample) label(name string) string {
+	for _, l := range s.labels {
+		if l[0] == name {
+			return l[1]
+		}
+	}
+	return ""
+}
+
+// parsePromText parses the Prometheus text exposition format (and the
+// OpenMetrics subset used by common exporters). It returns the declared type
+// of each metric family and the samples; timestamps are ignored.
+func parsePromText(r io.Reader) (map[string]string, []scrapedSample, error) {
+	types := make(map[string]string)
+	var samples []scrapedSample
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			// # TYPE <name> <type>; HELP and other comments are skipped
+			if f := strings.Fields(line); len(f) >= 4 && f[1] == "TYPE" {
+				types[f[2]] = f[3]
+			}
+			continue
+		}
+		s, err := parsePromSample(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		samples = append(samples, s)
+	}
+	return types, samples, sc.Err()
+}
+
+func parsePromSample(line string) (scrapedSample, error) {
+	var s scrapedSample
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	s.name = line[:i]
+	rest := line[i:]
+	if rest[0] == '{' {
+		labels, n, err := parsePromLabels(rest)
+		if err != nil {
+			return s, err
+		}
+		s.labels = labels
+		rest = rest[n:]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("bad value %q", fields[0])
+	}
+	s.value = v
+	return s, nil
+}
+
+// parsePromLabels parses {k="v",...} at the start of s and returns the labels
+// and the number of bytes consumed.
+func parsePromLabels(s string) ([][2]string, int, error) {
+	var labels [][2]string
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated labels")
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 {
+			return nil, 0, fmt.Errorf("bad label")
+		}
+		key := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("label %s: value must be quoted", key)
+		}
+		i++
+		var b strings.Builder
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				if s[i] == 'n' {
+					b.WriteByte('\n')
+					continue
+				}
+			}
+			b.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("label %s: unterminated value", key)
+		}
+		i++ // closing quote
+		labels = append(labels, [2]string{key, b.String()})
+	}
+}
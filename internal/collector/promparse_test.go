@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePromText(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		types   map[string]string
+		samples []scrapedSample
+		wantErr string
+	}{
+		{
+			name: "comments",
+			in: "# HELP http_requests_total Requests served.\n" +
+				"# TYPE http_requests_total counter\n" +
+				"# any other comment\n" +
+				"#TYPE not_a_type_line gauge\n" +
+				"\n" +
+				"http_requests_total 1027\n",
+			types:   map[string]string{"http_requests_total": "counter"},
+			samples: []scrapedSample{{name: "http_requests_total", value: 1027}},
+		},
+		{
+			name: "escaped label values",
+			in:   `files{path="C:\\Temp\\x",msg="say \"hi\"",text="a\nb"} 2` + "\n",
+			samples: []scrapedSample{{name: "files", labels: [][2]string{
+				{"path", `C:\Temp\x`}, {"msg", `say "hi"`}, {"text", "a\nb"},
+			}, value: 2}},
+		},
+		{
+			name: "label spacing and trailing comma",
+			in:   `up{ job="node", instance="a:9100", } 1`,
+			samples: []scrapedSample{{name: "up", labels: [][2]string{
+				{"job", "node"}, {"instance", "a:9100"},
+			}, value: 1}},
+		},
+		{
+			name:    "empty labels",
+			in:      "up{} 0",
+			samples: []scrapedSample{{name: "up", value: 0}},
+		},
+		{
+			name: "histogram with +Inf bucket",
+			in: "# TYPE rpc_seconds histogram\n" +
+				`rpc_seconds_bucket{le="0.1"} 3` + "\n" +
+				`rpc_seconds_bucket{le="+Inf"} 5` + "\n" +
+				"rpc_seconds_sum 0.9\n" +
+				"rpc_seconds_count 5\n",
+			types: map[string]string{"rpc_seconds": "histogram"},
+			samples: []scrapedSample{
+				{name: "rpc_seconds_bucket", labels: [][2]string{{"le", "0.1"}}, value: 3},
+				{name: "rpc_seconds_bucket", labels: [][2]string{{"le", "+Inf"}}, value: 5},
+				{name: "rpc_seconds_sum", value: 0.9},
+				{name: "rpc_seconds_count", value: 5},
+			},
+		},
+		{
+			name: "special values",
+			in:   "a +Inf\nb -Inf\nc 1e3\n",
+			samples: []scrapedSample{
+				{name: "a", value: math.Inf(1)},
+				{name: "b", value: math.Inf(-1)},
+				{name: "c", value: 1000},
+			},
+		},
+		{
+			name: "timestamps ignored",
+			in:   "temp 21.5 1700000000000\n" + `temp{zone="b"}   22	1700000000000` + "\n",
+			samples: []scrapedSample{
+				{name: "temp", value: 21.5},
+				{name: "temp", labels: [][2]string{{"zone", "b"}}, value: 22},
+			},
+		},
+		{name: "unquoted label value", in: "up{job=node} 1", wantErr: "line 1: label job: value must be quoted"},
+		{name: "unterminated label value", in: `up{job="node} 1`, wantErr: "line 1: label job: unterminated value"},
+		{name: "unterminated labels", in: `up{job="node"`, wantErr: "line 1: unterminated labels"},
+		{name: "missing value", in: "# TYPE up gauge\nup\n", wantErr: "line 2: missing value"},
+		{name: "missing value after labels", in: `up{job="node"}`, wantErr: "line 1: missing value"},
+		{name: "bad value", in: "ok 1\nup one\n", wantErr: `line 2: bad value "one"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types, samples, err := parsePromText(strings.NewReader(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePromText: %v", err)
+			}
+			if tt.types == nil {
+				tt.types = map[string]string{}
+			}
+			if !reflect.DeepEqual(types, tt.types) {
+				t.Errorf("types = %v, want %v", types, tt.types)
+			}
+			if !reflect.DeepEqual(samples, tt.samples) {
+				t.Errorf("samples = %+v, want %+v", samples, tt.samples)
+			}
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+const (
+	// PromScrapeCollectorID is the collector ID of the Prometheus scraper.
+	PromScrapeCollectorID = "prom_scrape"
+	// promScrapeTimeout bounds one scrape.
+	promScrapeTimeout = 5 * time.Second
+	// promScrapeMaxSamples bounds the samples taken from one target per scrape.
+	promScrapeMaxSamples = 5000
+)
+
+// promScrapeOptions are the configurable options of the prom_scrape collector.
+type promScrapeOptions struct {
+	Targets []promTargetOptions `json:"targets"`
+}
+
+// promTargetOptions configures one scrape target.
+type promTargetOptions struct {
+	URL string `json:"url"`
+	// Interval is the least time between scrapes in seconds; 0 scrapes on
+	// every run of the collector.
+	Interval int `json:"interval"`
+	// Allowlist holds metric family name patterns to keep (empty = all).
+	Allowlist []string `json:"allowlist"`
+	// Prefix names the target in metric names: prom.<prefix>.<metric>.
+	// Defaults to the target's host and port.
+	Prefix string `json:"prefix"`
+}
+
+// promTarget is a target and its scrape state. opts, lastScrape and names
+// are guarded by the collector's mutex; the rest is only used by the scrape.
+type promTarget struct {
+	opts       promTargetOptions
+	lastScrape time.Time
+	names      []string                         // metric names of the last scrape
+	rates      *counterTracker[string, float64] // cumulative series by sample identity
+	lastErr    string
+}
+
+// promScrapeCollector scrapes local Prometheus exporters. Every sample is
+// renamed to prom.<prefix>.<family>.<label values...>, label values ordered by
+// label name. Gauges are stored as is; counters become per-second .rate
+// samples; histograms and summaries become .rate (observations per second),
+// .avg and quantiles (.p50, .p95, .p99 for histograms, the exported quantiles
+// for summaries) over the interval between scrapes. Each target also reports
+// prom.<prefix>.scrape_up and prom.<prefix>.scrape_duration_ms.
+type promScrapeCollector struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	opts    promScrapeOptions
+	targets []*promTarget
+}
+
+func NewPromScrapeCollector() Collector {
+	return &promScrapeCollector{
+		client: &http.Client{Timeout: promScrapeTimeout},
+	}
+}
+
+func (c *promScrapeCollector) ConfigSchema() ConfigSchema {
+	return objectSchema(map[string]ConfigProperty{
+		"targets": {Type: "array", Description: "Prometheus endpoints to scrape",
+			Items: &ConfigProperty{Type: "object", Properties: map[string]ConfigProperty{
+				"url":       {Type: "string", Description: "Exposition URL, e.g. http://127.0.0.1:9100/metrics"},
+				"interval":  {Type: "integer", Description: "Seconds between scrapes (0 = every collector run)", Minimum: bound(0), Maximum: bound(3600)},
+				"allowlist": {Type: "array", Items: &ConfigProperty{Type: "string"}, Description: "Metric family patterns to keep (e.g. \"node_hwmon_*\"); empty keeps all"},
+				"prefix":    {Type: "string", Description: "Name of the target in metric names (default: host_port)"},
+			}}},
+	})
+}
+
+func (c *promScrapeCollector) Config() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+func (c *promScrapeCollector) ApplyConfig(raw json.RawMessage) error {
+	var opts promScrapeOptions
+	if err := decodeOptions(raw, &opts); err != nil {
+		return err
+	}
+	prefixes := make(map[string]bool)
+	for i := range opts.Targets {
+		t := &opts.Targets[i]
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("targets[%d]: url must be an http(s) URL", i)
+		}
+		if err := validGlobs(fmt.Sprintf("targets[%d].allowlist", i), t.Allowlist); err != nil {
+			return err
+		}
+		if t.Prefix == "" {
+			t.Prefix = strings.ReplaceAll(u.Host, ":", "_")
+		}
+		t.Prefix = sanitizeMetricName(strings.ReplaceAll(t.Prefix, ".", "_"))
+		if prefixes[t.Prefix] {
+			return fmt.Errorf("targets[%d]: duplicate prefix %q", i, t.Prefix)
+		}
+		prefixes[t.Prefix] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Keep the scrape state of targets that did not change
+	old := make(map[string]*promTarget)
+	for _, t := range c.targets {
+		old[t.opts.URL+"\x00"+t.opts.Prefix] = t
+	}
+	c.opts = opts
+	c.targets = c.targets[:0:0]
+	for _, o := range opts.Targets {
+		t := old[o.URL+"\x00"+o.Prefix]
+		if t == nil {
+			t = &promTarget{rates: newCounterTracker[string, float64]()}
+		}
+		t.opts = o
+		c.targets = append(c.targets, t)
+	}
+	return nil
+}
+
+func (c *promScrapeCollector) ID() string   { return PromScrapeCollectorID }
+func (c *promScrapeCollector) Name() string { return "Prometheus Scrape" }
+func (c *promScrapeCollector) Description() string {
+	return "Scrapes local Prometheus exporters and /metrics endpoints"
+}
+func (c *promScrapeCollector) Impact() model.ImpactLevel { return model.ImpactLow }
+func (c *promScrapeCollector) Warning() string {
+	return "Exporters with many series produce many metrics; use an allowlist"
+}
+
+// MetricNames returns the names produced by the last scrape of each
+// configured target, so series that disappear from a target or belong to a
+// removed target are not listed forever.
+func (c *promScrapeCollector) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for _, t := range c.targets {
+		names = append(names, t.names...)
+	}
+	if len(names) == 0 {
+		return []string{"prom.*.scrape_up", "prom.*.scrape_duration_ms"}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Collect scrapes the targets whose interval has elapsed, in parallel.
+func (c *promScrapeCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	now := time.Now()
+	c.mu.Lock()
+	var due []*promTarget
+	var dueOpts []promTargetOptions
+	for _, t := range c.targets {
+		// Allow for scheduler jitter so a 15s target on a 5s collector runs every third tick
+		if iv := time.Duration(t.opts.Interval) * time.Second; t.lastScrape.IsZero() || now.Sub(t.lastScrape) >= iv-time.Second/2 {
+			t.lastScrape = now
+			due = append(due, t)
+			dueOpts = append(dueOpts, t.opts)
+		}
+	}
+	c.mu.Unlock()
+
+	results := make([][]model.MetricSample, len(due))
+	var wg sync.WaitGroup
+	for i, t := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.scrapeTarget(ctx, t, dueOpts[i], now)
+		}()
+	}
+	wg.Wait()
+
+	var samples []model.MetricSample
+	c.mu.Lock()
+	for i, r := range results {
+		seen := make(map[string]bool, len(r))
+		names := make([]string, 0, len(r))
+		for _, s := range r {
+			if !seen[s.MetricName] {
+				seen[s.MetricName] = true
+				names = append(names, s.MetricName)
+			}
+		}
+		due[i].names = names
+		samples = append(samples, r...)
+	}
+	c.mu.Unlock()
+	return samples, nil
+}
+
+// scrapeTarget scrapes one target and converts its samples. A failed scrape
+// reports scrape_up 0 and is logged when its error changes.
+func (c *promScrapeCollector) scrapeTarget(ctx context.Context, t *promTarget, opts promTargetOptions, now time.Time) []model.MetricSample {
+	base := "prom." + opts.Prefix
+	start := time.Now()
+	types, scraped, err := c.fetch(ctx, opts.URL)
+	dur := float64(time.Since(start)) / float64(time.Millisecond)
+
+	up := 1.0
+	var samples []model.MetricSample
+	if err != nil {
+		up = 0
+		if msg := err.Error(); msg != t.lastErr {
+			log.Printf("[prom_scrape] %s: %v", opts.URL, err)
+			t.lastErr = msg
+		}
+	} else {
+		if t.lastErr != "" {
+			log.Printf("[prom_scrape] %s: scraping again", opts.URL)
+			t.lastErr = ""
+		}
+		samples = t.convert(base, opts.Allowlist, types, scraped, now)
+	}
+	return append(samples,
+		makeSample(now.Unix(), PromScrapeCollectorID, base+".scrape_up", up),
+		makeSample(now.Unix(), PromScrapeCollectorID, base+".scrape_duration_ms", dur))
+}
+
+func (c *promScrapeCollector) fetch(ctx context.Context, target string) (map[string]string, []scrapedSample, error) {
+	ctx, cancel := context.WithTimeout(ctx, promScrapeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return parsePromText(resp.Body)
+}
+
+// promHistogram collects the buckets, sum and count of one histogram or
+// summary series during conversion.
+type promHistogram struct {
+	name      string              // dotted name without suffix
+	buckets   map[float64]float64 // le → increase since the previous scrape
+	quantiles map[string]float64  // summary quantile label → value
+	sum       float64             // increase of _sum
+	count     float64             // increase of _count
+	sumOK     bool                // the _sum increase is known
+	countOK   bool                // the _count increase is known
+}
+
+// convert maps scraped samples to only1mon samples, updating the cumulative
+// state used for rates.
+func (t *promTarget) convert(base string, allowlist []string, types map[string]string, scraped []scrapedSample, now time.Time) []model.MetricSample {
+	ts := now.Unix()
+	t.rates.begin(ts)
+	defer t.rates.commit()
+	elapsed := t.rates.elapsed()
+
+	var out []model.MetricSample
+	emit := func(name string, v float64) {
+		if len(out) < promScrapeMaxSamples && !math.IsNaN(v) && !math.IsInf(v, 0) {
+			out = append(out, makeSample(ts, PromScrapeCollectorID, name, v))
+		}
+	}
+	hists := make(map[string]*promHistogram)
+	var histOrder []string
+
+	for i := range scraped {
+		s := &scraped[i]
+		family, suffix, typ := promFamilyOf(s.name, types)
+		if len(allowlist) > 0 && !matchAny(allowlist, family) {
+			continue
+		}
+		id := s.name + promLabelKey(s.labels)
+		switch typ {
+		case "counter":
+			if r, ok := t.rates.rate(id, s.value); ok {
+				emit(promDottedName(base, family, s.labels)+".rate", r)
+			}
+		case "histogram", "summary":
+			name := promDottedName(base, family, s.labels)
+			h := hists[name]
+			if h == nil {
+				h = &promHistogram{name: name, buckets: map[float64]float64{}, quantiles: map[string]float64{}}
+				hists[name] = h
+				histOrder = append(histOrder, name)
+			}
+			switch suffix {
+			case "_bucket":
+				le, err := strconv.ParseFloat(s.label("le"), 64)
+				if d, ok := t.rates.delta(id, s.value); ok && err == nil {
+					h.buckets[le] = d
+				}
+			case "_sum":
+				h.sum, h.sumOK = t.rates.delta(id, s.value)
+			case "_count":
+				h.count, h.countOK = t.rates.delta(id, s.value)
+			default:
+				if q := s.label("quantile"); q != "" {
+					h.quantiles[q] = s.value
+				}
+			}
+		default: // gauge, untyped
+			emit(promDottedName(base, family, s.labels), s.value)
+		}
+	}
+
+	for _, name := range histOrder {
+		h := hists[name]
+		if h.countOK {
+			emit(name+".rate", h.count/elapsed)
+			if h.sumOK && h.count > 0 {
+				emit(name+".avg", h.sum/h.count)
+			}
+		}
+		if len(h.buckets) > 0 && h.count > 0 {
+			for _, q := range []float64{0.50, 0.95, 0.99} {
+				emit(name+"."+promQuantileName(q), histogramQuantile(q, h.buckets))
+			}
+		}
+		for q, v := range h.quantiles {
+			if f, err := strconv.ParseFloat(q, 64); err == nil {
+				emit(name+"."+promQuantileName(f), v)
+			}
+		}
+	}
+
+	return out
+}
+
+// promFamilyOf returns the metric family, the series suffix within the family
+// and the family type of a sample name.
+func promFamilyOf(name string, types map[string]string) (family, suffix, typ string) {
+	if typ, ok := types[name]; ok {
+		return name, "", typ
+	}
+	for _, suf := range []string{"_bucket", "_sum", "_count", "_total"} {
+		if base, ok := strings.CutSuffix(name, suf); ok {
+			if typ, ok := types[base]; ok {
+				return base, suf, typ
+			}
+		}
+	}
+	return name, "", "untyped"
+}
+
+// promDottedName builds prom.<prefix>.<family>.<label values...>, with the
+// values ordered by label name. le and quantile are not part of the name.
+func promDottedName(base, family string, labels [][2]string) string {
+	sorted := make([][2]string, 0, len(labels))
+	for _, l := range labels {
+		if l[0] != "le" && l[0] != "quantile" {
+			sorted = append(sorted, l)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+	var b strings.Builder
+	b.WriteString(base + "." + sanitizeMetricName(family))
+	for _, l := range sorted {
+		v := sanitizeMetricName(strings.ReplaceAll(l[1], ".", "_"))
+		if v == "" {
+			v = "_"
+		}
+		b.WriteString("." + v)
+	}
+	return b.String()
+}
+
+// promLabelKey renders labels as an identity key in exposition order.
+func promLabelKey(labels [][2]string) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString("\xff" + l[0] + "\xff" + l[1])
+	}
+	return b.String()
+}
+
+// promQuantileName names a quantile sample: 0.5 → p50, 0.999 → p99_9.
+func promQuantileName(q float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(q*100, 'f', -1, 64), ".", "_")
+}
+
+// histogramQuantile estimates the q-quantile from per-bucket increases of
+// cumulative histogram buckets (keyed by upper bound), interpolating linearly
+// within the bucket like Prometheus' histogram_quantile.
+func histogramQuantile(q float64, buckets map[float64]float64) float64 {
+	bounds := make([]float64, 0, len(buckets))
+	for le := range buckets {
+		bounds = append(bounds, le)
+	}
+	sort.Float64s(bounds)
+	total := buckets[bounds[len(bounds)-1]]
+	if total <= 0 {
+		return math.NaN()
+	}
+	rank := q * total
+	lower, prevCount := 0.0, 0.0
+	for i, le := range bounds {
+		count := buckets[le]
+		if count >= rank {
+			if math.IsInf(le, 1) {
+				// Falls in the +Inf bucket: the best estimate is the highest finite bound
+				if i > 0 {
+					return bounds[i-1]
+				}
+				return math.NaN()
+			}
+			if i == 0 && le <= 0 {
+				return le
+			}
+			if count == prevCount {
+				return le
+			}
+			return lower + (le-lower)*(rank-prevCount)/(count-prevCount)
+		}
+		lower, prevCount = le, count
+	}
+	return bounds[len(bounds)-1]
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// promExposition renders a scrape page whose counters have advanced by n
+// steps: 10 requests, 4 observations and 0.2s of latency per step.
+func promExposition(n int) string {
+	return fmt.Sprintf(`# HELP app_temp_celsius Temperature.
+# TYPE app_temp_celsius gauge
+app_temp_celsius{sensor="cpu.0"} %d
+# TYPE app_requests_total counter
+app_requests_total{code="200",method="get"} %d
+# TYPE app_latency_seconds histogram
+app_latency_seconds_bucket{le="0.1"} %d
+app_latency_seconds_bucket{le="0.5"} %d
+app_latency_seconds_bucket{le="+Inf"} %d
+app_latency_seconds_sum %g
+app_latency_seconds_count %d
+# TYPE app_gc_seconds summary
+app_gc_seconds{quantile="0.5"} 0.01
+app_gc_seconds{quantile="0.99"} 0.05
+app_gc_seconds_sum 1
+app_gc_seconds_count 10
+# TYPE other_metric gauge
+other_metric 7
+`, 40+n, 1000+10*n, 2*n, 4*n, 4*n, 0.2*float64(n), 4*n)
+}
+
+// promTestServer serves promExposition(step), where step is set by the test.
+type promTestServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	step int
+	fail bool
+}
+
+func newPromTestServer(t *testing.T) *promTestServer {
+	srv := &promTestServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		if srv.fail {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, promExposition(srv.step))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *promTestServer) set(step int, fail bool) {
+	srv.mu.Lock()
+	srv.step, srv.fail = step, fail
+	srv.mu.Unlock()
+}
+
+func newTestPromScrape(t *testing.T, targets ...promTargetOptions) *promScrapeCollector {
+	t.Helper()
+	c := NewPromScrapeCollector().(*promScrapeCollector)
+	raw, _ := json.Marshal(promScrapeOptions{Targets: targets})
+	if err := c.ApplyConfig(raw); err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	return c
+}
+
+func sampleValues(samples []model.MetricSample) map[string]float64 {
+	m := make(map[string]float64, len(samples))
+	for _, s := range samples {
+		m[s.MetricName] = s.Value
+	}
+	return m
+}
+
+func TestPromScrapeConvert(t *testing.T) {
+	srv := newPromTestServer(t)
+	c := newTestPromScrape(t, promTargetOptions{URL: srv.URL, Prefix: "app", Allowlist: []string{"app_*"}})
+	tgt := c.targets[0]
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name string
+		step int
+		fail bool
+		at   time.Duration
+		want map[string]float64
+	}{
+		{
+			name: "first scrape has no rates",
+			at:   0,
+			want: map[string]float64{
+				"prom.app.app_temp_celsius.cpu_0": 40,
+				"prom.app.app_gc_seconds.p50":     0.01,
+				"prom.app.app_gc_seconds.p99":     0.05,
+				"prom.app.scrape_up":              1,
+			},
+		},
+		{
+			name: "rates and histogram quantiles",
+			step: 1,
+			at:   10 * time.Second,
+			want: map[string]float64{
+				"prom.app.app_temp_celsius.cpu_0":          41,
+				"prom.app.app_requests_total.200.get.rate": 1,
+				"prom.app.app_latency_seconds.rate":        0.4,
+				"prom.app.app_latency_seconds.avg":         0.05,
+				"prom.app.app_latency_seconds.p50":         0.1,
+				"prom.app.app_latency_seconds.p95":         0.46,
+				"prom.app.app_latency_seconds.p99":         0.492,
+				"prom.app.app_gc_seconds.rate":             0,
+				"prom.app.app_gc_seconds.p50":              0.01,
+				"prom.app.app_gc_seconds.p99":              0.05,
+				"prom.app.scrape_up":                       1,
+			},
+		},
+		{
+			name: "failed scrape",
+			fail: true,
+			at:   20 * time.Second,
+			want: map[string]float64{"prom.app.scrape_up": 0},
+		},
+		{
+			name: "counter reset yields no rates",
+			step: 0,
+			at:   30 * time.Second,
+			want: map[string]float64{
+				"prom.app.app_temp_celsius.cpu_0": 40,
+				"prom.app.app_gc_seconds.rate":    0,
+				"prom.app.app_gc_seconds.p50":     0.01,
+				"prom.app.app_gc_seconds.p99":     0.05,
+				"prom.app.scrape_up":              1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.set(tt.step, tt.fail)
+			got := sampleValues(c.scrapeTarget(context.Background(), tgt, tgt.opts, now.Add(tt.at)))
+			if _, ok := got["prom.app.scrape_duration_ms"]; !ok {
+				t.Errorf("scrape_duration_ms missing")
+			}
+			delete(got, "prom.app.scrape_duration_ms")
+			if len(got) != len(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if v, ok := got[name]; !ok || math.Abs(v-want) > 1e-9 {
+					t.Errorf("%s = %v (present %v), want %v", name, v, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPromScrapeMetricNames(t *testing.T) {
+	srv := newPromTestServer(t)
+	c := newTestPromScrape(t,
+		promTargetOptions{URL: srv.URL, Prefix: "a", Allowlist: []string{"app_temp_*"}},
+		promTargetOptions{URL: srv.URL, Prefix: "b", Allowlist: []string{"other_*"}},
+	)
+	if got, want := c.MetricNames(), []string{"prom.*.scrape_up", "prom.*.scrape_duration_ms"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("before a scrape: got %v, want %v", got, want)
+	}
+
+	samples, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	want := []string{
+		"prom.a.app_temp_celsius.cpu_0", "prom.a.scrape_duration_ms", "prom.a.scrape_up",
+		"prom.b.other_metric", "prom.b.scrape_duration_ms", "prom.b.scrape_up",
+	}
+	var got []string
+	for _, s := range samples {
+		got = append(got, s.MetricName)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("samples: got %v, want %v", got, want)
+	}
+	if got := c.MetricNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("names: got %v, want %v", got, want)
+	}
+
+	// Names follow the configured targets rather than accumulating.
+	raw, _ := json.Marshal(promScrapeOptions{Targets: []promTargetOptions{{URL: srv.URL, Prefix: "b", Allowlist: []string{"other_*"}}}})
+	if err := c.ApplyConfig(raw); err != nil {
+		t.Fatalf("ApplyConfig: %v", err)
+	}
+	if got, want := c.MetricNames(), want[3:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("after removing a target: got %v, want %v", got, want)
+	}
+}
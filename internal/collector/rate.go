@@ -0,0 +1,86 @@
+package collector
+
+// counterTracker converts successive readings of cumulative counters into
+// per-second rates. It is shared by every collector that derives rates from
+// monotonically increasing counters: kernel counters (network, disk, process
+// I/O) as uint64, and counters read as decimals (Docker stats, Prometheus
+// exporters, GPU sysfs files, log matches) as float64.
+//
+// A counter that goes backwards is treated as a restart: the interface was
+// reset, the device re-attached, the PID reused, or a 32-bit counter wrapped.
+// Without knowing the counter width a wrap cannot be told apart from a reset,
+// so both are handled the same way — no rate is produced for that cycle and
+// the new reading becomes the baseline.
+//
+// Keys that are not observed during a cycle are forgotten on commit, so a
+// vanished-then-reappeared interface starts from a fresh baseline instead of
+// being compared against a stale reading.
+//
+// Usage per collection cycle:
+//
+//	t.begin(now)
+//	if r, ok := t.rate(key, value); ok { ... }
+//	t.commit()
+type counterTracker[K comparable, V counterValue] struct {
+	prevTime int64
+	curTime  int64
+	prev     map[K]V
+	cur      map[K]V
+}
+
+// counterValue is the type of a counter reading.
+type counterValue interface {
+	~uint64 | ~float64
+}
+
+func newCounterTracker[K comparable, V counterValue]() *counterTracker[K, V] {
+	return &counterTracker[K, V]{}
+}
+
+// begin starts a new collection cycle at the given Unix timestamp.
+func (t *counterTracker[K, V]) begin(now int64) {
+	t.curTime = now
+	t.cur = make(map[K]V, len(t.prev))
+}
+
+// elapsed returns the seconds between the previous and the current cycle,
+// or 0 if there is no usable previous cycle.
+func (t *counterTracker[K, V]) elapsed() float64 {
+	if t.prevTime == 0 || t.curTime <= t.prevTime {
+		return 0
+	}
+	return float64(t.curTime - t.prevTime)
+}
+
+// delta records the current value for key and returns the increase since the
+// previous cycle. ok is false on the first observation of a key, when no time
+// has elapsed, or when the counter went backwards.
+func (t *counterTracker[K, V]) delta(key K, value V) (V, bool) {
+	t.cur[key] = value
+	if t.elapsed() <= 0 {
+		return 0, false
+	}
+	prev, ok := t.prev[key]
+	if !ok || value < prev {
+		return 0, false
+	}
+	return value - prev, true
+}
+
+// rate records the current value for key and returns the per-second rate since
+// the previous cycle, under the same conditions as delta.
+func (t *counterTracker[K, V]) rate(key K, value V) (float64, bool) {
+	d, ok := t.delta(key, value)
+	if !ok {
+		return 0, false
+	}
+	return float64(d) / t.elapsed(), true
+}
+
+// commit ends the cycle, making the values recorded since begin the baseline
+// for the next one. Keys not recorded in this cycle are dropped.
+func (t *counterTracker[K, V]) commit() {
+	t.prev = t.cur
+	t.prevTime = t.curTime
+	t.cur = nil
+}
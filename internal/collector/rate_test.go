@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+// rateReading is one counter value recorded in a cycle and the rate expected
+// back.
+type rateReading struct {
+	key    string
+	value  uint64
+	want   float64
+	wantOK bool
+}
+
+func TestCounterTracker(t *testing.T) {
+	type cycle struct {
+		now      int64
+		readings []rateReading
+	}
+	tests := []struct {
+		name   string
+		cycles []cycle
+	}{
+		{
+			name: "first sample has no rate",
+			cycles: []cycle{
+				{100, []rateReading{{key: "a", value: 500}}},
+				{110, []rateReading{{"a", 700, 20, true}, {key: "b", value: 1}}},
+				{115, []rateReading{{"a", 700, 0, true}, {"b", 11, 2, true}}},
+			},
+		},
+		{
+			// A reset gives no rate and becomes the baseline
+			name: "counter reset",
+			cycles: []cycle{
+				{100, []rateReading{{key: "a", value: 1000}}},
+				{110, []rateReading{{key: "a", value: 10}}},
+				{120, []rateReading{{"a", 30, 2, true}}},
+			},
+		},
+		{
+			name: "uint64 wraparound",
+			cycles: []cycle{
+				{100, []rateReading{{key: "a", value: math.MaxUint64 - 5}}},
+				{110, []rateReading{{key: "a", value: 10}}},
+				{120, []rateReading{{"a", 110, 10, true}}},
+			},
+		},
+		{
+			name: "32-bit wraparound",
+			cycles: []cycle{
+				{100, []rateReading{{key: "a", value: math.MaxUint32 - 5}}},
+				{110, []rateReading{{key: "a", value: 4}}},
+				{120, []rateReading{{"a", 14, 1, true}}},
+			},
+		},
+		{
+			// A key missing from a cycle is forgotten on commit, so it is
+			// not compared against a stale reading when it reappears
+			name: "keys are forgotten on commit",
+			cycles: []cycle{
+				{100, []rateReading{{key: "a", value: 100}, {key: "b", value: 100}}},
+				{110, []rateReading{{"b", 200, 10, true}}},
+				{120, []rateReading{{key: "a", value: 5000}, {"b", 300, 10, true}}},
+				{130, []rateReading{{"a", 5100, 10, true}}},
+			},
+		},
+		{
+			name: "no cycle without readings",
+			cycles: []cycle{
+				{100, []rateReading{{key: "a", value: 100}}},
+				{110, nil},
+				{120, []rateReading{{key: "a", value: 300}}},
+			},
+		},
+		{
+			// The clock standing still or going back gives no rate; the
+			// reading still becomes the baseline
+			name: "no time elapsed",
+			cycles: []cycle{
+				{100, []rateReading{{key: "a", value: 100}}},
+				{100, []rateReading{{key: "a", value: 200}}},
+				{90, []rateReading{{key: "a", value: 300}}},
+				{100, []rateReading{{"a", 400, 10, true}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newCounterTracker[string, uint64]()
+			for i, c := range tt.cycles {
+				tr.begin(c.now)
+				for _, r := range c.readings {
+					got, ok := tr.rate(r.key, r.value)
+					if got != r.want || ok != r.wantOK {
+						t.Errorf("cycle %d: rate(%s, %d) = %v, %v, want %v, %v", i, r.key, r.value, got, ok, r.want, r.wantOK)
+					}
+				}
+				tr.commit()
+				if len(tr.prev) != len(c.readings) {
+					t.Errorf("cycle %d: %d keys kept after commit, want %d", i, len(tr.prev), len(c.readings))
+				}
+			}
+		})
+	}
+}
+
+func TestCounterTrackerFloat(t *testing.T) {
+	tr := newCounterTracker[string, float64]()
+	tr.begin(100)
+	if _, ok := tr.delta("a", 1.5); ok {
+		t.Error("delta on the first sample")
+	}
+	tr.commit()
+
+	tr.begin(105)
+	if d, ok := tr.delta("a", 4); d != 2.5 || !ok {
+		t.Errorf("delta = %v, %v, want 2.5, true", d, ok)
+	}
+	tr.commit()
+
+	tr.begin(110)
+	if r, ok := tr.rate("a", 9); r != 1 || !ok {
+		t.Errorf("rate = %v, %v, want 1, true", r, ok)
+	}
+	tr.commit()
+
+	// A float counter that goes backwards is a restart too
+	tr.begin(115)
+	if d, ok := tr.delta("a", 0.5); ok {
+		t.Errorf("delta after a reset = %v, want none", d)
+	}
+	tr.commit()
+}
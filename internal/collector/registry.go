@@ -2,10 +2,13 @@ package collector
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/playok/only1mon/internal/model"
 	"github.com/playok/only1mon/internal/store"
@@ -16,8 +19,11 @@ type Registry struct {
 	mu                sync.RWMutex
 	collectors        map[string]Collector
 	enabled           map[string]bool
+	configs           map[string]model.CollectorConfig
+	health            map[string]*model.CollectorHealth
 	disabledMetrics   map[string]bool     // opt-out: only disabled metrics are tracked
 	discoveredMetrics map[string][]string  // collector ID → actual metric names from system
+	allowExec         bool
 	store             *store.Store
 }
 
@@ -26,6 +32,8 @@ func NewRegistry(s *store.Store) *Registry {
 	r := &Registry{
 		collectors:        make(map[string]Collector),
 		enabled:           make(map[string]bool),
+		configs:           make(map[string]model.CollectorConfig),
+		health:            make(map[string]*model.CollectorHealth),
 		disabledMetrics:   make(map[string]bool),
 		discoveredMetrics: make(map[string][]string),
 		store:             s,
@@ -40,7 +48,105 @@ func (r *Registry) Register(c Collector) {
 	r.collectors[c.ID()] = c
 }
 
-// RestoreState loads enabled states from the database.
+// AllowExec permits exec plugins to be created and restored. They run
+// arbitrary commands, so they are off unless enabled in the config.
+func (r *Registry) AllowExec(allow bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowExec = allow
+}
+
+// RegisterStored recreates the collectors added at runtime from their saved
+// state. Call it before RestoreState so their options are applied.
+func (r *Registry) RegisterStored() error {
+	states, err := r.store.GetAllCollectorStates()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range states {
+		if !IsExecCollectorID(s.CollectorID) {
+			continue
+		}
+		if !r.allowExec {
+			log.Printf("[registry] exec plugins are not allowed; skipping %s", s.CollectorID)
+			continue
+		}
+		c := NewExecCollector(strings.TrimPrefix(s.CollectorID, execIDPrefix))
+		r.collectors[c.ID()] = c
+	}
+	return nil
+}
+
+// Create adds a collector of the given type at runtime, applies its options
+// and interval, enables it and saves it to DB so it is recreated on restart.
+func (r *Registry) Create(typ, name string, interval int, options json.RawMessage) (string, error) {
+	if typ != ExecCollectorType {
+		return "", ErrUnknownCollectorType
+	}
+	if !execNameRe.MatchString(name) {
+		return "", ErrInvalidCollectorName
+	}
+	if interval < 0 {
+		return "", ErrInvalidInterval
+	}
+	c := NewExecCollector(name)
+	cc := c.(Configurable)
+	if err := validateConfig(cc.ConfigSchema(), options); err != nil {
+		return "", err
+	}
+	if err := cc.ApplyConfig(options); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	opts, err := json.Marshal(cc.Config())
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.allowExec {
+		return "", ErrExecNotAllowed
+	}
+	id := c.ID()
+	if _, ok := r.collectors[id]; ok {
+		return "", ErrCollectorExists
+	}
+	if err := r.saveConfig(id, model.CollectorConfig{Interval: interval, Options: opts}); err != nil {
+		return "", err
+	}
+	if err := r.store.SetCollectorEnabled(id, true); err != nil {
+		return "", err
+	}
+	r.collectors[id] = c
+	r.enabled[id] = true
+	return id, nil
+}
+
+// Remove unregisters a collector added at runtime and deletes its saved
+// state. Built-in collectors cannot be removed.
+func (r *Registry) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[id]; !ok {
+		return ErrCollectorNotFound
+	}
+	if !IsExecCollectorID(id) {
+		return ErrNotRemovable
+	}
+	if err := r.store.DeleteCollectorState(id); err != nil {
+		return err
+	}
+	delete(r.collectors, id)
+	delete(r.enabled, id)
+	delete(r.configs, id)
+	delete(r.health, id)
+	delete(r.discoveredMetrics, id)
+	return nil
+}
+
+// RestoreState loads enabled states and collector configs from the database.
 func (r *Registry) RestoreState() error {
 	states, err := r.store.GetAllCollectorStates()
 	if err != nil {
@@ -49,7 +155,36 @@ func (r *Registry) RestoreState() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	for _, s := range states {
-		r.enabled[s.CollectorID] = s.Enabled
+		// A config saved before any enable/disable is not an enabled state,
+		// so HasState still lets main enable configured listeners
+		if s.EnabledSet {
+			r.enabled[s.CollectorID] = s.Enabled
+		}
+		if s.ConfigJSON == "" {
+			continue
+		}
+		var cfg model.CollectorConfig
+		if err := json.Unmarshal([]byte(s.ConfigJSON), &cfg); err != nil {
+			log.Printf("[registry] invalid config for collector %s: %v", s.CollectorID, err)
+			continue
+		}
+		r.configs[s.CollectorID] = cfg
+
+		// Apply persisted options to the collector
+		if len(cfg.Options) == 0 {
+			continue
+		}
+		cc, ok := r.collectors[s.CollectorID].(Configurable)
+		if !ok {
+			continue
+		}
+		if err := validateConfig(cc.ConfigSchema(), cfg.Options); err != nil {
+			log.Printf("[registry] ignoring stored options for collector %s: %v", s.CollectorID, err)
+			continue
+		}
+		if err := cc.ApplyConfig(cfg.Options); err != nil {
+			log.Printf("[registry] ignoring stored options for collector %s: %v", s.CollectorID, err)
+		}
 	}
 	return nil
 }
@@ -83,6 +218,169 @@ func (r *Registry) IsEnabled(id string) bool {
 	return r.enabled[id]
 }
 
+// Interval returns the configured collection interval of a collector in
+// seconds, or 0 if it follows the global collect_interval.
+func (r *Registry) Interval(id string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.configs[id].Interval
+}
+
+// SetInterval sets the collection interval of a collector in seconds and
+// saves it to DB. 0 reverts to the global collect_interval.
+func (r *Registry) SetInterval(id string, sec int) error {
+	if sec < 0 {
+		return ErrInvalidInterval
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[id]; !ok {
+		return ErrCollectorNotFound
+	}
+	cfg := r.configs[id]
+	cfg.Interval = sec
+	return r.saveConfig(id, cfg)
+}
+
+// GetConfig returns the option schema and current options of a collector.
+func (r *Registry) GetConfig(id string) (ConfigSchema, interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.collectors[id]
+	if !ok {
+		return ConfigSchema{}, nil, ErrCollectorNotFound
+	}
+	cc, ok := c.(Configurable)
+	if !ok {
+		return ConfigSchema{}, nil, ErrNotConfigurable
+	}
+	return cc.ConfigSchema(), cc.Config(), nil
+}
+
+// HasOptions reports whether options for a collector have been saved to DB.
+func (r *Registry) HasOptions(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.configs[id].Options) > 0
+}
+
+// SetConfig validates and applies a collector's options and saves them to DB.
+// Options omitted from raw revert to their defaults.
+func (r *Registry) SetConfig(id string, raw json.RawMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cc, err := r.configurable(id)
+	if err != nil {
+		return err
+	}
+	return r.setConfig(id, cc, raw)
+}
+
+// configurable returns a configurable collector. Must be called with r.mu held.
+func (r *Registry) configurable(id string) (Configurable, error) {
+	c, ok := r.collectors[id]
+	if !ok {
+		return nil, ErrCollectorNotFound
+	}
+	cc, ok := c.(Configurable)
+	if !ok {
+		return nil, ErrNotConfigurable
+	}
+	return cc, nil
+}
+
+// setConfig implements SetConfig. Must be called with r.mu held.
+func (r *Registry) setConfig(id string, cc Configurable, raw json.RawMessage) error {
+	if err := validateConfig(cc.ConfigSchema(), raw); err != nil {
+		return err
+	}
+	if err := cc.ApplyConfig(raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	// Persist the normalized options as reported by the collector
+	opts, err := json.Marshal(cc.Config())
+	if err != nil {
+		return err
+	}
+	cfg := r.configs[id]
+	cfg.Options = opts
+	return r.saveConfig(id, cfg)
+}
+
+// MergeConfig updates selected options of a collector, keeping the others.
+// The lock is held throughout, so concurrent updates are not lost.
+func (r *Registry) MergeConfig(id string, patch map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cc, err := r.configurable(id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cc.Config())
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]interface{})
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return err
+	}
+	for k, v := range patch {
+		merged[k] = v
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return r.setConfig(id, cc, raw)
+}
+
+// saveConfig persists a collector config. Must be called with r.mu held.
+func (r *Registry) saveConfig(id string, cfg model.CollectorConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := r.store.SetCollectorConfig(id, string(data)); err != nil {
+		return err
+	}
+	r.configs[id] = cfg
+	return nil
+}
+
+// recordRun updates the health of a collector after a collection run and
+// returns the number of consecutive failed runs (0 on success).
+func (r *Registry) recordRun(id string, start time.Time, dur time.Duration, samples int, err error) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.health[id]
+	if !ok {
+		h = &model.CollectorHealth{}
+		r.health[id] = h
+	}
+	h.LastRun = start.Unix()
+	h.LastDurationMs = float64(dur) / float64(time.Millisecond)
+	h.LastSampleCount = samples
+	h.BackoffUntil = 0
+	if err != nil {
+		h.ConsecutiveErrors++
+		h.LastError = err.Error()
+		h.LastErrorTime = start.Unix()
+	} else {
+		h.ConsecutiveErrors = 0
+	}
+	return h.ConsecutiveErrors
+}
+
+// setBackoff records that runs of a collector are suspended until the given time.
+func (r *Registry) setBackoff(id string, until time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.health[id]; ok {
+		h.BackoffUntil = until.Unix()
+	}
+}
+
 // GetCollector returns a collector by ID.
 func (r *Registry) GetCollector(id string) (Collector, bool) {
 	r.mu.RLock()
@@ -103,6 +401,13 @@ func (r *Registry) DiscoverMetrics(ctx context.Context) {
 	r.mu.RUnlock()
 
 	for _, id := range ids {
+		// Exec plugins run external commands, possibly slow ones, and a
+		// discovery run of logwatch would consume the lines written while
+		// only1mon was stopped; their metric names are learned from their
+		// own scheduled runs instead.
+		if IsExecCollectorID(id) || id == LogWatchCollectorID {
+			continue
+		}
 		r.mu.RLock()
 		c := r.collectors[id]
 		r.mu.RUnlock()
@@ -307,8 +612,11 @@ func (r *Registry) ListCollectors() []model.CollectorInfo {
 			Impact:       c.Impact(),
 			Warning:      c.Warning(),
 			Enabled:      r.enabled[c.ID()],
+			Interval:     r.configs[c.ID()].Interval,
+			Configurable: isConfigurable(c),
 			Metrics:      metrics,
 			MetricStates: states,
+			Health:       r.healthCopy(c.ID()),
 		})
 	}
 	return result
@@ -327,6 +635,14 @@ func (r *Registry) EnabledCollectors() []Collector {
 	return result
 }
 
+// HasState reports whether an enabled state has been saved for a collector.
+func (r *Registry) HasState(id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.enabled[id]
+	return ok
+}
+
 // HasAnyState returns true if any collector state has been saved to DB.
 func (r *Registry) HasAnyState() bool {
 	r.mu.RLock()
@@ -334,20 +650,33 @@ func (r *Registry) HasAnyState() bool {
 	return len(r.enabled) > 0
 }
 
-// SetProcessTopN finds the process collector and sets topN.
-func (r *Registry) SetProcessTopN(n int) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	for _, c := range r.collectors {
-		if pc, ok := c.(*processCollector); ok {
-			pc.SetTopN(n)
-			return
-		}
+// healthCopy returns a snapshot of a collector's health, or nil if it has
+// not run yet. Must be called with r.mu held.
+func (r *Registry) healthCopy(id string) *model.CollectorHealth {
+	h, ok := r.health[id]
+	if !ok {
+		return nil
 	}
+	cp := *h
+	return &cp
+}
+
+func isConfigurable(c Collector) bool {
+	_, ok := c.(Configurable)
+	return ok
 }
 
 // errors
 var ErrCollectorNotFound = &CollectorError{"collector not found"}
+var ErrInvalidInterval = &CollectorError{"interval must be 0 or a positive number of seconds"}
+var ErrNotConfigurable = &CollectorError{"collector has no configurable options"}
+var ErrInvalidConfig = &CollectorError{"invalid collector config"}
+var ErrCollectorDisabled = &CollectorError{"collector is disabled"}
+var ErrCollectorExists = &CollectorError{"collector already exists"}
+var ErrUnknownCollectorType = &CollectorError{"unknown collector type"}
+var ErrInvalidCollectorName = &CollectorError{"name must be lowercase letters, digits, '_' or '-'"}
+var ErrExecNotAllowed = &CollectorError{"exec plugins are disabled; set allow_exec: true in config.yaml"}
+var ErrNotRemovable = &CollectorError{"built-in collectors cannot be removed"}
 
 type CollectorError struct {
 	msg string
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -10,34 +11,73 @@ import (
 	"github.com/playok/only1mon/internal/store"
 )
 
+const (
+	// collectTimeout bounds a single Collect call.
+	collectTimeout = 10 * time.Second
+	// backoffAfterErrors is the number of consecutive failures after which a
+	// collector is backed off.
+	backoffAfterErrors = 3
+	// maxBackoff caps the pause between runs of a failing collector.
+	maxBackoff = 10 * time.Minute
+	// selfCollectorID is the collector name attached to only1mon's own metrics.
+	selfCollectorID = "self"
+)
+
 // BroadcastFunc is called with collected samples for real-time streaming.
 type BroadcastFunc func(samples []model.MetricSample)
 
 // AlertBroadcastFunc is called with alerts generated from metric analysis.
 type AlertBroadcastFunc func(alerts []model.Alert)
 
-// Scheduler runs enabled collectors at a fixed interval.
+// Exporter forwards collected samples to an external system. Export is called
+// on the collection path for every batch and must not block.
+type Exporter interface {
+	Export(samples []model.MetricSample)
+}
+
+// Scheduler runs each enabled collector on its own interval. Collection ticks
+// are aligned to wall-clock multiples of the interval, so collectors sharing an
+// interval (or whose intervals divide each other) produce matching timestamps.
 type Scheduler struct {
 	registry       *Registry
 	store          *store.Store
-	interval       time.Duration
+	writer         *store.Writer // write-behind queue in front of store
+	interval       time.Duration // default interval for collectors without their own
 	broadcast      BroadcastFunc
 	alertBroadcast AlertBroadcastFunc
 	alertEngine    *AlertEngine
+	exporters      []Exporter
 	mu             sync.Mutex
 	cancel         context.CancelFunc
-	intervalCh     chan time.Duration // signals the loop to reset the ticker
+	wake           chan struct{} // signals the loop to re-plan collector runners
+	stopped        chan struct{} // closed when the loop and all runners have exited
+
+	latestMu sync.RWMutex
+	latest   map[string][]model.MetricSample // last batch per collector ID
+}
+
+// collectorRunner tracks the goroutine collecting from a single collector.
+type collectorRunner struct {
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{} // closed when the goroutine has exited
 }
 
 // NewScheduler creates a new scheduler.
 func NewScheduler(registry *Registry, s *store.Store, intervalSec int) *Scheduler {
-	return &Scheduler{
+	sched := &Scheduler{
 		registry:    registry,
 		store:       s,
+		writer:      store.NewWriter(s),
 		interval:    time.Duration(intervalSec) * time.Second,
 		alertEngine: NewAlertEngine(),
-		intervalCh:  make(chan time.Duration, 1),
+		wake:        make(chan struct{}, 1),
+		latest:      make(map[string][]model.MetricSample),
 	}
+	sched.alertEngine.staleAfter = func(id string) time.Duration {
+		return alertStaleIntervals * sched.collectorInterval(id)
+	}
+	return sched
 }
 
 // SetBroadcast sets the function called with each batch of samples.
@@ -54,52 +94,54 @@ func (s *Scheduler) SetAlertBroadcast(fn AlertBroadcastFunc) {
 	s.alertBroadcast = fn
 }
 
+// AddExporter registers an exporter to receive every batch of samples.
+func (s *Scheduler) AddExporter(e Exporter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exporters = append(s.exporters, e)
+}
+
 // AlertEngine returns the scheduler's alert engine for API access.
 func (s *Scheduler) AlertEngine() *AlertEngine {
 	return s.alertEngine
 }
 
+// Writer returns the scheduler's sample write queue.
+func (s *Scheduler) Writer() *store.Writer {
+	return s.writer
+}
+
 // Start begins the collection loop.
 func (s *Scheduler) Start(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
 	s.mu.Lock()
 	s.cancel = cancel
+	s.stopped = stopped
 	s.mu.Unlock()
 
-	go s.loop(ctx)
+	s.writer.Start()
+	go func() {
+		defer close(stopped)
+		s.loop(ctx)
+	}()
 }
 
-// Stop halts the scheduler.
+// Stop halts the scheduler, waits for in-flight collections to finish and
+// flushes the write queue.
 func (s *Scheduler) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.cancel != nil {
-		s.cancel()
-	}
-}
-
-// UpdateTopN updates the top-N process count on the process collector.
-func (s *Scheduler) UpdateTopN(n int) {
-	for _, c := range s.registry.EnabledCollectors() {
-		if pc, ok := c.(*processCollector); ok {
-			pc.SetTopN(n)
-			log.Printf("[scheduler] top_process_count updated to %d", n)
-			return
-		}
-	}
-	// Also check all registered collectors (even disabled ones)
-	s.registry.mu.RLock()
-	defer s.registry.mu.RUnlock()
-	for _, c := range s.registry.collectors {
-		if pc, ok := c.(*processCollector); ok {
-			pc.SetTopN(n)
-			log.Printf("[scheduler] top_process_count updated to %d", n)
-			return
-		}
+	cancel, stopped := s.cancel, s.stopped
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-stopped
 	}
+	s.writer.Close()
 }
 
-// UpdateInterval changes the collection interval at runtime.
+// UpdateInterval changes the default collection interval at runtime.
+// Collectors with their own interval are not affected.
 func (s *Scheduler) UpdateInterval(sec int) {
 	d := time.Duration(sec) * time.Second
 	if d < 1*time.Second {
@@ -109,108 +151,332 @@ func (s *Scheduler) UpdateInterval(sec int) {
 	s.interval = d
 	s.mu.Unlock()
 
-	// Non-blocking send to notify the loop
+	s.notify()
+	log.Printf("[scheduler] interval updated to %v", d)
+}
+
+// notify wakes the loop so it picks up enable/disable and interval changes
+// immediately instead of on its next periodic check.
+func (s *Scheduler) notify() {
 	select {
-	case s.intervalCh <- d:
+	case s.wake <- struct{}{}:
 	default:
 	}
-	log.Printf("[scheduler] interval updated to %v", d)
+}
+
+// collectorInterval returns the effective interval for a collector.
+func (s *Scheduler) collectorInterval(id string) time.Duration {
+	if sec := s.registry.Interval(id); sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
 }
 
 func (s *Scheduler) loop(ctx context.Context) {
-	ticker := time.NewTicker(s.interval)
+	runners := make(map[string]*collectorRunner)
+	defer func() {
+		for _, r := range runners {
+			r.cancel()
+		}
+		for _, r := range runners {
+			<-r.done
+		}
+	}()
+
+	// Enabled state and intervals can change through the API at any time;
+	// re-check them periodically so runners follow without explicit wiring.
+	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
-	// Run once immediately
-	s.collectAll(ctx)
+	s.reconcile(ctx, runners)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case newInterval := <-s.intervalCh:
-			ticker.Reset(newInterval)
+		case <-s.wake:
+			s.reconcile(ctx, runners)
 		case <-ticker.C:
-			s.collectAll(ctx)
+			s.reconcile(ctx, runners)
+			s.expireAlerts()
 		}
 	}
 }
 
-func (s *Scheduler) collectAll(ctx context.Context) {
-	collectors := s.registry.EnabledCollectors()
-	if len(collectors) == 0 {
-		return
+// reconcile starts runners for newly enabled collectors, stops runners of
+// disabled ones, and restarts runners whose interval has changed.
+func (s *Scheduler) reconcile(ctx context.Context, runners map[string]*collectorRunner) {
+	enabled := make(map[string]Collector)
+	for _, c := range s.registry.EnabledCollectors() {
+		if _, push := c.(PushCollector); push {
+			continue
+		}
+		enabled[c.ID()] = c
 	}
 
-	type result struct {
-		samples []model.MetricSample
-		err     error
-		id      string
+	for id, r := range runners {
+		if _, ok := enabled[id]; !ok {
+			r.cancel()
+			delete(runners, id)
+		}
 	}
 
-	results := make(chan result, len(collectors))
-	var wg sync.WaitGroup
+	for id, c := range enabled {
+		interval := s.collectorInterval(id)
+		var prevDone chan struct{}
+		immediate := true
+		if r, ok := runners[id]; ok {
+			if r.interval == interval {
+				continue
+			}
+			// Interval changed: replace the runner, waiting for the old one to
+			// finish so the collector is never called concurrently.
+			r.cancel()
+			prevDone = r.done
+			immediate = false
+			log.Printf("[scheduler] collector %s interval set to %v", id, interval)
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		r := &collectorRunner{interval: interval, cancel: cancel, done: make(chan struct{})}
+		runners[id] = r
+		go s.run(runCtx, c, r, prevDone, immediate)
+	}
+}
 
-	for _, c := range collectors {
-		wg.Add(1)
-		go func(col Collector) {
-			defer wg.Done()
-			collectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-			defer cancel()
+// run collects from a single collector at every wall-clock multiple of its
+// interval until ctx is cancelled. If immediate is set, it also collects once
+// right away so newly enabled collectors show data without waiting a full interval.
+func (s *Scheduler) run(ctx context.Context, c Collector, r *collectorRunner, prevDone <-chan struct{}, immediate bool) {
+	defer close(r.done)
 
-			samples, err := col.Collect(collectCtx)
-			results <- result{samples: samples, err: err, id: col.ID()}
-		}(c)
+	if prevDone != nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-prevDone:
+		}
 	}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+	var resumeAt time.Time
+	if immediate {
+		resumeAt = s.collect(ctx, c, time.Now(), r.interval)
+	}
 
-	var allSamples []model.MetricSample
-	for r := range results {
-		if r.err != nil {
-			log.Printf("[scheduler] collector %s error: %v", r.id, r.err)
-			continue
+	for {
+		// A failing collector skips boundaries until its backoff has passed
+		now := time.Now()
+		if resumeAt.After(now) {
+			now = resumeAt
+		}
+		next := nextBoundary(now, r.interval)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
 		}
-		allSamples = append(allSamples, r.samples...)
+		resumeAt = s.collect(ctx, c, next, r.interval)
 	}
+}
 
-	if len(allSamples) == 0 {
-		return
+// nextBoundary returns the first instant after now that is a whole multiple
+// of d since the Unix epoch.
+func nextBoundary(now time.Time, d time.Duration) time.Time {
+	step := int64(d)
+	return time.Unix(0, (now.UnixNano()/step+1)*step)
+}
+
+// collect runs one collector, records its health and feeds its samples
+// through the pipeline. Samples are stamped with tick, the scheduled boundary,
+// so that collectors running on the same boundary share timestamps regardless
+// of how long each one took.
+//
+// It returns the time before which the collector should not run again; this
+// is zero unless the collector has failed backoffAfterErrors times in a row.
+func (s *Scheduler) collect(ctx context.Context, c Collector, tick time.Time, interval time.Duration) time.Time {
+	id := c.ID()
+	ts := tick.Unix()
+
+	start := time.Now()
+	collectCtx, cancel := context.WithTimeout(ctx, collectTimeout)
+	samples, err := c.Collect(collectCtx)
+	cancel()
+	dur := time.Since(start)
+
+	if ctx.Err() != nil {
+		return time.Time{} // shutting down or runner replaced; not the collector's fault
 	}
 
+	errCount := s.registry.recordRun(id, start, dur, len(samples), err)
+
 	// Filter out disabled metrics
-	filtered := allSamples[:0]
-	for _, sample := range allSamples {
+	filtered := samples[:0]
+	if err == nil {
+		for _, sample := range samples {
+			if s.registry.IsMetricEnabled(sample.MetricName) {
+				sample.Timestamp = ts
+				filtered = append(filtered, sample)
+			}
+		}
+	}
+
+	// Self-metric: how long this collector took
+	durName := fmt.Sprintf("only1mon.collector.%s.duration_ms", id)
+	if s.registry.IsMetricEnabled(durName) {
+		filtered = append(filtered, makeSample(ts, selfCollectorID, durName, float64(dur)/float64(time.Millisecond)))
+	}
+
+	s.setLatest(id, filtered)
+	s.dispatch(filtered)
+
+	if err == nil {
+		return time.Time{}
+	}
+	if errCount < backoffAfterErrors {
+		log.Printf("[scheduler] collector %s error: %v", id, err)
+		return time.Time{}
+	}
+
+	// Exponential backoff: 2, 4, 8, ... intervals, capped at maxBackoff
+	backoff := interval << uint(min(errCount-backoffAfterErrors+1, 16))
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	until := time.Now().Add(backoff)
+	s.registry.setBackoff(id, until)
+	log.Printf("[scheduler] collector %s error (%d in a row), backing off for %v: %v", id, errCount, backoff, err)
+	return until
+}
+
+// setLatest replaces the latest batch recorded for a collector.
+func (s *Scheduler) setLatest(id string, samples []model.MetricSample) {
+	s.latestMu.Lock()
+	s.latest[id] = samples
+	s.latestMu.Unlock()
+}
+
+// mergeLatest updates the latest batch of a push collector: each push only
+// carries some of its series, so samples replace those with the same name and
+// labels and the rest are kept.
+func (s *Scheduler) mergeLatest(id string, samples []model.MetricSample) {
+	s.latestMu.Lock()
+	defer s.latestMu.Unlock()
+	type key struct{ name, labels string }
+	index := make(map[key]int)
+	batch := append([]model.MetricSample(nil), s.latest[id]...)
+	for i, m := range batch {
+		index[key{m.MetricName, m.Labels}] = i
+	}
+	for _, m := range samples {
+		k := key{m.MetricName, m.Labels}
+		if i, ok := index[k]; ok {
+			if m.Timestamp >= batch[i].Timestamp {
+				batch[i] = m
+			}
+			continue
+		}
+		index[k] = len(batch)
+		batch = append(batch, m)
+	}
+	s.latest[id] = batch
+}
+
+// Latest returns the samples of the most recent run of every enabled
+// collector, leaving out metrics disabled since. A collector whose last run
+// failed contributes nothing, so stale values are not reported as current.
+func (s *Scheduler) Latest() []model.MetricSample {
+	s.latestMu.RLock()
+	defer s.latestMu.RUnlock()
+	var out []model.MetricSample
+	for id, batch := range s.latest {
+		if !s.registry.IsEnabled(id) {
+			continue
+		}
+		for _, m := range batch {
+			if s.registry.IsMetricEnabled(m.MetricName) {
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+// Ingest feeds samples pushed to a PushCollector through the pipeline. Unlike
+// polled samples they keep their own timestamps. Disabled metrics are dropped;
+// the number of samples accepted is returned.
+func (s *Scheduler) Ingest(id string, samples []model.MetricSample) (int, error) {
+	c, ok := s.registry.GetCollector(id)
+	if !ok {
+		return 0, ErrCollectorNotFound
+	}
+	pc, ok := c.(PushCollector)
+	if !ok {
+		return 0, ErrCollectorNotFound
+	}
+	if !s.registry.IsEnabled(id) {
+		return 0, ErrCollectorDisabled
+	}
+
+	filtered := make([]model.MetricSample, 0, len(samples))
+	for _, sample := range samples {
 		if s.registry.IsMetricEnabled(sample.MetricName) {
+			sample.Collector = id
 			filtered = append(filtered, sample)
 		}
 	}
-	allSamples = filtered
+	pc.Observe(filtered)
+	s.registry.recordRun(id, time.Now(), 0, len(filtered), nil)
+	s.mergeLatest(id, filtered)
+	s.dispatch(filtered)
+	return len(filtered), nil
+}
 
-	if len(allSamples) == 0 {
+// expireAlerts resolves alerts on metrics that are no longer reported and
+// sends the remaining active set.
+func (s *Scheduler) expireAlerts() {
+	if !s.alertEngine.ExpireStale(time.Now().Unix()) {
 		return
 	}
+	s.mu.Lock()
+	alertFn := s.alertBroadcast
+	s.mu.Unlock()
+	if alertFn != nil {
+		alertFn(s.alertEngine.ActiveAlerts())
+	}
+}
 
-	// Store in DB
-	if err := s.store.InsertSamples(allSamples); err != nil {
-		log.Printf("[scheduler] store error: %v", err)
+// dispatch stores, broadcasts, exports and evaluates alerts for a batch of
+// samples.
+func (s *Scheduler) dispatch(samples []model.MetricSample) {
+	if len(samples) == 0 {
+		return
 	}
 
+	// Queue for the DB; the writer commits in batches off the collection path
+	s.writer.Enqueue(samples)
+
 	// Broadcast to WebSocket clients
 	s.mu.Lock()
 	fn := s.broadcast
 	alertFn := s.alertBroadcast
+	exporters := s.exporters
 	s.mu.Unlock()
 	if fn != nil {
-		fn(allSamples)
+		fn(samples)
+	}
+
+	// Forward to external systems (remote_write, ...)
+	for _, e := range exporters {
+		e.Export(samples)
 	}
 
-	// Evaluate alert rules
-	alerts := s.alertEngine.Evaluate(allSamples)
+	// Evaluate alert rules. Each batch only covers one collector, so send the
+	// full active set rather than just this batch's alerts.
+	alerts := s.alertEngine.Evaluate(samples)
 	if len(alerts) > 0 && alertFn != nil {
-		alertFn(alerts)
+		alertFn(s.alertEngine.ActiveAlerts())
 	}
 }
@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"os"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+	"github.com/playok/only1mon/internal/store"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// runtime/metrics keys read by the self collector.
+const (
+	rmGoroutines = "/sched/goroutines:goroutines"
+	rmHeapObjs   = "/memory/classes/heap/objects:bytes"
+	rmHeapGoal   = "/gc/heap/goal:bytes"
+	rmMemTotal   = "/memory/classes/total:bytes"
+	rmGCCycles   = "/gc/cycles/total:gc-cycles"
+	rmGCPauses   = "/sched/pauses/total/gc:seconds"
+)
+
+// WSStatsFunc reports the number of connected WebSocket clients and the
+// cumulative number of messages dropped for slow clients.
+type WSStatsFunc func() (clients int, dropped uint64)
+
+// SelfCollector reports only1mon's own resource usage: Go runtime stats,
+// process CPU and RSS, and internal store and WebSocket counters.
+type SelfCollector struct {
+	store  *store.Store
+	proc   *process.Process
+	rates  *counterTracker[string, uint64]
+	rmKeys []metrics.Sample
+
+	mu      sync.Mutex // guards wsStats and writer
+	wsStats WSStatsFunc
+	writer  *store.Writer
+
+	// previous cumulative write stats, for per-interval insert latency
+	prevWrites store.WriteStats
+}
+
+func NewSelfCollector(s *store.Store) *SelfCollector {
+	proc, _ := process.NewProcess(int32(os.Getpid()))
+	keys := []metrics.Sample{
+		{Name: rmGoroutines}, {Name: rmHeapObjs}, {Name: rmHeapGoal},
+		{Name: rmMemTotal}, {Name: rmGCCycles}, {Name: rmGCPauses},
+	}
+	return &SelfCollector{store: s, proc: proc, rates: newCounterTracker[string, uint64](), rmKeys: keys}
+}
+
+// SetWSStats wires the WebSocket hub counters into the collector.
+func (c *SelfCollector) SetWSStats(fn WSStatsFunc) {
+	c.mu.Lock()
+	c.wsStats = fn
+	c.mu.Unlock()
+}
+
+// SetWriter wires the sample write queue into the collector.
+func (c *SelfCollector) SetWriter(w *store.Writer) {
+	c.mu.Lock()
+	c.writer = w
+	c.mu.Unlock()
+}
+
+func (c *SelfCollector) ID() string   { return selfCollectorID }
+func (c *SelfCollector) Name() string { return "Only1Mon" }
+func (c *SelfCollector) Description() string {
+	return "only1mon's own runtime: goroutines, heap, GC pauses, CPU/RSS, DB writes and WebSocket clients"
+}
+func (c *SelfCollector) Impact() model.ImpactLevel { return model.ImpactNone }
+func (c *SelfCollector) Warning() string           { return "" }
+
+func (c *SelfCollector) MetricNames() []string {
+	return []string{
+		"only1mon.goroutines",
+		"only1mon.heap.alloc", "only1mon.heap.goal", "only1mon.mem.runtime_total",
+		"only1mon.gc.cycles", "only1mon.gc.pause_ms",
+		"only1mon.cpu.usage_pct", "only1mon.mem.rss",
+		"only1mon.store.samples_per_sec", "only1mon.store.insert_latency_ms",
+		"only1mon.store.db_size", "only1mon.store.wal_size",
+		"only1mon.store.queue_depth", "only1mon.store.dropped_samples", "only1mon.store.failed_samples",
+		"only1mon.ws.clients", "only1mon.ws.dropped",
+		"only1mon.collector.*.duration_ms",
+	}
+}
+
+func (c *SelfCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	now := time.Now().Unix()
+	var samples []model.MetricSample
+	add := func(name string, v float64) {
+		samples = append(samples, makeSample(now, selfCollectorID, name, v))
+	}
+
+	metrics.Read(c.rmKeys)
+	var gcPauseUs uint64
+	for _, s := range c.rmKeys {
+		switch s.Name {
+		case rmGoroutines:
+			add("only1mon.goroutines", float64(s.Value.Uint64()))
+		case rmHeapObjs:
+			add("only1mon.heap.alloc", float64(s.Value.Uint64()))
+		case rmHeapGoal:
+			add("only1mon.heap.goal", float64(s.Value.Uint64()))
+		case rmMemTotal:
+			add("only1mon.mem.runtime_total", float64(s.Value.Uint64()))
+		case rmGCCycles:
+			add("only1mon.gc.cycles", float64(s.Value.Uint64()))
+		case rmGCPauses:
+			if s.Value.Kind() == metrics.KindFloat64Histogram {
+				gcPauseUs = uint64(histogramSum(s.Value.Float64Histogram()) * 1e6)
+			}
+		}
+	}
+
+	c.rates.begin(now)
+	elapsed := c.rates.elapsed()
+
+	// GC pause time is a cumulative histogram; report the pause time spent
+	// during the last interval.
+	if r, ok := c.rates.rate("gc_pause_us", gcPauseUs); ok {
+		add("only1mon.gc.pause_ms", r*elapsed/1000)
+	}
+
+	if c.proc != nil {
+		if t, err := c.proc.TimesWithContext(ctx); err == nil {
+			cpuUs := uint64((t.User + t.System) * 1e6)
+			if r, ok := c.rates.rate("cpu_us", cpuUs); ok {
+				add("only1mon.cpu.usage_pct", r/1e4)
+			}
+		}
+		if mi, err := c.proc.MemoryInfoWithContext(ctx); err == nil {
+			add("only1mon.mem.rss", float64(mi.RSS))
+		}
+	}
+
+	if c.store != nil {
+		ws := c.store.WriteStats()
+		if r, ok := c.rates.rate("samples_written", ws.SamplesWritten); ok {
+			add("only1mon.store.samples_per_sec", r)
+		}
+		if ws.Inserts > c.prevWrites.Inserts {
+			n := ws.Inserts - c.prevWrites.Inserts
+			avg := float64(ws.InsertNanos-c.prevWrites.InsertNanos) / float64(n)
+			add("only1mon.store.insert_latency_ms", avg/float64(time.Millisecond))
+		}
+		c.prevWrites = ws
+
+		dbSize, walSize := c.store.FileSizes()
+		add("only1mon.store.db_size", float64(dbSize))
+		add("only1mon.store.wal_size", float64(walSize))
+	}
+	c.rates.commit()
+
+	c.mu.Lock()
+	wsStats, writer := c.wsStats, c.writer
+	c.mu.Unlock()
+	if writer != nil {
+		st := writer.Stats()
+		add("only1mon.store.queue_depth", float64(st.Queued))
+		add("only1mon.store.dropped_samples", float64(st.Dropped))
+		add("only1mon.store.failed_samples", float64(st.Failed))
+	}
+	if wsStats != nil {
+		clients, dropped := wsStats()
+		add("only1mon.ws.clients", float64(clients))
+		add("only1mon.ws.dropped", float64(dropped))
+	}
+
+	return samples, nil
+}
+
+// histogramSum approximates the sum of all observations in a runtime/metrics
+// histogram using each bucket's midpoint (or its finite edge for the open
+// -Inf/+Inf buckets).
+func histogramSum(h *metrics.Float64Histogram) float64 {
+	var sum float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		var mid float64
+		switch {
+		case math.IsInf(lo, -1):
+			mid = hi
+		case math.IsInf(hi, 1):
+			mid = lo
+		default:
+			mid = (lo + hi) / 2
+		}
+		sum += mid * float64(n)
+	}
+	return sum
+}
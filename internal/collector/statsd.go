@@ -0,0 +1,370 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+	"github.com/playok/only1mon/internal/store"
+)
+
+const (
+	// StatsDCollectorID is the collector ID of the StatsD listener.
+	StatsDCollectorID = "statsd"
+	// statsdMaxKeys bounds the distinct series aggregated; lines for new
+	// series beyond it are dropped.
+	statsdMaxKeys = 10000
+	// statsdMaxTimerValues bounds the timer values kept per series and
+	// interval for percentiles; further values still count.
+	statsdMaxTimerValues = 10000
+	// statsdIdleIntervals is the number of collections without an update
+	// after which a counter or gauge is forgotten.
+	statsdIdleIntervals = 10
+)
+
+// statsdKey identifies one aggregated StatsD series: the metric name and its
+// DogStatsD tags rendered as labels.
+type statsdKey struct {
+	name   string
+	labels string
+}
+
+// statsdValue is the value of a counter or gauge and the number of
+// collections since it was last updated.
+type statsdValue struct {
+	v    float64
+	idle int
+}
+
+// statsdTimer accumulates timer/histogram/distribution values of one interval.
+type statsdTimer struct {
+	values []float64
+	count  float64 // scaled by sample rate
+}
+
+// StatsDCollector listens for StatsD (and DogStatsD) lines over UDP and
+// aggregates them per collection interval:
+//
+//	counter   statsd.<name>.count, statsd.<name>.rate (per second)
+//	gauge     statsd.<name> (kept until updated)
+//	timer     statsd.<name>.timer.count, .timer.p50, .timer.p95, .timer.p99
+//	          (ms, h and d types)
+//	set       statsd.<name>.unique
+//
+// Counters and gauges not updated for statsdIdleIntervals collections are
+// forgotten, so series of clients that went away stop being reported.
+// DogStatsD tags (|#k:v,...) become the sample labels as sorted k=v pairs.
+type StatsDCollector struct {
+	addr string
+	conn net.PacketConn
+	done chan struct{}
+
+	mu       sync.Mutex
+	counters map[statsdKey]*statsdValue
+	gauges   map[statsdKey]*statsdValue
+	timers   map[statsdKey]*statsdTimer
+	sets     map[statsdKey]map[string]bool
+	names    map[string]bool // metric names reported so far
+	dropped  int             // lines dropped since the last Collect
+	lastRun  time.Time
+}
+
+func NewStatsDCollector(addr string) *StatsDCollector {
+	return &StatsDCollector{
+		addr:     addr,
+		done:     make(chan struct{}),
+		counters: make(map[statsdKey]*statsdValue),
+		gauges:   make(map[statsdKey]*statsdValue),
+		timers:   make(map[statsdKey]*statsdTimer),
+		sets:     make(map[statsdKey]map[string]bool),
+		names:    make(map[string]bool),
+	}
+}
+
+func (c *StatsDCollector) ID() string   { return StatsDCollectorID }
+func (c *StatsDCollector) Name() string { return "StatsD" }
+func (c *StatsDCollector) Description() string {
+	return "Counters, gauges, timers and sets received by the StatsD listener on " + c.addr
+}
+func (c *StatsDCollector) Impact() model.ImpactLevel { return model.ImpactLow }
+func (c *StatsDCollector) Warning() string {
+	return fmt.Sprintf("Series beyond %d distinct names and tag sets are dropped", statsdMaxKeys)
+}
+
+func (c *StatsDCollector) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.names))
+	for n := range c.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start binds the UDP listener and begins receiving.
+func (c *StatsDCollector) Start() error {
+	conn, err := net.ListenPacket("udp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	go c.readLoop()
+	return nil
+}
+
+// Close stops the listener.
+func (c *StatsDCollector) Close() {
+	if c.conn == nil {
+		return
+	}
+	c.conn.Close()
+	<-c.done
+}
+
+func (c *StatsDCollector) readLoop() {
+	defer close(c.done)
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[statsd] read error: %v", err)
+			continue
+		}
+		c.handlePacket(string(buf[:n]))
+	}
+}
+
+// handlePacket parses the newline-separated lines of one datagram.
+func (c *StatsDCollector) handlePacket(packet string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := c.handleLine(line); err != nil {
+			c.dropped++
+		}
+	}
+}
+
+// handleLine parses name:value[:value...]|type[|@rate][|#tags] and adds it to
+// the current interval. Must be called with c.mu held.
+func (c *StatsDCollector) handleLine(line string) error {
+	fields := strings.Split(line, "|")
+	if len(fields) < 2 {
+		return fmt.Errorf("missing type")
+	}
+	name, values, ok := strings.Cut(fields[0], ":")
+	if !ok {
+		return fmt.Errorf("missing value")
+	}
+	name = sanitizeMetricName(name)
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	typ := fields[1]
+	switch typ {
+	case "c", "g", "ms", "h", "d", "s":
+	default:
+		return fmt.Errorf("unknown type %q", typ)
+	}
+	rate := 1.0
+	var tags []string
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			r, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || r <= 0 || r > 1 {
+				return fmt.Errorf("bad sample rate %q", f)
+			}
+			rate = r
+		case strings.HasPrefix(f, "#"):
+			tags = strings.Split(f[1:], ",")
+		}
+	}
+
+	// Parse every value before applying any, so that a bad value drops the
+	// whole line rather than the values after it.
+	raw := strings.Split(values, ":")
+	nums := make([]float64, len(raw))
+	if typ != "s" {
+		for i, v := range raw {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return fmt.Errorf("bad value %q", v)
+			}
+			nums[i] = f
+		}
+	}
+	key := statsdKey{name: name, labels: statsdLabels(tags)}
+	if !c.known(key, typ) && c.keyCount() >= statsdMaxKeys {
+		return fmt.Errorf("too many series")
+	}
+
+	for i, v := range raw {
+		f := nums[i]
+		switch typ {
+		case "s":
+			set := c.sets[key]
+			if set == nil {
+				set = make(map[string]bool)
+				c.sets[key] = set
+			}
+			set[v] = true
+		case "c":
+			statsdUpdate(c.counters, key).v += f / rate
+		case "g":
+			// A signed value adjusts the gauge; an unsigned one sets it.
+			g := statsdUpdate(c.gauges, key)
+			if strings.HasPrefix(v, "+") || strings.HasPrefix(v, "-") {
+				g.v += f
+			} else {
+				g.v = f
+			}
+		case "ms", "h", "d":
+			t := c.timers[key]
+			if t == nil {
+				t = &statsdTimer{}
+				c.timers[key] = t
+			}
+			if len(t.values) < statsdMaxTimerValues {
+				t.values = append(t.values, f)
+			}
+			t.count += 1 / rate
+		}
+	}
+	return nil
+}
+
+// statsdUpdate returns the value of key in m, creating it, and marks it as
+// updated in the current interval.
+func statsdUpdate(m map[statsdKey]*statsdValue, key statsdKey) *statsdValue {
+	sv := m[key]
+	if sv == nil {
+		sv = &statsdValue{}
+		m[key] = sv
+	}
+	sv.idle = 0
+	return sv
+}
+
+// known reports whether the series of key and typ is already tracked.
+func (c *StatsDCollector) known(key statsdKey, typ string) bool {
+	var ok bool
+	switch typ {
+	case "c":
+		_, ok = c.counters[key]
+	case "g":
+		_, ok = c.gauges[key]
+	case "ms", "h", "d":
+		_, ok = c.timers[key]
+	case "s":
+		_, ok = c.sets[key]
+	}
+	return ok
+}
+
+func (c *StatsDCollector) keyCount() int {
+	return len(c.counters) + len(c.gauges) + len(c.timers) + len(c.sets)
+}
+
+// Collect emits the aggregates of the interval since the previous call and
+// starts a new one. Counters seen before report 0 when idle; gauges keep
+// their last value. Both are dropped after statsdIdleIntervals idle
+// collections.
+func (c *StatsDCollector) Collect(ctx context.Context) ([]model.MetricSample, error) {
+	return c.collect(time.Now()), nil
+}
+
+func (c *StatsDCollector) collect(now time.Time) []model.MetricSample {
+	ts := now.Unix()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elapsed := now.Sub(c.lastRun).Seconds()
+	if c.lastRun.IsZero() {
+		elapsed = 0
+	}
+	c.lastRun = now
+
+	var samples []model.MetricSample
+	add := func(key statsdKey, suffix string, v float64) {
+		name := "statsd." + key.name + suffix
+		c.names[name] = true
+		samples = append(samples, model.MetricSample{
+			Timestamp: ts, Collector: StatsDCollectorID, MetricName: name, Value: v, Labels: key.labels,
+		})
+	}
+
+	for key, sv := range c.counters {
+		if sv.idle >= statsdIdleIntervals {
+			delete(c.counters, key)
+			continue
+		}
+		add(key, ".count", sv.v)
+		if elapsed > 0 {
+			add(key, ".rate", sv.v/elapsed)
+		}
+		sv.v = 0
+		sv.idle++
+	}
+	for key, sv := range c.gauges {
+		if sv.idle >= statsdIdleIntervals {
+			delete(c.gauges, key)
+			continue
+		}
+		add(key, "", sv.v)
+		sv.idle++
+	}
+	for key, t := range c.timers {
+		add(key, ".timer.count", t.count)
+		sort.Float64s(t.values)
+		add(key, ".timer.p50", store.Percentile(t.values, 0.50))
+		add(key, ".timer.p95", store.Percentile(t.values, 0.95))
+		add(key, ".timer.p99", store.Percentile(t.values, 0.99))
+	}
+	for key, set := range c.sets {
+		add(key, ".unique", float64(len(set)))
+	}
+	c.timers = make(map[statsdKey]*statsdTimer)
+	c.sets = make(map[statsdKey]map[string]bool)
+
+	if c.dropped > 0 {
+		log.Printf("[statsd] dropped %d malformed or over-limit lines", c.dropped)
+		c.dropped = 0
+	}
+	return samples
+}
+
+// statsdLabels renders DogStatsD tags as sorted k=v pairs; a tag without a
+// value is kept as is.
+func statsdLabels(tags []string) string {
+	pairs := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if k, v, ok := strings.Cut(t, ":"); ok {
+			t = k + "=" + v
+		}
+		pairs = append(pairs, t)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,256 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// statsdSeries maps "name" or "name{labels}" to the sample value.
+func statsdSeries(samples []model.MetricSample) map[string]float64 {
+	m := make(map[string]float64, len(samples))
+	for _, s := range samples {
+		key := s.MetricName
+		if s.Labels != "" {
+			key += "{" + s.Labels + "}"
+		}
+		m[key] = s.Value
+	}
+	return m
+}
+
+func checkStatsdSeries(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for name, w := range want {
+		if v, ok := got[name]; !ok || math.Abs(v-w) > 1e-9 {
+			t.Errorf("%s = %v (present %v), want %v", name, v, ok, w)
+		}
+	}
+}
+
+func TestStatsDLines(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		lines   []string
+		want    map[string]float64 // collected 10s after the previous collection
+		dropped int
+	}{
+		{
+			name:  "counter",
+			lines: []string{"hits:1|c", "hits:2|c"},
+			want:  map[string]float64{"statsd.hits.count": 3, "statsd.hits.rate": 0.3},
+		},
+		{
+			name:  "counter with multiple values",
+			lines: []string{"hits:1:2:3|c"},
+			want:  map[string]float64{"statsd.hits.count": 6, "statsd.hits.rate": 0.6},
+		},
+		{
+			name:  "counter sample rate",
+			lines: []string{"hits:1|c|@0.1", "hits:2|c|@0.5"},
+			want:  map[string]float64{"statsd.hits.count": 14, "statsd.hits.rate": 1.4},
+		},
+		{
+			name:  "gauge keeps the last value",
+			lines: []string{"temp:20|g", "temp:25.5|g"},
+			want:  map[string]float64{"statsd.temp": 25.5},
+		},
+		{
+			name:  "signed gauges adjust",
+			lines: []string{"temp:20|g", "temp:+5|g", "temp:-7.5|g"},
+			want:  map[string]float64{"statsd.temp": 17.5},
+		},
+		{
+			name:  "signed gauge without a previous value",
+			lines: []string{"temp:-5|g"},
+			want:  map[string]float64{"statsd.temp": -5},
+		},
+		{
+			name:  "unsigned gauge after a signed one resets it",
+			lines: []string{"temp:+5|g", "temp:3|g"},
+			want:  map[string]float64{"statsd.temp": 3},
+		},
+		{
+			name:  "timer percentiles",
+			lines: []string{"lat:30|ms", "lat:10:50|ms", "lat:20|h", "lat:40|d"},
+			want: map[string]float64{
+				"statsd.lat.timer.count": 5,
+				"statsd.lat.timer.p50":   30,
+				"statsd.lat.timer.p95":   48,
+				"statsd.lat.timer.p99":   49.6,
+			},
+		},
+		{
+			name:  "timer sample rate scales the count only",
+			lines: []string{"lat:10|ms|@0.5", "lat:20|ms|@0.5"},
+			want: map[string]float64{
+				"statsd.lat.timer.count": 4,
+				"statsd.lat.timer.p50":   15,
+				"statsd.lat.timer.p95":   19.5,
+				"statsd.lat.timer.p99":   19.9,
+			},
+		},
+		{
+			// A counter and a timer of the same name do not share series
+			name:  "counter and timer of one name",
+			lines: []string{"api:2|c", "api:7|ms"},
+			want: map[string]float64{
+				"statsd.api.count":       2,
+				"statsd.api.rate":        0.2,
+				"statsd.api.timer.count": 1,
+				"statsd.api.timer.p50":   7,
+				"statsd.api.timer.p95":   7,
+				"statsd.api.timer.p99":   7,
+			},
+		},
+		{
+			name:  "set",
+			lines: []string{"users:alice|s", "users:bob:alice|s", "users:carol|s"},
+			want:  map[string]float64{"statsd.users.unique": 3},
+		},
+		{
+			name: "DogStatsD tags",
+			lines: []string{
+				"req:1|c|#route:/users,env:prod",
+				"req:2|c|@0.5|#env:prod,route:/users",
+				"req:1|c|#canary, env:dev",
+				"req:1|c",
+			},
+			want: map[string]float64{
+				"statsd.req.count{env=prod,route=/users}": 5,
+				"statsd.req.rate{env=prod,route=/users}":  0.5,
+				"statsd.req.count{canary,env=dev}":        1,
+				"statsd.req.rate{canary,env=dev}":         0.1,
+				"statsd.req.count":                        1,
+				"statsd.req.rate":                         0.1,
+			},
+		},
+		{
+			name:  "names are sanitized",
+			lines: []string{"my app..hits/sec:1|c"},
+			want:  map[string]float64{"statsd.my_app.hits_sec.count": 1, "statsd.my_app.hits_sec.rate": 0.1},
+		},
+		{
+			name: "malformed lines are dropped whole",
+			lines: []string{
+				"hits|c",       // missing value
+				"hits:1",       // missing type
+				"hits:x|c",     // bad value
+				"hits:1:x|c",   // bad second value; the first is not added
+				"hits:NaN|c",   // not a number
+				"hits:+Inf|g",  // infinite
+				"hits:1|q",     // unknown type
+				"hits:1|c|@2",  // sample rate above 1
+				"hits:1|c|@0",  // sample rate 0
+				"...:1|c",      // empty name
+				"temp:|g",      // empty value
+				"lat:1:2:z|ms", // bad third value
+			},
+			want:    map[string]float64{},
+			dropped: 12,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewStatsDCollector(":0")
+			c.collect(t0)
+			c.handlePacket(strings.Join(tt.lines, "\n") + "\n\n")
+			if c.dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", c.dropped, tt.dropped)
+			}
+			checkStatsdSeries(t, statsdSeries(c.collect(t0.Add(10*time.Second))), tt.want)
+		})
+	}
+}
+
+func TestStatsDIntervals(t *testing.T) {
+	c := NewStatsDCollector(":0")
+	t0 := time.Unix(1700000000, 0)
+	c.handlePacket("hits:5|c\ntemp:20|g\nlat:10|ms\nusers:a|s")
+
+	// The first collection has no rate
+	checkStatsdSeries(t, statsdSeries(c.collect(t0)), map[string]float64{
+		"statsd.hits.count":      5,
+		"statsd.temp":            20,
+		"statsd.lat.timer.count": 1,
+		"statsd.lat.timer.p50":   10,
+		"statsd.lat.timer.p95":   10,
+		"statsd.lat.timer.p99":   10,
+		"statsd.users.unique":    1,
+	})
+
+	// Idle counters report 0, gauges keep their value, timers and sets
+	// start over
+	idle := map[string]float64{"statsd.hits.count": 0, "statsd.hits.rate": 0, "statsd.temp": 20}
+	checkStatsdSeries(t, statsdSeries(c.collect(t0.Add(10*time.Second))), idle)
+
+	c.handlePacket("temp:+1|g")
+	checkStatsdSeries(t, statsdSeries(c.collect(t0.Add(20*time.Second))), map[string]float64{
+		"statsd.hits.count": 0, "statsd.hits.rate": 0, "statsd.temp": 21,
+	})
+
+	// Each is forgotten after statsdIdleIntervals collections without an
+	// update: the counter was last updated before the first collection, the
+	// gauge before the third.
+	ts := t0.Add(20 * time.Second)
+	for n := 4; n <= 2+statsdIdleIntervals; n++ {
+		ts = ts.Add(10 * time.Second)
+		want := map[string]float64{"statsd.temp": 21}
+		if n <= statsdIdleIntervals {
+			want["statsd.hits.count"], want["statsd.hits.rate"] = 0, 0
+		}
+		checkStatsdSeries(t, statsdSeries(c.collect(ts)), want)
+	}
+	ts = ts.Add(10 * time.Second)
+	checkStatsdSeries(t, statsdSeries(c.collect(ts)), map[string]float64{})
+
+	want := []string{
+		"statsd.hits.count", "statsd.hits.rate", "statsd.lat.timer.count", "statsd.lat.timer.p50",
+		"statsd.lat.timer.p95", "statsd.lat.timer.p99", "statsd.temp", "statsd.users.unique",
+	}
+	if got := c.MetricNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("MetricNames = %v, want %v", got, want)
+	}
+}
+
+func TestStatsDKeyLimit(t *testing.T) {
+	c := NewStatsDCollector(":0")
+	for i := range statsdMaxKeys {
+		if err := c.handleLine(fmt.Sprintf("k%d:1|c", i)); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+	}
+	tests := []struct {
+		line    string
+		wantErr bool
+	}{
+		{"k0:1|c", false},            // existing series
+		{"k0:1|c|@0.5", false},       // the sample rate is not part of the series
+		{"new:1|c", true},            // new name
+		{"k0:1|c|#env:prod", true},   // new tag set
+		{"k0:1|g", true},             // same name as another type
+		{"k0:1|x", true},             // malformed
+		{"k9999:1:2:3|c", false},     // last series still accepted
+		{"k10000:1|c", true},         // one beyond the limit
+		{"k0:1|c|#", false},          // empty tags are no labels
+		{"k0:5|c|#,", false},         // only separators
+		{"k0:bad|c|#env:prod", true}, // bad value and new tags
+	}
+	for _, tt := range tests {
+		if err := c.handleLine(tt.line); (err != nil) != tt.wantErr {
+			t.Errorf("handleLine(%q) = %v, want error %v", tt.line, err, tt.wantErr)
+		}
+	}
+	if got := c.counters[statsdKey{name: "k0"}].v; got != 10 {
+		t.Errorf("k0 = %v, want 10", got)
+	}
+}
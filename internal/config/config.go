@@ -17,6 +17,30 @@ type Config struct {
 	PidFile  string `yaml:"pid_file"`
 	LogFile  string `yaml:"log_file"`
 
+	// QueryTimeout bounds each history/metadata read query, in seconds (0 = none).
+	QueryTimeout int `yaml:"query_timeout"`
+	// MaxQuerySeries caps the series one history query may select (0 = none).
+	MaxQuerySeries int `yaml:"max_query_series"`
+	// MaxQueryPoints caps the points per series in one history query; longer
+	// ranges are downsampled automatically (0 = none).
+	MaxQueryPoints int `yaml:"max_query_points"`
+
+	// AllowExec permits exec plugin collectors, which run arbitrary commands
+	// and can be added through the API.
+	AllowExec bool `yaml:"allow_exec"`
+
+	// RemoteWrite forwards collected samples to a Prometheus remote_write
+	// endpoint when URL is set.
+	RemoteWrite RemoteWriteConfig `yaml:"remote_write"`
+
+	// StatsD runs a StatsD listener feeding the statsd collector when Listen
+	// is set.
+	StatsD StatsDConfig `yaml:"statsd"`
+
+	// Graphite runs a Graphite plaintext listener feeding the graphite
+	// collector when Listen is set.
+	Graphite GraphiteConfig `yaml:"graphite"`
+
 	// Runtime settings (managed via UI / DB, not in YAML)
 	CollectInterval int `yaml:"-"`
 	RetentionHours  int `yaml:"-"`
@@ -25,6 +49,35 @@ type Config struct {
 	ConfigPath string `yaml:"-"`
 }
 
+// RemoteWriteConfig configures the Prometheus remote_write exporter.
+type RemoteWriteConfig struct {
+	URL string `yaml:"url"`
+	// Host is the value of the host label added to every series
+	// (default: the machine's hostname).
+	Host string `yaml:"host"`
+	// Headers are added to every request, e.g. Authorization.
+	Headers map[string]string `yaml:"headers"`
+	// BatchInterval is how often buffered samples are sent, in seconds.
+	BatchInterval int `yaml:"batch_interval"`
+	// Timeout bounds each request, in seconds.
+	Timeout int `yaml:"timeout"`
+	// MaxQueue caps the payloads kept on disk while the endpoint is
+	// unreachable; the oldest are dropped beyond it (0 = none).
+	MaxQueue int `yaml:"max_queue"`
+}
+
+// StatsDConfig configures the StatsD listener.
+type StatsDConfig struct {
+	// Listen is the UDP address to receive StatsD lines on, e.g. ":8125".
+	Listen string `yaml:"listen"`
+}
+
+// GraphiteConfig configures the Graphite plaintext listener.
+type GraphiteConfig struct {
+	// Listen is the TCP address to accept Graphite lines on, e.g. ":2003".
+	Listen string `yaml:"listen"`
+}
+
 // DefaultConfig returns the default configuration.
 func DefaultConfig() *Config {
 	return &Config{
@@ -33,9 +86,17 @@ func DefaultConfig() *Config {
 		BasePath:        "/",
 		PidFile:         "only1mon.pid",
 		LogFile:         "only1mon.log",
+		QueryTimeout:    30,
+		MaxQuerySeries:  500,
+		MaxQueryPoints:  11000,
 		CollectInterval: 5,
 		RetentionHours:  24,
 		ConfigPath:      "config.yaml",
+		RemoteWrite: RemoteWriteConfig{
+			BatchInterval: 5,
+			Timeout:       10,
+			MaxQueue:      10000,
+		},
 	}
 }
 
@@ -76,6 +137,9 @@ func Load() *Config {
 	if v := os.Getenv("ONLY1MON_BASE_PATH"); v != "" {
 		cfg.BasePath = v
 	}
+	if v := os.Getenv("ONLY1MON_REMOTE_WRITE_URL"); v != "" {
+		cfg.RemoteWrite.URL = v
+	}
 
 	// 4) Flags override everything
 	flag.StringVar(&cfg.ConfigPath, "config", cfg.ConfigPath, "Path to config.yaml")
@@ -84,6 +148,13 @@ func Load() *Config {
 	flag.StringVar(&cfg.BasePath, "base-path", cfg.BasePath, "Base URL path for reverse proxy")
 	flag.StringVar(&cfg.PidFile, "pid-file", cfg.PidFile, "PID file path")
 	flag.StringVar(&cfg.LogFile, "log-file", cfg.LogFile, "Log file path")
+	flag.IntVar(&cfg.QueryTimeout, "query-timeout", cfg.QueryTimeout, "Per-query timeout in seconds for history reads (0 = none)")
+	flag.IntVar(&cfg.MaxQuerySeries, "max-query-series", cfg.MaxQuerySeries, "Maximum series a single history query may select (0 = none)")
+	flag.IntVar(&cfg.MaxQueryPoints, "max-query-points", cfg.MaxQueryPoints, "Maximum points per series in a history query; longer ranges are downsampled (0 = none)")
+	flag.BoolVar(&cfg.AllowExec, "allow-exec", cfg.AllowExec, "Allow exec plugin collectors that run external commands")
+	flag.StringVar(&cfg.RemoteWrite.URL, "remote-write-url", cfg.RemoteWrite.URL, "Prometheus remote_write endpoint to forward samples to (empty = disabled)")
+	flag.StringVar(&cfg.StatsD.Listen, "statsd-listen", cfg.StatsD.Listen, "UDP address for the StatsD listener, e.g. :8125 (empty = disabled)")
+	flag.StringVar(&cfg.Graphite.Listen, "graphite-listen", cfg.Graphite.Listen, "TCP address for the Graphite plaintext listener, e.g. :2003 (empty = disabled)")
 	flag.Parse()
 
 	// Normalize base_path
@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/playok/only1mon/internal/collector"
+	"github.com/playok/only1mon/internal/model"
+)
+
+// The remote_write payload is a prometheus.WriteRequest protobuf message.
+// Only the fields needed to send samples are encoded, by hand, to avoid
+// pulling in a protobuf runtime:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; } // ms since epoch
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type timeSeries struct {
+	labels  [][2]string // sorted by name
+	samples []model.MetricSample
+}
+
+// encodeWriteRequest groups samples into series and encodes them. Every series
+// gets a __name__ label plus the labels derived from the dotted metric name;
+// hostLabel is added when its value is not empty, followed by the sample's own
+// labels.
+func encodeWriteRequest(samples []model.MetricSample, hostLabel [2]string) []byte {
+	series := map[string]*timeSeries{}
+	var keys []string
+	for _, m := range samples {
+		name, labels := collector.PromName(m.MetricName)
+		labels = append(labels, [2]string{"__name__", name})
+		if hostLabel[1] != "" {
+			labels = append(labels, hostLabel)
+		}
+		// After the host label, so a sample's own host label is renamed
+		// rather than duplicated, which receivers reject
+		labels = collector.PromSampleLabels(labels, m.Labels)
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+		key := ""
+		for _, l := range labels {
+			key += l[0] + "\xff" + l[1] + "\xff"
+		}
+		ts := series[key]
+		if ts == nil {
+			ts = &timeSeries{labels: labels}
+			series[key] = ts
+			keys = append(keys, key)
+		}
+		ts.samples = append(ts.samples, m)
+	}
+
+	var buf, tsBuf, msgBuf []byte
+	for _, key := range keys {
+		ts := series[key]
+		// Samples of a series must be sent in time order.
+		sort.SliceStable(ts.samples, func(i, j int) bool { return ts.samples[i].Timestamp < ts.samples[j].Timestamp })
+
+		tsBuf = tsBuf[:0]
+		for _, l := range ts.labels {
+			msgBuf = appendString(msgBuf[:0], 1, l[0])
+			msgBuf = appendString(msgBuf, 2, l[1])
+			tsBuf = appendBytes(tsBuf, 1, msgBuf)
+		}
+		for _, s := range ts.samples {
+			msgBuf = appendTag(msgBuf[:0], 1, wireFixed64)
+			msgBuf = binary.LittleEndian.AppendUint64(msgBuf, math.Float64bits(s.Value))
+			msgBuf = appendTag(msgBuf, 2, wireVarint)
+			msgBuf = binary.AppendUvarint(msgBuf, uint64(s.Timestamp*1000))
+			tsBuf = appendBytes(tsBuf, 2, msgBuf)
+		}
+		buf = appendBytes(buf, 1, tsBuf)
+	}
+	return buf
+}
+
+func appendTag(b []byte, field int, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,224 @@
+// Package exporter forwards collected samples to external systems.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+
+	"github.com/playok/only1mon/internal/model"
+	"github.com/playok/only1mon/internal/store"
+)
+
+const (
+	// remoteWriteQueue is the export_queue name used by remote_write.
+	remoteWriteQueue = "remote_write"
+	// remoteWriteMaxSamples bounds the samples encoded into one request.
+	remoteWriteMaxSamples = 2000
+	// remoteWriteMaxPending bounds samples held in memory between flushes.
+	remoteWriteMaxPending = 200000
+	// remoteWriteMinBackoff and remoteWriteMaxBackoff bound the pause before
+	// retrying after a failed send.
+	remoteWriteMinBackoff = time.Second
+	remoteWriteMaxBackoff = 5 * time.Minute
+)
+
+// RemoteWriteConfig configures a RemoteWrite exporter.
+type RemoteWriteConfig struct {
+	URL           string
+	Host          string            // value of the host label; empty omits it
+	Headers       map[string]string // extra request headers, e.g. Authorization
+	BatchInterval time.Duration     // how often buffered samples are sent
+	Timeout       time.Duration     // per-request timeout
+	MaxQueue      int               // payloads kept on disk during an outage (0 = unlimited)
+}
+
+// RemoteWrite sends samples to a Prometheus remote_write endpoint. Export only
+// buffers in memory; every BatchInterval the buffer is encoded, snappy
+// compressed and appended to a queue in the database, and the queue is sent
+// oldest first. Payloads stay queued while the endpoint is unreachable, with
+// exponential backoff between attempts, so an outage does not lose data
+// (beyond MaxQueue payloads, the oldest are dropped).
+type RemoteWrite struct {
+	cfg    RemoteWriteConfig
+	store  *store.Store
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []model.MetricSample
+
+	// ctx is canceled by Close, which also aborts a request in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	backoff time.Duration
+	retryAt time.Time
+	failing bool
+}
+
+// NewRemoteWrite creates a remote_write exporter. Call Start to begin sending.
+func NewRemoteWrite(s *store.Store, cfg RemoteWriteConfig) *RemoteWrite {
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RemoteWrite{
+		cfg:    cfg,
+		store:  s,
+		client: &http.Client{Timeout: cfg.Timeout},
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Start launches the send goroutine.
+func (rw *RemoteWrite) Start() {
+	if n, err := rw.store.ExportQueueLen(remoteWriteQueue); err == nil && n > 0 {
+		log.Printf("[remote_write] %d queued payloads from a previous run", n)
+	}
+	go rw.loop()
+}
+
+// Export buffers samples for the next batch. It never blocks on the network
+// or the database.
+func (rw *RemoteWrite) Export(samples []model.MetricSample) {
+	rw.mu.Lock()
+	rw.pending = append(rw.pending, samples...)
+	if over := len(rw.pending) - remoteWriteMaxPending; over > 0 {
+		rw.pending = append(rw.pending[:0], rw.pending[over:]...)
+	}
+	rw.mu.Unlock()
+}
+
+// Close persists buffered samples to the queue and stops the exporter,
+// aborting a send in progress. Queued payloads are sent on the next start.
+func (rw *RemoteWrite) Close() {
+	rw.cancel()
+	<-rw.done
+}
+
+func (rw *RemoteWrite) loop() {
+	defer close(rw.done)
+	ticker := time.NewTicker(rw.cfg.BatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rw.flush()
+			if !time.Now().Before(rw.retryAt) {
+				rw.send()
+			}
+		case <-rw.ctx.Done():
+			rw.flush()
+			return
+		}
+	}
+}
+
+// flush encodes the buffered samples and appends them to the on-disk queue.
+func (rw *RemoteWrite) flush() {
+	rw.mu.Lock()
+	batch := rw.pending
+	rw.pending = nil
+	rw.mu.Unlock()
+
+	hostLabel := [2]string{"host", rw.cfg.Host}
+	for len(batch) > 0 {
+		n := min(len(batch), remoteWriteMaxSamples)
+		payload := snappy.Encode(nil, encodeWriteRequest(batch[:n], hostLabel))
+		batch = batch[n:]
+		dropped, err := rw.store.EnqueueExport(remoteWriteQueue, payload, rw.cfg.MaxQueue)
+		if err != nil {
+			log.Printf("[remote_write] queue error: %v", err)
+			continue
+		}
+		if dropped > 0 {
+			log.Printf("[remote_write] queue full, dropped %d oldest payloads", dropped)
+		}
+	}
+}
+
+// send posts queued payloads oldest first until the queue is empty or a send
+// fails, in which case the next attempt is delayed.
+func (rw *RemoteWrite) send() {
+	for {
+		if rw.ctx.Err() != nil {
+			return
+		}
+		q, err := rw.store.NextExport(remoteWriteQueue)
+		if err != nil {
+			log.Printf("[remote_write] queue error: %v", err)
+			return
+		}
+		if q == nil {
+			return
+		}
+
+		retry, err := rw.post(q.Payload)
+		if err != nil && rw.ctx.Err() != nil {
+			return // shutting down; the payload stays queued
+		}
+		if err != nil && retry {
+			rw.backoff = min(max(rw.backoff*2, remoteWriteMinBackoff), remoteWriteMaxBackoff)
+			rw.retryAt = time.Now().Add(rw.backoff)
+			if !rw.failing {
+				log.Printf("[remote_write] send failed, retrying with backoff: %v", err)
+				rw.failing = true
+			}
+			return
+		}
+		if err != nil {
+			// The endpoint rejected the data itself; retrying cannot help.
+			log.Printf("[remote_write] payload rejected, dropping: %v", err)
+		}
+		if rw.failing {
+			log.Printf("[remote_write] endpoint reachable again")
+			rw.failing = false
+		}
+		rw.backoff = 0
+		if err := rw.store.DeleteExport(q.ID); err != nil {
+			log.Printf("[remote_write] queue error: %v", err)
+			return
+		}
+	}
+}
+
+// post sends one payload. retry reports whether a failure is worth retrying:
+// network errors, 5xx and 429 are; other 4xx responses are not.
+func (rw *RemoteWrite) post(payload []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(rw.ctx, http.MethodPost, rw.cfg.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "only1mon")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range rw.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := rw.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,332 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+
+	"github.com/playok/only1mon/internal/model"
+	"github.com/playok/only1mon/internal/store"
+)
+
+// decodedSeries is a TimeSeries read back from a WriteRequest.
+type decodedSeries struct {
+	Labels  map[string]string
+	Samples [][2]float64 // value, timestamp in ms
+}
+
+// readField reads one protobuf field and returns its number, wire type, the
+// varint or fixed64 value or the length-delimited bytes, and the rest of b.
+func readField(b []byte) (field, wire int, num uint64, data, rest []byte, err error) {
+	tag, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, 0, nil, nil, fmt.Errorf("bad tag")
+	}
+	b = b[n:]
+	field, wire = int(tag>>3), int(tag&7)
+	switch wire {
+	case wireVarint:
+		num, n = binary.Uvarint(b)
+		if n <= 0 {
+			return 0, 0, 0, nil, nil, fmt.Errorf("bad varint")
+		}
+		return field, wire, num, nil, b[n:], nil
+	case wireFixed64:
+		if len(b) < 8 {
+			return 0, 0, 0, nil, nil, fmt.Errorf("short fixed64")
+		}
+		return field, wire, binary.LittleEndian.Uint64(b), nil, b[8:], nil
+	case wireBytes:
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			return 0, 0, 0, nil, nil, fmt.Errorf("bad length")
+		}
+		return field, wire, 0, b[n : n+int(l)], b[n+int(l):], nil
+	}
+	return 0, 0, 0, nil, nil, fmt.Errorf("unexpected wire type %d", wire)
+}
+
+// decodeWriteRequest decodes a snappy compressed WriteRequest.
+func decodeWriteRequest(t *testing.T, body []byte) []decodedSeries {
+	t.Helper()
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("snappy: %v", err)
+	}
+	var out []decodedSeries
+	for len(raw) > 0 {
+		_, _, _, tsBuf, rest, err := readField(raw)
+		if err != nil {
+			t.Fatalf("WriteRequest: %v", err)
+		}
+		raw = rest
+		ts := decodedSeries{Labels: map[string]string{}}
+		for len(tsBuf) > 0 {
+			field, _, _, msg, rest, err := readField(tsBuf)
+			if err != nil {
+				t.Fatalf("TimeSeries: %v", err)
+			}
+			tsBuf = rest
+			var name, value string
+			var sample [2]float64
+			for len(msg) > 0 {
+				f, _, num, data, rest, err := readField(msg)
+				if err != nil {
+					t.Fatalf("field %d: %v", field, err)
+				}
+				msg = rest
+				switch {
+				case field == 1 && f == 1:
+					name = string(data)
+				case field == 1 && f == 2:
+					value = string(data)
+				case field == 2 && f == 1:
+					sample[0] = math.Float64frombits(num)
+				case field == 2 && f == 2:
+					sample[1] = float64(int64(num))
+				}
+			}
+			if field == 1 {
+				if _, dup := ts.Labels[name]; dup {
+					t.Errorf("duplicate label %q", name)
+				}
+				ts.Labels[name] = value
+			} else {
+				ts.Samples = append(ts.Samples, sample)
+			}
+		}
+		out = append(out, ts)
+	}
+	return out
+}
+
+// remoteWriteServer records the bodies it receives and answers with the
+// status codes in order, then 204.
+type remoteWriteServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func newRemoteWriteServer(t *testing.T, statuses ...int) *remoteWriteServer {
+	srv := &remoteWriteServer{statuses: statuses}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		srv.mu.Lock()
+		srv.bodies = append(srv.bodies, body)
+		srv.headers = append(srv.headers, r.Header.Clone())
+		status := http.StatusNoContent
+		if len(srv.statuses) > 0 {
+			status, srv.statuses = srv.statuses[0], srv.statuses[1:]
+		}
+		srv.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *remoteWriteServer) received() [][]byte {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([][]byte(nil), srv.bodies...)
+}
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("store.New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func queueLen(t *testing.T, s *store.Store) int64 {
+	t.Helper()
+	n, err := s.ExportQueueLen(remoteWriteQueue)
+	if err != nil {
+		t.Fatalf("ExportQueueLen: %v", err)
+	}
+	return n
+}
+
+func TestRemoteWriteEncoding(t *testing.T) {
+	srv := newRemoteWriteServer(t)
+	s := newTestStore(t)
+	rw := NewRemoteWrite(s, RemoteWriteConfig{URL: srv.URL, Host: "web1", Headers: map[string]string{"Authorization": "Bearer x"}})
+
+	rw.Export([]model.MetricSample{
+		{Timestamp: 1700000010, MetricName: "disk.root.used_pct", Value: 42.5},
+		{Timestamp: 1700000000, MetricName: "disk.root.used_pct", Value: 40},
+		{Timestamp: 1700000000, MetricName: "app.requests", Value: 7, Labels: "route=/users"},
+		// The sample's own host label must not duplicate the exporter's
+		{Timestamp: 1700000000, MetricName: "app.requests", Value: 3, Labels: "host=db1,route=/users"},
+	})
+	rw.flush()
+	rw.send()
+
+	bodies := srv.received()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d requests, want 1", len(bodies))
+	}
+	h := srv.headers[0]
+	for k, want := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer x",
+	} {
+		if got := h.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	got := decodeWriteRequest(t, bodies[0])
+	want := []decodedSeries{
+		{
+			Labels:  map[string]string{"__name__": "only1mon_disk_used_pct", "mount": "root", "host": "web1"},
+			Samples: [][2]float64{{40, 1700000000000}, {42.5, 1700000010000}},
+		},
+		{
+			Labels:  map[string]string{"__name__": "only1mon_app_requests", "route": "/users", "host": "web1"},
+			Samples: [][2]float64{{7, 1700000000000}},
+		},
+		{
+			Labels:  map[string]string{"__name__": "only1mon_app_requests", "route": "/users", "host": "web1", "exported_host": "db1"},
+			Samples: [][2]float64{{3, 1700000000000}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if n := queueLen(t, s); n != 0 {
+		t.Errorf("queue holds %d payloads after a successful send, want 0", n)
+	}
+}
+
+func TestRemoteWriteStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		retry     bool
+		wantQueue int64
+	}{
+		{http.StatusOK, false, 0},
+		{http.StatusNoContent, false, 0},
+		{http.StatusInternalServerError, true, 1},
+		{http.StatusServiceUnavailable, true, 1},
+		{http.StatusTooManyRequests, true, 1},
+		{http.StatusBadRequest, false, 0},
+		{http.StatusNotFound, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := newRemoteWriteServer(t, tt.status)
+			s := newTestStore(t)
+			rw := NewRemoteWrite(s, RemoteWriteConfig{URL: srv.URL})
+
+			rw.Export([]model.MetricSample{{Timestamp: 1700000000, MetricName: "app.requests", Value: 1}})
+			rw.flush()
+			rw.send()
+
+			if n := len(srv.received()); n != 1 {
+				t.Fatalf("got %d requests, want 1", n)
+			}
+			if n := queueLen(t, s); n != tt.wantQueue {
+				t.Errorf("queue holds %d payloads, want %d", n, tt.wantQueue)
+			}
+			if tt.retry {
+				if rw.backoff != remoteWriteMinBackoff || !rw.retryAt.After(time.Now()) {
+					t.Errorf("backoff = %v, retryAt = %v; want a retry after %v", rw.backoff, rw.retryAt, remoteWriteMinBackoff)
+				}
+			} else if rw.backoff != 0 {
+				t.Errorf("backoff = %v, want 0", rw.backoff)
+			}
+		})
+	}
+}
+
+func TestRemoteWriteReplay(t *testing.T) {
+	s := newTestStore(t)
+
+	// A previous run queued three payloads while the endpoint was down.
+	down := newRemoteWriteServer(t, http.StatusBadGateway)
+	rw := NewRemoteWrite(s, RemoteWriteConfig{URL: down.URL})
+	for i := range 3 {
+		rw.Export([]model.MetricSample{{Timestamp: 1700000000 + int64(i), MetricName: "app.requests", Value: float64(i)}})
+		rw.flush()
+	}
+	rw.send()
+	if n := queueLen(t, s); n != 3 {
+		t.Fatalf("queue holds %d payloads after a failed send, want 3", n)
+	}
+
+	// The next run sends them oldest first; the first attempt is rate
+	// limited, so the queue is kept until the retry.
+	srv := newRemoteWriteServer(t, http.StatusTooManyRequests)
+	rw = NewRemoteWrite(s, RemoteWriteConfig{URL: srv.URL})
+	rw.send()
+	if n := queueLen(t, s); n != 3 {
+		t.Fatalf("queue holds %d payloads after a 429, want 3", n)
+	}
+	rw.send()
+	if n := queueLen(t, s); n != 0 {
+		t.Fatalf("queue holds %d payloads after replay, want 0", n)
+	}
+
+	bodies := srv.received()
+	if len(bodies) != 4 {
+		t.Fatalf("got %d requests, want 4", len(bodies))
+	}
+	for i, body := range bodies[1:] {
+		got := decodeWriteRequest(t, body)
+		want := [][2]float64{{float64(i), float64(1700000000+i) * 1000}}
+		if len(got) != 1 || !reflect.DeepEqual(got[0].Samples, want) {
+			t.Errorf("request %d: got %+v, want samples %v", i+1, got, want)
+		}
+	}
+}
+
+func TestRemoteWriteCloseAbortsSend(t *testing.T) {
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	s := newTestStore(t)
+	rw := NewRemoteWrite(s, RemoteWriteConfig{URL: srv.URL, BatchInterval: 10 * time.Millisecond, Timeout: time.Minute})
+	rw.Export([]model.MetricSample{{Timestamp: 1700000000, MetricName: "app.requests", Value: 1}})
+	rw.Start()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request was sent")
+	}
+	begin := time.Now()
+	rw.Close()
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("Close took %v with a request in flight", d)
+	}
+	if n := queueLen(t, s); n != 1 {
+		t.Errorf("queue holds %d payloads after Close, want 1", n)
+	}
+}
@@ -1,20 +1,34 @@
 package model
 
+import "encoding/json"
+
 // CollectorState represents the enabled/disabled state and config of a collector.
 type CollectorState struct {
 	CollectorID string `json:"collector_id"`
 	Enabled     bool   `json:"enabled"`
-	ConfigJSON  string `json:"config_json,omitempty"`
+	// EnabledSet is false when only a config was saved and Enabled is the
+	// column default rather than a choice.
+	EnabledSet bool   `json:"-"`
+	ConfigJSON string `json:"config_json,omitempty"`
+}
+
+// CollectorConfig is the per-collector configuration stored as JSON in
+// collector_state.config_json.
+type CollectorConfig struct {
+	// Interval is the collection interval in seconds; 0 uses the global collect_interval.
+	Interval int `json:"interval,omitempty"`
+	// Options holds collector-specific settings (see collector.Configurable).
+	Options json.RawMessage `json:"options,omitempty"`
 }
 
 // ImpactLevel describes the system load impact of a collector.
 type ImpactLevel string
 
 const (
-	ImpactNone    ImpactLevel = "none"
-	ImpactLow     ImpactLevel = "low"
-	ImpactMedium  ImpactLevel = "medium"
-	ImpactHigh    ImpactLevel = "high"
+	ImpactNone   ImpactLevel = "none"
+	ImpactLow    ImpactLevel = "low"
+	ImpactMedium ImpactLevel = "medium"
+	ImpactHigh   ImpactLevel = "high"
 )
 
 // MetricState describes the enabled state and metadata of a single metric.
@@ -26,14 +40,28 @@ type MetricState struct {
 	Unit          string `json:"unit,omitempty"`
 }
 
+// CollectorHealth reports the outcome of a collector's recent runs.
+type CollectorHealth struct {
+	LastRun           int64   `json:"last_run"`           // unix time the last run started
+	LastDurationMs    float64 `json:"last_duration_ms"`   // wall time of the last run
+	LastSampleCount   int     `json:"last_sample_count"`  // samples returned by the last run
+	ConsecutiveErrors int     `json:"consecutive_errors"` // failed runs since the last success
+	LastError         string  `json:"last_error,omitempty"`
+	LastErrorTime     int64   `json:"last_error_time,omitempty"`
+	BackoffUntil      int64   `json:"backoff_until,omitempty"` // runs are skipped until this unix time
+}
+
 // CollectorInfo describes a collector for the API.
 type CollectorInfo struct {
-	ID           string        `json:"id"`
-	Name         string        `json:"name"`
-	Description  string        `json:"description"`
-	Impact       ImpactLevel   `json:"impact"`
-	Warning      string        `json:"warning,omitempty"`
-	Enabled      bool          `json:"enabled"`
-	Metrics      []string      `json:"metrics"`
-	MetricStates []MetricState `json:"metric_states,omitempty"`
+	ID           string           `json:"id"`
+	Name         string           `json:"name"`
+	Description  string           `json:"description"`
+	Impact       ImpactLevel      `json:"impact"`
+	Warning      string           `json:"warning,omitempty"`
+	Enabled      bool             `json:"enabled"`
+	Interval     int              `json:"interval"` // seconds; 0 = global collect_interval
+	Configurable bool             `json:"configurable"`
+	Metrics      []string         `json:"metrics"`
+	MetricStates []MetricState    `json:"metric_states,omitempty"`
+	Health       *CollectorHealth `json:"health,omitempty"`
 }
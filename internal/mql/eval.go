@@ -0,0 +1,439 @@
+package mql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Series is one time series. Timestamps are ascending.
+type Series struct {
+	Name       string    `json:"name"`
+	Collector  string    `json:"collector"`
+	Labels     string    `json:"labels,omitempty"`
+	Timestamps []int64   `json:"timestamps"`
+	Values     []float64 `json:"values"`
+
+	key string // matching key: wildcard segments for selectors, by() values for aggregations
+}
+
+// Source fetches the series matching a selector pattern. fn is "" for the
+// stored values or "rate"/"derivative" for per-second change computed from
+// the raw samples before any step bucketing.
+type Source interface {
+	Select(ctx context.Context, pattern, fn string, from, to int64, step int) ([]*Series, error)
+}
+
+// Range is the evaluation window. Step > 0 buckets selector data (averaged per
+// bucket), which also lines up series from collectors with different intervals.
+type Range struct {
+	From int64
+	To   int64
+	Step int
+}
+
+// value is an intermediate result: a scalar or a set of series.
+type value struct {
+	scalar bool
+	num    float64
+	vec    []*Series
+}
+
+// Eval evaluates an expression. The result must contain series; a purely
+// scalar expression is an error. A derived result made of a single series is
+// named after the expression so charts can label it; selectors and topk/bottomk
+// keep the names of the series they return.
+func Eval(ctx context.Context, src Source, n Node, r Range) ([]*Series, error) {
+	ev := &evaluator{ctx: ctx, src: src, step: r.Step}
+	v, err := ev.eval(n, r.From, r.To)
+	if err != nil {
+		return nil, err
+	}
+	if v.scalar {
+		return nil, fmt.Errorf("expression has no metric selector")
+	}
+	if len(v.vec) == 1 && derived(n) {
+		v.vec[0].Name = n.String()
+	}
+	return v.vec, nil
+}
+
+// derived reports whether n computes new values rather than selecting series.
+func derived(n Node) bool {
+	switch n := n.(type) {
+	case *Selector:
+		return false
+	case *Call:
+		return n.Func != "topk" && n.Func != "bottomk"
+	}
+	return true
+}
+
+type evaluator struct {
+	ctx  context.Context
+	src  Source
+	step int
+}
+
+func (ev *evaluator) eval(n Node, from, to int64) (value, error) {
+	if err := ev.ctx.Err(); err != nil {
+		return value{}, err
+	}
+	switch n := n.(type) {
+	case *NumberLit:
+		return value{scalar: true, num: n.Val}, nil
+	case *DurationLit:
+		return value{}, fmt.Errorf("duration %s is only valid as a *_over_time window", n.Text)
+	case *Selector:
+		return ev.selectSeries(n.Pattern, "", from, to)
+	case *UnaryExpr:
+		v, err := ev.eval(n.Expr, from, to)
+		if err != nil {
+			return value{}, err
+		}
+		return mapValues(v, func(x float64) float64 { return -x }), nil
+	case *BinaryExpr:
+		return ev.evalBinary(n, from, to)
+	case *Call:
+		return ev.evalCall(n, from, to)
+	}
+	return value{}, fmt.Errorf("unsupported expression %s", n)
+}
+
+func (ev *evaluator) selectSeries(pattern, fn string, from, to int64) (value, error) {
+	series, err := ev.src.Select(ev.ctx, pattern, fn, from, to, ev.step)
+	if err != nil {
+		return value{}, err
+	}
+	for _, s := range series {
+		s.key = wildcardKey(pattern, s.Name)
+	}
+	return value{vec: series}, nil
+}
+
+// wildcardKey returns the name segments matched by wildcard segments of the
+// pattern, e.g. "eth0" for net.*.bytes_recv and net.eth0.bytes_recv.
+func wildcardKey(pattern, name string) string {
+	if !isPattern(pattern) {
+		return ""
+	}
+	ps := strings.Split(pattern, ".")
+	ns := strings.Split(name, ".")
+	var key []string
+	for i, p := range ps {
+		if i < len(ns) && isPattern(p) {
+			key = append(key, ns[i])
+		}
+	}
+	return strings.Join(key, ".")
+}
+
+func (ev *evaluator) evalCall(c *Call, from, to int64) (value, error) {
+	switch c.Func {
+	case "rate":
+		return ev.selectSeries(c.Args[0].(*Selector).Pattern, "rate", from, to)
+	case "deriv":
+		return ev.selectSeries(c.Args[0].(*Selector).Pattern, "derivative", from, to)
+	case "abs":
+		v, err := ev.eval(c.Args[0], from, to)
+		if err != nil {
+			return value{}, err
+		}
+		return mapValues(v, math.Abs), nil
+	case "avg_over_time", "min_over_time", "max_over_time", "sum_over_time", "count_over_time":
+		window := c.Args[1].(*DurationLit).Seconds
+		v, err := ev.eval(c.Args[0], from-window, to)
+		if err != nil {
+			return value{}, err
+		}
+		if v.scalar {
+			return value{}, fmt.Errorf("%s needs series, got a scalar", c.Func)
+		}
+		agg := strings.TrimSuffix(c.Func, "_over_time")
+		for _, s := range v.vec {
+			overTime(s, window, from, agg)
+		}
+		return v, nil
+	case "topk", "bottomk":
+		n := c.Args[0].(*NumberLit).Val
+		if !positiveInt(n) {
+			return value{}, fmt.Errorf("%s argument 1 must be a positive integer, got %s", c.Func, c.Args[0])
+		}
+		v, err := ev.eval(c.Args[1], from, to)
+		if err != nil {
+			return value{}, err
+		}
+		if v.scalar {
+			return value{}, fmt.Errorf("%s needs series, got a scalar", c.Func)
+		}
+		// Compare as floats: k may be far beyond the range of int
+		k := len(v.vec)
+		if n < float64(k) {
+			k = int(n)
+		}
+		return value{vec: topK(v.vec, k, c.Func == "bottomk")}, nil
+	case "sum", "avg", "min", "max", "count":
+		v, err := ev.eval(c.Args[0], from, to)
+		if err != nil {
+			return value{}, err
+		}
+		if v.scalar {
+			return value{}, fmt.Errorf("%s needs series, got a scalar", c.Func)
+		}
+		return value{vec: aggregateBy(v.vec, c.Func, c.By)}, nil
+	}
+	return value{}, fmt.Errorf("unknown function %q", c.Func)
+}
+
+func (ev *evaluator) evalBinary(b *BinaryExpr, from, to int64) (value, error) {
+	l, err := ev.eval(b.LHS, from, to)
+	if err != nil {
+		return value{}, err
+	}
+	r, err := ev.eval(b.RHS, from, to)
+	if err != nil {
+		return value{}, err
+	}
+	op := b.Op
+
+	switch {
+	case l.scalar && r.scalar:
+		return value{scalar: true, num: apply(op, l.num, r.num)}, nil
+	case r.scalar:
+		return mapValues(l, func(x float64) float64 { return apply(op, x, r.num) }), nil
+	case l.scalar:
+		return mapValues(r, func(x float64) float64 { return apply(op, l.num, x) }), nil
+	}
+
+	var out []*Series
+	switch {
+	case len(l.vec) == 1 && len(r.vec) == 1:
+		s := joinSeries(l.vec[0], r.vec[0], op)
+		s.Name = l.vec[0].Name + " " + string(op) + " " + r.vec[0].Name
+		out = append(out, s)
+	case len(r.vec) == 1:
+		for _, ls := range l.vec {
+			out = append(out, joinSeries(ls, r.vec[0], op))
+		}
+	case len(l.vec) == 1:
+		for _, rs := range r.vec {
+			s := joinSeries(l.vec[0], rs, op)
+			s.Name, s.Collector, s.Labels, s.key = rs.Name, rs.Collector, rs.Labels, rs.key
+			out = append(out, s)
+		}
+	default:
+		byKey := make(map[string]*Series, len(r.vec))
+		for _, rs := range r.vec {
+			byKey[rs.key] = rs
+		}
+		for _, ls := range l.vec {
+			if rs, ok := byKey[ls.key]; ok {
+				out = append(out, joinSeries(ls, rs, op))
+			}
+		}
+	}
+	return value{vec: out}, nil
+}
+
+func apply(op byte, a, b float64) float64 {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	case '/':
+		return a / b
+	}
+	return math.NaN()
+}
+
+// mapValues applies fn to a scalar or to every point, dropping points that
+// become NaN or infinite (which JSON cannot carry).
+func mapValues(v value, fn func(float64) float64) value {
+	if v.scalar {
+		return value{scalar: true, num: fn(v.num)}
+	}
+	for _, s := range v.vec {
+		ts := s.Timestamps[:0]
+		vals := s.Values[:0]
+		for i, t := range s.Timestamps {
+			if x := fn(s.Values[i]); finite(x) {
+				ts = append(ts, t)
+				vals = append(vals, x)
+			}
+		}
+		s.Timestamps, s.Values = ts, vals
+	}
+	return v
+}
+
+// joinSeries combines the points of a and b that share a timestamp. The
+// result takes a's identity.
+func joinSeries(a, b *Series, op byte) *Series {
+	out := &Series{Name: a.Name, Collector: a.Collector, Labels: a.Labels, key: a.key}
+	i, j := 0, 0
+	for i < len(a.Timestamps) && j < len(b.Timestamps) {
+		switch {
+		case a.Timestamps[i] < b.Timestamps[j]:
+			i++
+		case a.Timestamps[i] > b.Timestamps[j]:
+			j++
+		default:
+			if x := apply(op, a.Values[i], b.Values[j]); finite(x) {
+				out.Timestamps = append(out.Timestamps, a.Timestamps[i])
+				out.Values = append(out.Values, x)
+			}
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// overTime replaces each point at or after from with the aggregate of the
+// points in the trailing window (t-window, t].
+func overTime(s *Series, window, from int64, agg string) {
+	var ts []int64
+	var vals []float64
+	lo := 0
+	for i, t := range s.Timestamps {
+		for lo < i && s.Timestamps[lo] <= t-window {
+			lo++
+		}
+		if t < from {
+			continue
+		}
+		ts = append(ts, t)
+		vals = append(vals, aggregate(s.Values[lo:i+1], agg))
+	}
+	s.Timestamps, s.Values = ts, vals
+}
+
+// topK keeps the k series with the highest (or lowest) mean value.
+func topK(series []*Series, k int, bottom bool) []*Series {
+	mean := func(s *Series) float64 { return aggregate(s.Values, "avg") }
+	sorted := append([]*Series(nil), series...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if bottom {
+			return mean(sorted[i]) < mean(sorted[j])
+		}
+		return mean(sorted[i]) > mean(sorted[j])
+	})
+	if k < len(sorted) {
+		sorted = sorted[:k]
+	}
+	return sorted
+}
+
+// aggregateBy combines series per timestamp, grouping them by the given name
+// segments (all series form one group when by is empty).
+func aggregateBy(series []*Series, agg string, by []int) []*Series {
+	type group struct {
+		names []string
+		first *Series
+		byTS  map[int64][]float64
+	}
+	var order []string
+	groups := make(map[string]*group)
+	for _, s := range series {
+		key := segmentsKey(s.Name, by)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{first: s, byTS: make(map[int64][]float64)}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.names = append(g.names, s.Name)
+		for i, t := range s.Timestamps {
+			g.byTS[t] = append(g.byTS[t], s.Values[i])
+		}
+	}
+
+	out := make([]*Series, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		stamps := make([]int64, 0, len(g.byTS))
+		for t := range g.byTS {
+			stamps = append(stamps, t)
+		}
+		sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+		s := &Series{Name: commonPattern(g.names), Collector: g.first.Collector, key: key}
+		for _, t := range stamps {
+			s.Timestamps = append(s.Timestamps, t)
+			s.Values = append(s.Values, aggregate(g.byTS[t], agg))
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// segmentsKey joins the name segments at the given indexes.
+func segmentsKey(name string, by []int) string {
+	if len(by) == 0 {
+		return ""
+	}
+	segs := strings.Split(name, ".")
+	key := make([]string, len(by))
+	for i, idx := range by {
+		if idx < len(segs) {
+			key[i] = segs[idx]
+		}
+	}
+	return strings.Join(key, ".")
+}
+
+// commonPattern returns the names with differing segments replaced by "*".
+func commonPattern(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	base := strings.Split(names[0], ".")
+	for _, n := range names[1:] {
+		segs := strings.Split(n, ".")
+		if len(segs) != len(base) {
+			return names[0] + "*"
+		}
+		for i := range base {
+			if base[i] != segs[i] {
+				base[i] = "*"
+			}
+		}
+	}
+	return strings.Join(base, ".")
+}
+
+func aggregate(vals []float64, agg string) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	switch agg {
+	case "count":
+		return float64(len(vals))
+	case "min":
+		m := vals[0]
+		for _, v := range vals[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	case "max":
+		m := vals[0]
+		for _, v := range vals[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}
+	var sum float64
+	for _, v := range vals {
+		sum += v
+	}
+	if agg == "avg" {
+		return sum / float64(len(vals))
+	}
+	return sum
+}
+
+func finite(x float64) bool { return !math.IsNaN(x) && !math.IsInf(x, 0) }
@@ -0,0 +1,293 @@
+package mql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testSource serves fixed series, matching wildcards per dot segment. For
+// fn "rate" and "derivative" it returns the per-second change between
+// consecutive points.
+type testSource []*Series
+
+func (ts testSource) Select(ctx context.Context, pattern, fn string, from, to int64, step int) ([]*Series, error) {
+	if fn != "" && fn != "rate" && fn != "derivative" {
+		return nil, fmt.Errorf("unknown fn %q", fn)
+	}
+	var out []*Series
+	for _, s := range ts {
+		if !segmentsMatch(pattern, s.Name) {
+			continue
+		}
+		c := &Series{Name: s.Name, Collector: s.Collector, Labels: s.Labels}
+		for i, t := range s.Timestamps {
+			v := s.Values[i]
+			if fn != "" {
+				if i == 0 {
+					continue
+				}
+				v = (v - s.Values[i-1]) / float64(t-s.Timestamps[i-1])
+			}
+			if t >= from && t <= to {
+				c.Timestamps = append(c.Timestamps, t)
+				c.Values = append(c.Values, v)
+			}
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func segmentsMatch(pattern, name string) bool {
+	ps, ns := strings.Split(pattern, "."), strings.Split(name, ".")
+	if len(ps) != len(ns) {
+		return false
+	}
+	for i := range ps {
+		if ok, _ := path.Match(ps[i], ns[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// evalSource holds the series the evaluator tests run against.
+var evalSource = testSource{
+	{Name: "mem.used", Timestamps: []int64{10, 20, 30}, Values: []float64{50, 60, 70}},
+	{Name: "mem.total", Timestamps: []int64{10, 20, 30}, Values: []float64{100, 100, 200}},
+	{Name: "net.eth0.bytes_recv", Timestamps: []int64{10, 20, 30}, Values: []float64{100, 200, 400}},
+	{Name: "net.eth1.bytes_recv", Timestamps: []int64{10, 20, 30}, Values: []float64{10, 20, 30}},
+	{Name: "net.eth0.bytes_sent", Timestamps: []int64{10, 20, 30}, Values: []float64{1, 2, 3}},
+	{Name: "net.eth1.bytes_sent", Timestamps: []int64{10, 20, 30}, Values: []float64{2, 2, 2}},
+	{Name: "net.lo.bytes_sent", Timestamps: []int64{10, 20, 30}, Values: []float64{5, 5, 5}},
+	{Name: "cpu.core.0.usage", Timestamps: []int64{0, 10, 20, 30, 40}, Values: []float64{1, 2, 3, 4, 5}},
+	{Name: "cpu.core.1.usage", Timestamps: []int64{0, 10, 20, 30, 40}, Values: []float64{10, 10, 10, 10, 10}},
+	{Name: "cpu.core.2.usage", Timestamps: []int64{0, 10, 20, 30, 40}, Values: []float64{5, 5, 5, 5, 5}},
+	{Name: "q.offset", Timestamps: []int64{15, 20, 25, 30}, Values: []float64{1, 2, 3, 4}},
+	{Name: "q.zero", Timestamps: []int64{10, 20, 30}, Values: []float64{0, 2, 0}},
+}
+
+// evalResult is the part of a Series the tests compare.
+type evalResult struct {
+	Name       string
+	Timestamps []int64
+	Values     []float64
+}
+
+func r(name string, ts []int64, vals ...float64) evalResult {
+	return evalResult{Name: name, Timestamps: ts, Values: vals}
+}
+
+func TestEval(t *testing.T) {
+	ts := []int64{10, 20, 30}
+	tests := []struct {
+		expr string
+		rng  Range // default 10-30
+		want []evalResult
+	}{
+		// A derived single series is named after the expression
+		{expr: "mem.used", want: []evalResult{r("mem.used", ts, 50, 60, 70)}},
+		{expr: "mem.used / mem.total * 100", want: []evalResult{r("mem.used / mem.total * 100", ts, 50, 60, 35)}},
+		{expr: "mem.used * 2", want: []evalResult{r("mem.used * 2", ts, 100, 120, 140)}},
+		{expr: "100 - mem.used", want: []evalResult{r("100 - mem.used", ts, 50, 40, 30)}},
+		{expr: "-mem.used + 2 * 3", want: []evalResult{r("-mem.used + 2 * 3", ts, -44, -54, -64)}},
+		{expr: "abs(0 - mem.used)", want: []evalResult{r("abs(0 - mem.used)", ts, 50, 60, 70)}},
+
+		// Binary operators between series
+		{expr: "mem.used + q.offset", want: []evalResult{r("mem.used + q.offset", []int64{20, 30}, 62, 74)}},
+		{expr: "mem.used / q.zero", want: []evalResult{r("mem.used / q.zero", []int64{20}, 30)}},
+		{expr: "net.*.bytes_recv / mem.total", want: []evalResult{
+			r("net.eth0.bytes_recv", ts, 1, 2, 2),
+			r("net.eth1.bytes_recv", ts, 0.1, 0.2, 0.15),
+		}},
+		{expr: "mem.total - net.*.bytes_recv", want: []evalResult{
+			r("net.eth0.bytes_recv", ts, 0, -100, -200),
+			r("net.eth1.bytes_recv", ts, 90, 80, 170),
+		}},
+		// Series pair up by wildcard segments; lo has no bytes_recv
+		{expr: "net.*.bytes_sent + net.*.bytes_recv", want: []evalResult{
+			r("net.eth0.bytes_sent", ts, 101, 202, 403),
+			r("net.eth1.bytes_sent", ts, 12, 22, 32),
+		}},
+		{expr: "net.*.bytes_sent * 0 / 0", want: []evalResult{
+			r("net.eth0.bytes_sent", []int64{}),
+			r("net.eth1.bytes_sent", []int64{}),
+			r("net.lo.bytes_sent", []int64{}),
+		}},
+
+		{expr: "rate(net.*.bytes_recv)", want: []evalResult{
+			r("net.eth0.bytes_recv", []int64{20, 30}, 10, 20),
+			r("net.eth1.bytes_recv", []int64{20, 30}, 1, 1),
+		}},
+		{expr: "deriv(mem.total)", want: []evalResult{r("deriv(mem.total)", []int64{20, 30}, 0, 10)}},
+
+		// *_over_time aggregates the window (t-w, t], reading before the range
+		{expr: "avg_over_time(cpu.core.0.usage, 20s)", rng: Range{From: 20, To: 40},
+			want: []evalResult{r("avg_over_time(cpu.core.0.usage, 20s)", []int64{20, 30, 40}, 2.5, 3.5, 4.5)}},
+		{expr: "min_over_time(cpu.core.0.usage, 20s)", rng: Range{From: 20, To: 40},
+			want: []evalResult{r("min_over_time(cpu.core.0.usage, 20s)", []int64{20, 30, 40}, 2, 3, 4)}},
+		{expr: "max_over_time(cpu.core.0.usage, 20s)", rng: Range{From: 20, To: 40},
+			want: []evalResult{r("max_over_time(cpu.core.0.usage, 20s)", []int64{20, 30, 40}, 3, 4, 5)}},
+		{expr: "sum_over_time(cpu.core.0.usage, 20s)", rng: Range{From: 20, To: 40},
+			want: []evalResult{r("sum_over_time(cpu.core.0.usage, 20s)", []int64{20, 30, 40}, 5, 7, 9)}},
+		{expr: "count_over_time(cpu.core.0.usage, 25s)", rng: Range{From: 20, To: 40},
+			want: []evalResult{r("count_over_time(cpu.core.0.usage, 25s)", []int64{20, 30, 40}, 3, 3, 3)}},
+		// The window is shorter at the start of the data
+		{expr: "avg_over_time(cpu.core.0.usage, 20s)", rng: Range{From: 0, To: 20},
+			want: []evalResult{r("avg_over_time(cpu.core.0.usage, 20s)", []int64{0, 10, 20}, 1, 1.5, 2.5)}},
+		{expr: "sum_over_time(cpu.core.*.usage * 2, 10s)", rng: Range{From: 10, To: 20}, want: []evalResult{
+			r("cpu.core.0.usage", []int64{10, 20}, 4, 6),
+			r("cpu.core.1.usage", []int64{10, 20}, 20, 20),
+			r("cpu.core.2.usage", []int64{10, 20}, 10, 10),
+		}},
+
+		// topk and bottomk rank by mean (3, 10 and 5) and keep series names
+		{expr: "topk(2, cpu.core.*.usage)", rng: Range{From: 0, To: 40}, want: []evalResult{
+			r("cpu.core.1.usage", []int64{0, 10, 20, 30, 40}, 10, 10, 10, 10, 10),
+			r("cpu.core.2.usage", []int64{0, 10, 20, 30, 40}, 5, 5, 5, 5, 5),
+		}},
+		{expr: "topk(1, cpu.core.*.usage)", rng: Range{From: 0, To: 40}, want: []evalResult{
+			r("cpu.core.1.usage", []int64{0, 10, 20, 30, 40}, 10, 10, 10, 10, 10),
+		}},
+		{expr: "bottomk(2, cpu.core.*.usage)", rng: Range{From: 0, To: 40}, want: []evalResult{
+			r("cpu.core.0.usage", []int64{0, 10, 20, 30, 40}, 1, 2, 3, 4, 5),
+			r("cpu.core.2.usage", []int64{0, 10, 20, 30, 40}, 5, 5, 5, 5, 5),
+		}},
+		{expr: "topk(1e300, cpu.core.*.usage)", rng: Range{From: 0, To: 40}, want: []evalResult{
+			r("cpu.core.1.usage", []int64{0, 10, 20, 30, 40}, 10, 10, 10, 10, 10),
+			r("cpu.core.2.usage", []int64{0, 10, 20, 30, 40}, 5, 5, 5, 5, 5),
+			r("cpu.core.0.usage", []int64{0, 10, 20, 30, 40}, 1, 2, 3, 4, 5),
+		}},
+		{expr: "bottomk(1, net.*.bytes_sent - net.*.bytes_sent)", want: []evalResult{
+			r("net.eth0.bytes_sent", ts, 0, 0, 0),
+		}},
+
+		// Aggregations combine series per timestamp
+		{expr: "sum(cpu.core.*.usage)", rng: Range{From: 10, To: 20},
+			want: []evalResult{r("sum(cpu.core.*.usage)", []int64{10, 20}, 17, 18)}},
+		{expr: "min(cpu.core.*.usage)", rng: Range{From: 10, To: 20},
+			want: []evalResult{r("min(cpu.core.*.usage)", []int64{10, 20}, 2, 3)}},
+		{expr: "max(cpu.core.*.usage)", rng: Range{From: 10, To: 20},
+			want: []evalResult{r("max(cpu.core.*.usage)", []int64{10, 20}, 10, 10)}},
+		{expr: "count(cpu.core.*.usage)", rng: Range{From: 10, To: 20},
+			want: []evalResult{r("count(cpu.core.*.usage)", []int64{10, 20}, 3, 3)}},
+		{expr: "avg(net.*.bytes_recv)", want: []evalResult{r("avg(net.*.bytes_recv)", ts, 55, 110, 215)}},
+		// Timestamps are the union of the group's
+		{expr: "sum by (0) (q.*)", want: []evalResult{r("sum by (0) (q.*)", []int64{10, 15, 20, 25, 30}, 0, 1, 4, 3, 4)}},
+		{expr: "sum by (1) (net.*.*)", want: []evalResult{
+			r("net.eth0.*", ts, 101, 202, 403),
+			r("net.eth1.*", ts, 12, 22, 32),
+			r("net.lo.bytes_sent", ts, 5, 5, 5),
+		}},
+		{expr: "sum(net.*.*) by (2)", want: []evalResult{
+			r("net.*.bytes_recv", ts, 110, 220, 430),
+			r("net.*.bytes_sent", ts, 8, 9, 10),
+		}},
+		{expr: "avg by (1, 2) (net.*.bytes_recv)", want: []evalResult{
+			r("net.eth0.bytes_recv", ts, 100, 200, 400),
+			r("net.eth1.bytes_recv", ts, 10, 20, 30),
+		}},
+		// An index past the end of the names puts them in one group
+		{expr: "max by (7) (net.*.bytes_recv)", want: []evalResult{r("max by (7) (net.*.bytes_recv)", ts, 100, 200, 400)}},
+		{expr: "sum by (1) (net.*.bytes_sent) / sum by (1) (net.*.bytes_recv)", want: []evalResult{
+			r("net.eth0.bytes_sent", ts, 0.01, 0.01, 0.0075),
+			r("net.eth1.bytes_sent", ts, 0.2, 0.1, 2.0/30),
+		}},
+		{expr: "count(mem.used + q.offset * 0)", want: []evalResult{r("count(mem.used + q.offset * 0)", []int64{20, 30}, 1, 1)}},
+		{expr: "no.such.metric + 1", want: nil},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		rng := tt.rng
+		if rng == (Range{}) {
+			rng = Range{From: 10, To: 30}
+		}
+		series, err := Eval(t.Context(), evalSource, n, rng)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.expr, err)
+			continue
+		}
+		var got []evalResult
+		for _, s := range series {
+			got = append(got, evalResult{Name: s.Name, Timestamps: s.Timestamps, Values: s.Values})
+		}
+		if !resultsEqual(got, tt.want) {
+			t.Errorf("Eval(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+// resultsEqual compares results, treating nil and empty slices alike and
+// allowing for rounding in the values.
+func resultsEqual(a, b []evalResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || len(a[i].Timestamps) != len(b[i].Timestamps) || len(a[i].Values) != len(b[i].Values) {
+			return false
+		}
+		if len(a[i].Timestamps) > 0 && !reflect.DeepEqual(a[i].Timestamps, b[i].Timestamps) {
+			return false
+		}
+		for j, v := range a[i].Values {
+			if math.Abs(v-b[i].Values[j]) > 1e-9 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestEvalErrors(t *testing.T) {
+	sel := &Selector{Pattern: "cpu.core.*.usage"}
+	tests := []struct {
+		name string
+		n    Node
+		want string
+	}{
+		{"scalar expression", &BinaryExpr{Op: '+', LHS: &NumberLit{Val: 1}, RHS: &NumberLit{Val: 2}}, "expression has no metric selector"},
+		{"duration outside over_time", &DurationLit{Seconds: 300, Text: "5m"}, "duration 5m is only valid as a *_over_time window"},
+		{"over_time of a scalar", &Call{Func: "avg_over_time", Args: []Node{&NumberLit{Val: 1}, &DurationLit{Seconds: 300, Text: "5m"}}}, "avg_over_time needs series, got a scalar"},
+		{"topk of a scalar", &Call{Func: "topk", Args: []Node{&NumberLit{Val: 1}, &NumberLit{Val: 2}}}, "topk needs series, got a scalar"},
+		{"aggregation of a scalar", &Call{Func: "sum", Args: []Node{&NumberLit{Val: 2}}}, "sum needs series, got a scalar"},
+		{"unknown function", &Call{Func: "median", Args: []Node{sel}}, `unknown function "median"`},
+
+		// Parse rejects these, but a Call built directly is checked again
+		{"k of zero", &Call{Func: "topk", Args: []Node{&NumberLit{Val: 0}, sel}}, "topk argument 1 must be a positive integer, got 0"},
+		{"negative k", &Call{Func: "bottomk", Args: []Node{&NumberLit{Val: -1}, sel}}, "bottomk argument 1 must be a positive integer, got -1"},
+		{"fractional k", &Call{Func: "topk", Args: []Node{&NumberLit{Val: 0.5}, sel}}, "topk argument 1 must be a positive integer, got 0.5"},
+		{"infinite k", &Call{Func: "topk", Args: []Node{&NumberLit{Val: math.Inf(1)}, sel}}, "topk argument 1 must be a positive integer, got +Inf"},
+		{"NaN k", &Call{Func: "topk", Args: []Node{&NumberLit{Val: math.NaN()}, sel}}, "topk argument 1 must be a positive integer, got NaN"},
+	}
+	for _, tt := range tests {
+		_, err := Eval(t.Context(), evalSource, tt.n, Range{From: 0, To: 40})
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestEvalCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	n, err := Parse("sum(cpu.core.*.usage)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Eval(ctx, evalSource, n, Range{From: 0, To: 40}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,136 @@
+package mql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokDuration
+	tokIdent
+	tokOp     // + - * /
+	tokLParen // (
+	tokRParen // )
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64 // tokNumber value, or tokDuration seconds
+	pos  int
+}
+
+// lex splits an expression into tokens.
+//
+// Metric names contain characters that are also operators, so two rules keep
+// them apart: "*" belongs to a name when it touches a "." (cpu.core.*.usage),
+// and "-" belongs to a name when it sits between two alphanumerics (dm-0).
+// Write "a * b" and "a - b" with spaces when both sides are metric names.
+func lex(input string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == ',':
+			toks = append(toks, token{kind: tokComma, text: ",", pos: i})
+			i++
+		case c == '*' && i+1 < len(input) && input[i+1] == '.':
+			t := lexIdent(input, i)
+			toks = append(toks, t)
+			i += len(t.text)
+		case c == '+' || c == '-' || c == '*' || c == '/':
+			toks = append(toks, token{kind: tokOp, text: string(c), pos: i})
+			i++
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			t, err := lexNumber(input, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, t)
+			i += len(t.text)
+		case isIdentStart(c):
+			t := lexIdent(input, i)
+			toks = append(toks, t)
+			i += len(t.text)
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(input)})
+	return toks, nil
+}
+
+func lexIdent(input string, start int) token {
+	i := start
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case isIdentChar(c):
+			i++
+		case c == '*' && ((i > start && input[i-1] == '.') || (i+1 < len(input) && input[i+1] == '.')):
+			i++
+		case c == '-' && i > start && isAlnum(input[i-1]) && i+1 < len(input) && isAlnum(input[i+1]):
+			i++
+		default:
+			return token{kind: tokIdent, text: input[start:i], pos: start}
+		}
+	}
+	return token{kind: tokIdent, text: input[start:i], pos: start}
+}
+
+// durationUnits maps duration suffixes to seconds.
+var durationUnits = map[byte]float64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400}
+
+func lexNumber(input string, start int) (token, error) {
+	i := start
+	for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+		i++
+	}
+	if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+		j := i + 1
+		if j < len(input) && (input[j] == '+' || input[j] == '-') {
+			j++
+		}
+		if j < len(input) && isDigit(input[j]) {
+			for j < len(input) && isDigit(input[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	v, err := strconv.ParseFloat(input[start:i], 64)
+	if err != nil {
+		return token{}, fmt.Errorf("bad number %q at %d", input[start:i], start)
+	}
+	// A unit suffix not followed by more name characters makes a duration: 5m, 1h
+	if i < len(input) {
+		if mult, ok := durationUnits[input[i]]; ok && (i+1 >= len(input) || !isIdentChar(input[i+1])) {
+			return token{kind: tokDuration, text: input[start : i+1], num: v * mult, pos: start}, nil
+		}
+	}
+	return token{kind: tokNumber, text: input[start:i], num: v, pos: start}, nil
+}
+
+func isDigit(c byte) bool      { return c >= '0' && c <= '9' }
+func isAlpha(c byte) bool      { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isAlnum(c byte) bool      { return isDigit(c) || isAlpha(c) }
+func isIdentStart(c byte) bool { return isAlpha(c) || c == '_' }
+func isIdentChar(c byte) bool  { return isAlnum(c) || c == '_' || c == '.' || c == ':' }
+
+// isPattern reports whether a selector contains wildcards.
+func isPattern(s string) bool { return strings.ContainsAny(s, "*?[") }
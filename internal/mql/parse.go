@@ -0,0 +1,383 @@
+// Package mql implements a small PromQL-inspired expression language over
+// only1mon metrics.
+//
+//	mem.used / mem.total * 100
+//	rate(net.*.bytes_recv)
+//	sum by (1) (proc.top_cpu.*.cpu_pct)
+//	topk(3, avg_over_time(cpu.core.*.usage, 5m))
+//
+// A selector is a metric name, optionally with * wildcards, and evaluates to
+// every matching series. Series are grouped by the dot-separated segments of
+// their names: "by (1)" groups net.eth0.bytes_recv and net.eth1.bytes_recv by
+// segment 1 (eth0, eth1). Binary operators between two multi-series operands
+// pair series whose wildcard segments match.
+package mql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Node is a parsed expression.
+type Node interface {
+	String() string
+}
+
+// NumberLit is a scalar constant.
+type NumberLit struct {
+	Val float64
+}
+
+// DurationLit is a time window such as 5m, used by the *_over_time functions.
+type DurationLit struct {
+	Seconds int64
+	Text    string
+}
+
+// Selector selects the series whose names match Pattern.
+type Selector struct {
+	Pattern string
+}
+
+// UnaryExpr is a negation.
+type UnaryExpr struct {
+	Expr Node
+}
+
+// BinaryExpr is an arithmetic operation.
+type BinaryExpr struct {
+	Op  byte // + - * /
+	LHS Node
+	RHS Node
+}
+
+// Call is a function or aggregation call. By lists the name segments to
+// group by for aggregations.
+type Call struct {
+	Func string
+	Args []Node
+	By   []int
+}
+
+func (n *NumberLit) String() string   { return strconv.FormatFloat(n.Val, 'g', -1, 64) }
+func (n *DurationLit) String() string { return n.Text }
+func (n *Selector) String() string    { return n.Pattern }
+func (n *UnaryExpr) String() string {
+	if _, ok := n.Expr.(*BinaryExpr); ok {
+		return "-(" + n.Expr.String() + ")"
+	}
+	return "-" + n.Expr.String()
+}
+func (n *BinaryExpr) String() string {
+	return operand(n.LHS, n.Op, false) + " " + string(n.Op) + " " + operand(n.RHS, n.Op, true)
+}
+
+// operand formats a child of a binary expression, adding parentheses where
+// precedence or left-associativity would otherwise change the meaning.
+func operand(child Node, op byte, right bool) string {
+	b, ok := child.(*BinaryExpr)
+	if !ok {
+		return child.String()
+	}
+	if precedence(b.Op) < precedence(op) || (right && precedence(b.Op) == precedence(op)) {
+		return "(" + b.String() + ")"
+	}
+	return b.String()
+}
+
+func precedence(op byte) int {
+	if op == '*' || op == '/' {
+		return 2
+	}
+	return 1
+}
+
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = a.String()
+	}
+	s := n.Func
+	if len(n.By) > 0 {
+		by := make([]string, len(n.By))
+		for i, b := range n.By {
+			by[i] = strconv.Itoa(b)
+		}
+		s += " by (" + strings.Join(by, ", ") + ") "
+	}
+	return s + "(" + strings.Join(args, ", ") + ")"
+}
+
+// funcSig describes the arguments a function accepts.
+type funcSig struct {
+	args      []argKind
+	aggregate bool // accepts "by (...)"
+}
+
+type argKind int
+
+const (
+	argExpr argKind = iota
+	argSelector
+	argNumber
+	argDuration
+)
+
+var functions = map[string]funcSig{
+	"rate":            {args: []argKind{argSelector}},
+	"deriv":           {args: []argKind{argSelector}},
+	"abs":             {args: []argKind{argExpr}},
+	"avg_over_time":   {args: []argKind{argExpr, argDuration}},
+	"min_over_time":   {args: []argKind{argExpr, argDuration}},
+	"max_over_time":   {args: []argKind{argExpr, argDuration}},
+	"sum_over_time":   {args: []argKind{argExpr, argDuration}},
+	"count_over_time": {args: []argKind{argExpr, argDuration}},
+	"topk":            {args: []argKind{argNumber, argExpr}},
+	"bottomk":         {args: []argKind{argNumber, argExpr}},
+	"sum":             {args: []argKind{argExpr}, aggregate: true},
+	"avg":             {args: []argKind{argExpr}, aggregate: true},
+	"min":             {args: []argKind{argExpr}, aggregate: true},
+	"max":             {args: []argKind{argExpr}, aggregate: true},
+	"count":           {args: []argKind{argExpr}, aggregate: true},
+}
+
+// Parse parses an expression.
+func Parse(input string) (Node, error) {
+	toks, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		if t.kind == tokEOF {
+			return t, fmt.Errorf("expected %s at end of expression", what)
+		}
+		return t, fmt.Errorf("expected %s at %d, got %q", what, t.pos, t.text)
+	}
+	return t, nil
+}
+
+// parseExpr handles + and -.
+func (p *parser) parseExpr() (Node, error) {
+	lhs, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-") {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.text[0], LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseTerm handles * and /.
+func (p *parser) parseTerm() (Node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/") {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.text[0], LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t := p.peek(); t.kind == tokOp && t.text == "-" {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if num, ok := n.(*NumberLit); ok {
+			return &NumberLit{Val: -num.Val}, nil
+		}
+		return &UnaryExpr{Expr: n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &NumberLit{Val: t.num}, nil
+	case tokDuration:
+		return &DurationLit{Seconds: int64(t.num), Text: t.text}, nil
+	case tokLParen:
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, `")"`); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tokIdent:
+		if _, ok := functions[t.text]; ok {
+			if nt := p.peek(); nt.kind == tokLParen || (nt.kind == tokIdent && nt.text == "by") {
+				return p.parseCall(t)
+			}
+		}
+		if p.peek().kind == tokLParen {
+			return nil, fmt.Errorf("unknown function %q at %d", t.text, t.pos)
+		}
+		return &Selector{Pattern: t.text}, nil
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// parseCall parses "f(args)", "agg by (n, ...) (expr)" and "agg(expr) by (n, ...)".
+func (p *parser) parseCall(name token) (Node, error) {
+	sig := functions[name.text]
+	call := &Call{Func: name.text}
+
+	if t := p.peek(); t.kind == tokIdent && t.text == "by" {
+		if !sig.aggregate {
+			return nil, fmt.Errorf("%s does not support by", name.text)
+		}
+		p.next()
+		by, err := p.parseBy()
+		if err != nil {
+			return nil, err
+		}
+		call.By = by
+	}
+
+	if _, err := p.expect(tokLParen, `"("`); err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if _, err := p.expect(tokRParen, `")"`); err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokIdent && t.text == "by" && sig.aggregate && call.By == nil {
+		p.next()
+		by, err := p.parseBy()
+		if err != nil {
+			return nil, err
+		}
+		call.By = by
+	}
+
+	if len(call.Args) != len(sig.args) {
+		return nil, fmt.Errorf("%s expects %d argument(s), got %d", name.text, len(sig.args), len(call.Args))
+	}
+	for i, kind := range sig.args {
+		arg := call.Args[i]
+		switch kind {
+		case argSelector:
+			if _, ok := arg.(*Selector); !ok {
+				return nil, fmt.Errorf("%s requires a metric selector, got %s", name.text, arg)
+			}
+		case argNumber:
+			// The only number arguments are topk/bottomk counts
+			n, ok := arg.(*NumberLit)
+			if !ok {
+				return nil, fmt.Errorf("%s argument %d must be a number", name.text, i+1)
+			}
+			if !positiveInt(n.Val) {
+				return nil, fmt.Errorf("%s argument %d must be a positive integer, got %s", name.text, i+1, n)
+			}
+		case argDuration:
+			if _, ok := arg.(*DurationLit); !ok {
+				return nil, fmt.Errorf("%s argument %d must be a duration such as 5m", name.text, i+1)
+			}
+		case argExpr:
+			if _, ok := arg.(*DurationLit); ok {
+				return nil, fmt.Errorf("unexpected duration %s in %s", arg, name.text)
+			}
+		}
+	}
+	return call, nil
+}
+
+// positiveInt reports whether v is a whole number of at least 1.
+func positiveInt(v float64) bool {
+	return v >= 1 && v == math.Trunc(v) && !math.IsInf(v, 0)
+}
+
+// parseBy parses "(n, ...)" after the by keyword.
+func (p *parser) parseBy() ([]int, error) {
+	if _, err := p.expect(tokLParen, `"(" after by`); err != nil {
+		return nil, err
+	}
+	var by []int
+	for {
+		t, err := p.expect(tokNumber, "segment index")
+		if err != nil {
+			return nil, err
+		}
+		if t.num < 0 || t.num != float64(int(t.num)) {
+			return nil, fmt.Errorf("segment index must be a non-negative integer at %d", t.pos)
+		}
+		by = append(by, int(t.num))
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokRParen, `")"`); err != nil {
+		return nil, err
+	}
+	return by, nil
+}
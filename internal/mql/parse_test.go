@@ -0,0 +1,115 @@
+package mql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	sel := func(p string) *Selector { return &Selector{Pattern: p} }
+	bin := func(op byte, l, r Node) *BinaryExpr { return &BinaryExpr{Op: op, LHS: l, RHS: r} }
+	num := func(v float64) *NumberLit { return &NumberLit{Val: v} }
+	tests := []struct {
+		in   string
+		want Node
+		str  string // String(), when it differs from in
+	}{
+		{in: "mem.used", want: sel("mem.used")},
+		{in: "cpu.core.*.usage", want: sel("cpu.core.*.usage")},
+		{in: "disk.dm-0.used", want: sel("disk.dm-0.used")},
+		{in: "1.5", want: num(1.5)},
+		{in: "-2", want: num(-2)},
+		{in: "- mem.used", want: &UnaryExpr{Expr: sel("mem.used")}, str: "-mem.used"},
+
+		// * and / bind tighter than + and -, and all are left-associative
+		{in: "a + b * c", want: bin('+', sel("a"), bin('*', sel("b"), sel("c")))},
+		{in: "a * b + c", want: bin('+', bin('*', sel("a"), sel("b")), sel("c"))},
+		{in: "(a + b) * c", want: bin('*', bin('+', sel("a"), sel("b")), sel("c"))},
+		{in: "a - b - c", want: bin('-', bin('-', sel("a"), sel("b")), sel("c"))},
+		{in: "a - (b - c)", want: bin('-', sel("a"), bin('-', sel("b"), sel("c")))},
+		{in: "a / b / c", want: bin('/', bin('/', sel("a"), sel("b")), sel("c"))},
+		{in: "a / (b * c)", want: bin('/', sel("a"), bin('*', sel("b"), sel("c")))},
+		{in: "((a))", want: sel("a"), str: "a"},
+		{in: "-(a + b)", want: &UnaryExpr{Expr: bin('+', sel("a"), sel("b"))}},
+		{in: "2 * -3", want: bin('*', num(2), num(-3))},
+		{in: "mem.used / mem.total * 100", want: bin('*', bin('/', sel("mem.used"), sel("mem.total")), num(100))},
+		// A * touching a dot is a wildcard, not a multiplication
+		{in: "a.*.x*2", want: bin('*', sel("a.*.x"), num(2)), str: "a.*.x * 2"},
+
+		{in: "rate(net.*.bytes_recv)", want: &Call{Func: "rate", Args: []Node{sel("net.*.bytes_recv")}}},
+		{in: "abs(a - b)", want: &Call{Func: "abs", Args: []Node{bin('-', sel("a"), sel("b"))}}},
+		{in: "avg_over_time(cpu.total.usage, 5m)", want: &Call{Func: "avg_over_time", Args: []Node{sel("cpu.total.usage"), &DurationLit{Seconds: 300, Text: "5m"}}}},
+		{in: "topk(3, a.*)", want: &Call{Func: "topk", Args: []Node{num(3), sel("a.*")}}},
+		{in: "topk(1e300, a.*)", want: &Call{Func: "topk", Args: []Node{num(1e300), sel("a.*")}}, str: "topk(1e+300, a.*)"},
+		{in: "sum(a.*)", want: &Call{Func: "sum", Args: []Node{sel("a.*")}}},
+
+		// by (...) before or after the arguments
+		{in: "sum by (1) (net.*.bytes_recv)", want: &Call{Func: "sum", Args: []Node{sel("net.*.bytes_recv")}, By: []int{1}}},
+		{in: "max(proc.*.*.cpu_pct) by (1, 2)", want: &Call{Func: "max", Args: []Node{sel("proc.*.*.cpu_pct")}, By: []int{1, 2}}, str: "max by (1, 2) (proc.*.*.cpu_pct)"},
+		{in: "sum by(0)(a.*)", want: &Call{Func: "sum", Args: []Node{sel("a.*")}, By: []int{0}}, str: "sum by (0) (a.*)"},
+		{in: "sum by (1) (a.*) / 2", want: bin('/', &Call{Func: "sum", Args: []Node{sel("a.*")}, By: []int{1}}, num(2))},
+
+		// Function names without a call are metric names
+		{in: "rate", want: sel("rate")},
+		{in: "count + 1", want: bin('+', sel("count"), num(1))},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+		str := tt.str
+		if str == "" {
+			str = tt.in
+		}
+		if got.String() != str {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got.String(), str)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "unexpected end of expression"},
+		{"a +", "unexpected end of expression"},
+		{"a b", `unexpected "b" at 2`},
+		{"(a + b", `expected ")" at end of expression`},
+		{"a + b)", `unexpected ")" at 5`},
+		{"a # b", `unexpected character '#' at 2`},
+		{"1.2.3", `bad number "1.2.3" at 0`},
+		{"1e400", `bad number "1e400" at 0`},
+		{"foo(a)", `unknown function "foo" at 0`},
+		{"rate(a + b)", "rate requires a metric selector, got a + b"},
+		{"rate(a, b)", "rate expects 1 argument(s), got 2"},
+		{"abs()", "abs expects 1 argument(s), got 0"},
+		{"abs(5m)", "unexpected duration 5m in abs"},
+		{"avg_over_time(a, 5)", "avg_over_time argument 2 must be a duration such as 5m"},
+		{"avg_over_time(a)", "avg_over_time expects 2 argument(s), got 1"},
+		{"topk(a, b)", "topk argument 1 must be a number"},
+		{"topk(0, a)", "topk argument 1 must be a positive integer, got 0"},
+		{"topk(-1, a)", "topk argument 1 must be a positive integer, got -1"},
+		{"bottomk(0.5, a)", "bottomk argument 1 must be a positive integer, got 0.5"},
+		{"topk(2.5, a)", "topk argument 1 must be a positive integer, got 2.5"},
+		{"rate by (1) (a)", "rate does not support by"},
+		{"sum by 1 (a)", `expected "(" after by at 7, got "1"`},
+		{"sum by (a) (b)", `expected segment index at 8, got "a"`},
+		{"sum by (-1) (a)", `expected segment index at 8, got "-"`},
+		{"sum by (1.5) (a)", "segment index must be a non-negative integer at 8"},
+		{"sum by (1 (a)", `expected ")" at 10, got "("`},
+		{"sum by (1) a", `expected "(" at 11, got "a"`},
+		{"sum by (1) (a) by (2)", `unexpected "by" at 15`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.in)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Parse(%q): err = %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
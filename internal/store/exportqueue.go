@@ -0,0 +1,69 @@
+package store
+
+import "time"
+
+// The export queue holds encoded payloads for exporters (such as Prometheus
+// remote_write) until the remote end has accepted them, so data collected
+// during an outage is sent once the endpoint is back.
+
+// QueuedExport is one payload waiting to be sent.
+type QueuedExport struct {
+	ID      int64
+	Created int64
+	Payload []byte
+}
+
+// EnqueueExport appends a payload to an exporter's queue. When the queue holds
+// more than max payloads the oldest are deleted; the number deleted is returned.
+func (s *Store) EnqueueExport(exporter string, payload []byte, max int) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO export_queue (exporter, created, payload) VALUES (?, ?, ?)",
+		exporter, time.Now().Unix(), payload)
+	if err != nil {
+		return 0, err
+	}
+	var dropped int64
+	if max > 0 {
+		id, _ := res.LastInsertId()
+		res, err := tx.Exec("DELETE FROM export_queue WHERE exporter = ? AND id <= ?", exporter, id-int64(max))
+		if err != nil {
+			return 0, err
+		}
+		dropped, _ = res.RowsAffected()
+	}
+	return dropped, tx.Commit()
+}
+
+// NextExport returns the oldest queued payload for an exporter, or nil.
+func (s *Store) NextExport(exporter string) (*QueuedExport, error) {
+	rows, err := s.db.Query("SELECT id, created, payload FROM export_queue WHERE exporter = ? ORDER BY id LIMIT 1", exporter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var q QueuedExport
+	if err := rows.Scan(&q.ID, &q.Created, &q.Payload); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// DeleteExport removes a payload once it has been sent (or rejected).
+func (s *Store) DeleteExport(id int64) error {
+	_, err := s.db.Exec("DELETE FROM export_queue WHERE id = ?", id)
+	return err
+}
+
+// ExportQueueLen returns the number of payloads queued for an exporter.
+func (s *Store) ExportQueueLen(exporter string) (int64, error) {
+	var n int64
+	err := s.db.QueryRow("SELECT COUNT(*) FROM export_queue WHERE exporter = ?", exporter).Scan(&n)
+	return n, err
+}
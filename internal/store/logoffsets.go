@@ -0,0 +1,52 @@
+package store
+
+// Log offsets record how far the logwatch collector has read each file, so
+// it resumes where it stopped after a restart instead of skipping or
+// recounting lines.
+
+// LogOffset is the read position in a log file.
+type LogOffset struct {
+	Inode   uint64
+	Offset  int64
+	Updated int64 // unix time the offset was saved
+}
+
+// GetLogOffsets returns the saved offsets keyed by file path.
+func (s *Store) GetLogOffsets() (map[string]LogOffset, error) {
+	rows, err := s.db.Query("SELECT path, inode, offset, updated FROM log_offsets")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[string]LogOffset)
+	for rows.Next() {
+		var path string
+		var inode int64
+		var o LogOffset
+		if err := rows.Scan(&path, &inode, &o.Offset, &o.Updated); err != nil {
+			return nil, err
+		}
+		o.Inode = uint64(inode)
+		result[path] = o
+	}
+	return result, rows.Err()
+}
+
+// SaveLogOffsets replaces the saved offsets with offsets.
+func (s *Store) SaveLogOffsets(offsets map[string]LogOffset) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM log_offsets"); err != nil {
+		return err
+	}
+	for path, o := range offsets {
+		if _, err := tx.Exec("INSERT INTO log_offsets (path, inode, offset, updated) VALUES (?, ?, ?, ?)",
+			path, int64(o.Inode), o.Offset, o.Updated); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -47,6 +47,43 @@ var migrations = []string{
 		message_ko TEXT NOT NULL DEFAULT '',
 		enabled INTEGER NOT NULL DEFAULT 1
 	);`,
+
+	// Normalized sample layout. Existing metric_samples rows are moved over
+	// in the background by migrateLegacy.
+	`CREATE TABLE IF NOT EXISTS series (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		collector TEXT NOT NULL,
+		labels TEXT NOT NULL DEFAULT '',
+		unit TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL DEFAULT 'gauge',
+		UNIQUE (name, collector, labels)
+	);
+	CREATE TABLE IF NOT EXISTS samples (
+		series_id INTEGER NOT NULL,
+		timestamp INTEGER NOT NULL,
+		value REAL NOT NULL,
+		PRIMARY KEY (series_id, timestamp)
+	) WITHOUT ROWID;`,
+
+	`CREATE TABLE IF NOT EXISTS export_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		exporter TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		payload BLOB NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_export_queue_exporter ON export_queue(exporter, id);`,
+
+	`CREATE TABLE IF NOT EXISTS log_offsets (
+		path TEXT PRIMARY KEY,
+		inode INTEGER NOT NULL,
+		offset INTEGER NOT NULL,
+		updated INTEGER NOT NULL
+	);`,
+
+	// enabled_set is 0 for rows only holding a config saved before the
+	// collector was ever enabled or disabled
+	`ALTER TABLE collector_state ADD COLUMN enabled_set INTEGER NOT NULL DEFAULT 1;`,
 }
 
 func runMigrations(db *sql.DB) error {
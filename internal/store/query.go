@@ -0,0 +1,428 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// ErrInvalidQuery is returned for unknown aggregation or function names.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// DefaultMaxPoints is the default limit on points per series in one query.
+const DefaultMaxPoints = 11000
+
+// Query describes a history query.
+type Query struct {
+	Names []string // exact names, globs such as "cpu.core.*.usage" or /regex/
+	From  int64
+	To    int64
+	Step  int // bucket width in seconds; 0 returns raw samples
+
+	// Agg combines the samples of one series within a step bucket:
+	// avg (default), min, max, sum, count, last, p50, p95 or p99.
+	Agg string
+	// Fn transforms each series before bucketing: "rate" is the per-second
+	// increase of a cumulative counter (resets are skipped), "derivative" the
+	// signed per-second change of any value.
+	Fn string
+	// Reduce combines all matching series into one per timestamp using any Agg
+	// function except last. The result is named after the first requested name.
+	Reduce string
+}
+
+// sqlAggs are the aggregations SQLite can compute directly per bucket.
+var sqlAggs = map[string]string{
+	"avg": "AVG", "min": "MIN", "max": "MAX", "sum": "SUM", "count": "COUNT",
+}
+
+// percentileAggs maps percentile aggregation names to their rank.
+var percentileAggs = map[string]float64{"p50": 0.50, "p95": 0.95, "p99": 0.99}
+
+func validAgg(name string) bool {
+	_, ok := sqlAggs[name]
+	_, pct := percentileAggs[name]
+	return ok || pct || name == "last"
+}
+
+func (q *Query) validate() error {
+	if q.Agg == "" {
+		q.Agg = "avg"
+	}
+	if !validAgg(q.Agg) {
+		return fmt.Errorf("%w: unknown agg %q", ErrInvalidQuery, q.Agg)
+	}
+	if q.Fn != "" && q.Fn != "rate" && q.Fn != "derivative" {
+		return fmt.Errorf("%w: unknown fn %q", ErrInvalidQuery, q.Fn)
+	}
+	if q.Reduce != "" && (!validAgg(q.Reduce) || q.Reduce == "last") {
+		return fmt.Errorf("%w: unknown reduce %q", ErrInvalidQuery, q.Reduce)
+	}
+	if q.Step < 0 {
+		return fmt.Errorf("%w: step must be >= 0", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// QueryMetrics retrieves metric samples with optional downsampling.
+// step is in seconds; if step > 0, data is averaged per step.
+func (s *Store) QueryMetrics(ctx context.Context, name string, from, to int64, step int) ([]model.MetricSample, error) {
+	return s.Query(ctx, Query{Names: []string{name}, From: from, To: to, Step: step})
+}
+
+// QueryMultiMetrics retrieves samples for multiple metric names.
+func (s *Store) QueryMultiMetrics(ctx context.Context, names []string, from, to int64, step int) ([]model.MetricSample, error) {
+	return s.Query(ctx, Query{Names: names, From: from, To: to, Step: step})
+}
+
+// Query runs a history query and returns the samples ordered by time.
+// Plain per-bucket aggregates are computed in SQLite; percentiles, last,
+// rate/derivative and reduce are applied in Go over the fetched series.
+func (s *Store) Query(ctx context.Context, q Query) ([]model.MetricSample, error) {
+	series, err := s.QuerySeries(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return flattenSeries(series), nil
+}
+
+// QuerySeries runs a history query and returns the result grouped by series.
+// With Reduce set there is a single series named after the first name.
+func (s *Store) QuerySeries(ctx context.Context, q Query) ([]*Series, error) {
+	var series []*Series
+	err := s.StreamSeries(ctx, q, func(sp *Series) error {
+		series = append(series, sp)
+		return nil
+	})
+	return series, err
+}
+
+// StreamSeries runs a history query and calls fn with each series as soon as
+// its rows have been read from the cursor, so only one series is held in
+// memory at a time. Reduce needs every series and is buffered. An error from
+// fn stops the query and is returned.
+func (s *Store) StreamSeries(ctx context.Context, q Query, fn func(*Series) error) error {
+	if len(q.Names) == 0 {
+		return nil
+	}
+	if err := q.validate(); err != nil {
+		return err
+	}
+	q.Step = s.AutoStep(q.From, q.To, q.Step)
+
+	names, err := s.resolveNames(ctx, q.Names)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	_, sqlAgg := sqlAggs[q.Agg]
+	bucketInSQL := q.Step > 0 && q.Fn == "" && sqlAgg
+
+	transform := func(sp *Series) {
+		switch q.Fn {
+		case "rate":
+			sp.differentiate(true)
+		case "derivative":
+			sp.differentiate(false)
+		}
+		if q.Step > 0 && !bucketInSQL {
+			sp.bucket(int64(q.Step), q.Agg)
+		}
+	}
+	if q.Reduce == "" {
+		return s.scanSeries(ctx, names, q, bucketInSQL, func(sp *Series) error {
+			transform(sp)
+			return fn(sp)
+		})
+	}
+
+	var all []*Series
+	if err := s.scanSeries(ctx, names, q, bucketInSQL, func(sp *Series) error {
+		transform(sp)
+		all = append(all, sp)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, sp := range reduceSeries(all, q.Names[0], q.Reduce) {
+		if err := fn(sp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMaxPoints sets the maximum points per series a query may return; larger
+// ranges are downsampled by AutoStep. n <= 0 disables it.
+func (s *Store) SetMaxPoints(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.maxPoints.Store(int64(n))
+}
+
+// AutoStep returns the step to use for a query over [from, to]. If step
+// would yield more than the configured maximum points per series (a step of
+// 0 yields up to one point per second), it is raised to the smallest step
+// that stays within the limit.
+func (s *Store) AutoStep(from, to int64, step int) int {
+	limit := s.maxPoints.Load()
+	span := to - from
+	if limit <= 0 || span <= 0 {
+		return step
+	}
+	points := span
+	if step > 0 {
+		points = span / int64(step)
+	}
+	if points <= limit {
+		return step
+	}
+	return int((span + limit - 1) / limit)
+}
+
+// Series holds the points of one series, ordered by timestamp.
+type Series struct {
+	Collector  string    `json:"collector"`
+	Name       string    `json:"name"`
+	Labels     string    `json:"labels,omitempty"`
+	Timestamps []int64   `json:"timestamps"`
+	Values     []float64 `json:"values"`
+}
+
+// scanSeries reads the samples of the named metrics and calls fn for each
+// series once its last row has been read. With bucket set the values are
+// already aggregated per step by SQLite.
+func (s *Store) scanSeries(ctx context.Context, names []string, q Query, bucket bool, fn func(*Series) error) error {
+	src, args := s.sampleSource(names, q.From, q.To)
+	// Series are told apart by id, which matches the samples primary key;
+	// legacy rows have no id yet, so while they remain the identity is used
+	key := "series_id"
+	if s.legacy.Load() {
+		key = "collector, metric_name, labels"
+	}
+	var query string
+	if bucket {
+		query = fmt.Sprintf(`%s
+			SELECT (timestamp / %d * %d) as ts, collector, metric_name, %s(value), labels
+			FROM src
+			GROUP BY %s, ts
+			ORDER BY %s, ts`, src, q.Step, q.Step, sqlAggs[q.Agg], key, key)
+	} else {
+		query = fmt.Sprintf(`%s
+			SELECT timestamp, collector, metric_name, value, labels
+			FROM src
+			ORDER BY %s, timestamp`, src, key)
+	}
+
+	ctx, cancel := s.readCtx(ctx)
+	defer cancel()
+	rows, err := s.rdb.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var cur *Series
+	for rows.Next() {
+		var m model.MetricSample
+		if err := rows.Scan(&m.Timestamp, &m.Collector, &m.MetricName, &m.Value, &m.Labels); err != nil {
+			return err
+		}
+		if cur == nil || cur.Collector != m.Collector || cur.Name != m.MetricName || cur.Labels != m.Labels {
+			if cur != nil {
+				if err := fn(cur); err != nil {
+					return err
+				}
+			}
+			cur = &Series{Collector: m.Collector, Name: m.MetricName, Labels: m.Labels}
+		}
+		cur.Timestamps = append(cur.Timestamps, m.Timestamp)
+		cur.Values = append(cur.Values, m.Value)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if cur != nil {
+		return fn(cur)
+	}
+	return nil
+}
+
+// sampleSource returns a CTE named src yielding (series_id, timestamp,
+// collector, metric_name, value, labels) for the given exact names and time
+// range, reading the legacy metric_samples table too while its migration is
+// in progress. Legacy rows have a NULL series_id. Selecting the ids through
+// a subquery makes SQLite visit the series in id order, so rows ordered by
+// (series_id, timestamp) stream from the primary key without a sort.
+func (s *Store) sampleSource(names []string, from, to int64) (string, []interface{}) {
+	var args []interface{}
+	cond := func(col string) string {
+		for _, n := range names {
+			args = append(args, n)
+		}
+		return fmt.Sprintf("%s IN (%s)", col, strings.TrimSuffix(strings.Repeat("?,", len(names)), ","))
+	}
+
+	src := `WITH src AS (
+			SELECT s.series_id, s.timestamp, se.collector, se.name AS metric_name, s.value, se.labels
+			FROM series se JOIN samples s ON s.series_id = se.id
+			WHERE se.id IN (SELECT id FROM series WHERE ` + cond("name") + `) AND s.timestamp >= ? AND s.timestamp <= ?`
+	args = append(args, from, to)
+	if s.legacy.Load() {
+		src += `
+			UNION ALL
+			SELECT NULL, timestamp, collector, metric_name, value, COALESCE(labels, '')
+			FROM metric_samples
+			WHERE ` + cond("metric_name") + ` AND timestamp >= ? AND timestamp <= ?`
+		args = append(args, from, to)
+	}
+	return src + ")", args
+}
+
+// differentiate replaces the values with their per-second change between
+// consecutive points; the first point is dropped. With counter set, decreases
+// are treated as resets and skipped.
+func (sp *Series) differentiate(counter bool) {
+	var ts []int64
+	var vals []float64
+	for i := 1; i < len(sp.Timestamps); i++ {
+		dt := sp.Timestamps[i] - sp.Timestamps[i-1]
+		dv := sp.Values[i] - sp.Values[i-1]
+		if dt <= 0 || (counter && dv < 0) {
+			continue
+		}
+		ts = append(ts, sp.Timestamps[i])
+		vals = append(vals, dv/float64(dt))
+	}
+	sp.Timestamps, sp.Values = ts, vals
+}
+
+// bucket aggregates the points into step-aligned buckets.
+func (sp *Series) bucket(step int64, agg string) {
+	var ts []int64
+	var vals []float64
+	for i := 0; i < len(sp.Timestamps); {
+		b := sp.Timestamps[i] / step * step
+		j := i
+		for j < len(sp.Timestamps) && sp.Timestamps[j]/step*step == b {
+			j++
+		}
+		ts = append(ts, b)
+		vals = append(vals, aggregate(sp.Values[i:j], agg))
+		i = j
+	}
+	sp.Timestamps, sp.Values = ts, vals
+}
+
+// aggregate applies an aggregation to vals, which are in time order.
+func aggregate(vals []float64, agg string) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	switch agg {
+	case "min":
+		m := vals[0]
+		for _, v := range vals[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	case "max":
+		m := vals[0]
+		for _, v := range vals[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	case "sum", "avg":
+		var sum float64
+		for _, v := range vals {
+			sum += v
+		}
+		if agg == "avg" {
+			return sum / float64(len(vals))
+		}
+		return sum
+	case "count":
+		return float64(len(vals))
+	case "last":
+		return vals[len(vals)-1]
+	}
+	if p, ok := percentileAggs[agg]; ok {
+		sorted := append([]float64(nil), vals...)
+		sort.Float64s(sorted)
+		return Percentile(sorted, p)
+	}
+	return 0
+}
+
+// Percentile returns the p-th percentile (0..1) of sorted values using linear
+// interpolation between the closest ranks, or NaN if there are none. It is
+// shared with collectors that aggregate raw values, such as statsd timers.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := rank - float64(lo)
+	return sorted[lo] + (sorted[hi]-sorted[lo])*frac
+}
+
+// reduceSeries combines all series into one, aggregating the values that
+// share a timestamp.
+func reduceSeries(series []*Series, name, agg string) []*Series {
+	if len(series) == 0 {
+		return nil
+	}
+	byTS := make(map[int64][]float64)
+	for _, sp := range series {
+		for i, t := range sp.Timestamps {
+			byTS[t] = append(byTS[t], sp.Values[i])
+		}
+	}
+	stamps := make([]int64, 0, len(byTS))
+	for t := range byTS {
+		stamps = append(stamps, t)
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+
+	out := &Series{Collector: series[0].Collector, Name: name, Timestamps: stamps, Values: make([]float64, len(stamps))}
+	for i, t := range stamps {
+		out.Values[i] = aggregate(byTS[t], agg)
+	}
+	return []*Series{out}
+}
+
+// flattenSeries returns the points of all series as samples ordered by time.
+func flattenSeries(series []*Series) []model.MetricSample {
+	var n int
+	for _, sp := range series {
+		n += len(sp.Timestamps)
+	}
+	result := make([]model.MetricSample, 0, n)
+	for _, sp := range series {
+		for i, t := range sp.Timestamps {
+			result = append(result, model.MetricSample{
+				Timestamp:  t,
+				Collector:  sp.Collector,
+				MetricName: sp.Name,
+				Value:      sp.Values[i],
+				Labels:     sp.Labels,
+			})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Timestamp < result[j].Timestamp })
+	return result
+}
@@ -0,0 +1,391 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// newTestStore opens a store on a fresh database in a temporary directory.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// point is a query result reduced to what the tests compare.
+type point struct {
+	ts     int64
+	labels string
+	v      float64
+}
+
+func samplePoints(samples []model.MetricSample) []point {
+	out := make([]point, len(samples))
+	for i, m := range samples {
+		out[i] = point{m.Timestamp, m.Labels, m.Value}
+	}
+	return out
+}
+
+func seriesPoints(sp *Series) []point {
+	out := make([]point, len(sp.Timestamps))
+	for i, t := range sp.Timestamps {
+		out[i] = point{t, sp.Labels, sp.Values[i]}
+	}
+	return out
+}
+
+func equalPoints(a, b []point) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ts != b[i].ts || a[i].labels != b[i].labels || !approxEqual(a[i].v, b[i].v) {
+			return false
+		}
+	}
+	return true
+}
+
+func approxEqual(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Abs(a-b) < 1e-9
+}
+
+// seedQueryStore stores a gauge sampled every 10s from 1000 to 1050 and a
+// counter for two interfaces from 1000 to 1040, where eth0 resets at 1030.
+func seedQueryStore(t *testing.T) *Store {
+	t.Helper()
+	s := newTestStore(t)
+	var samples []model.MetricSample
+	for i, v := range []float64{10, 20, 30, 40, 50, 60} {
+		samples = append(samples, model.MetricSample{Timestamp: 1000 + int64(i)*10, Collector: "cpu", MetricName: "cpu.usage", Value: v})
+	}
+	for i, v := range []float64{100, 200, 300, 50, 150} {
+		samples = append(samples, model.MetricSample{Timestamp: 1000 + int64(i)*10, Collector: "network", MetricName: "net.rx_bytes", Value: v, Labels: "iface=eth0"})
+	}
+	for i, v := range []float64{0, 10, 20, 30, 40} {
+		samples = append(samples, model.MetricSample{Timestamp: 1000 + int64(i)*10, Collector: "network", MetricName: "net.rx_bytes", Value: v, Labels: "iface=eth1"})
+	}
+	if err := s.InsertSamples(samples); err != nil {
+		t.Fatalf("InsertSamples: %v", err)
+	}
+	return s
+}
+
+func TestQuery(t *testing.T) {
+	s := seedQueryStore(t)
+
+	tests := []struct {
+		name      string
+		q         Query
+		maxPoints int
+		want      []point
+		wantErr   error
+	}{
+		{
+			name: "raw",
+			q:    Query{Names: []string{"cpu.usage"}, From: 1000, To: 1030},
+			want: []point{{1000, "", 10}, {1010, "", 20}, {1020, "", 30}, {1030, "", 40}},
+		},
+		{
+			name: "glob",
+			q:    Query{Names: []string{"cpu.*"}, From: 1050, To: 1050},
+			want: []point{{1050, "", 60}},
+		},
+		{
+			name: "empty range",
+			q:    Query{Names: []string{"cpu.usage"}, From: 2000, To: 3000},
+		},
+		{
+			name: "empty range with step and rate",
+			q:    Query{Names: []string{"net.rx_bytes"}, From: 2000, To: 3000, Step: 60, Fn: "rate"},
+		},
+		{
+			name: "unknown metric",
+			q:    Query{Names: []string{"mem.used"}, From: 0, To: 5000},
+		},
+		{
+			name: "no names",
+			q:    Query{From: 0, To: 5000},
+		},
+		{
+			name: "avg per step in SQL",
+			q:    Query{Names: []string{"cpu.usage"}, From: 1000, To: 1050, Step: 20},
+			want: []point{{1000, "", 15}, {1020, "", 35}, {1040, "", 55}},
+		},
+		{
+			name: "max per step in SQL",
+			q:    Query{Names: []string{"cpu.usage"}, From: 1000, To: 1050, Step: 20, Agg: "max"},
+			want: []point{{1000, "", 20}, {1020, "", 40}, {1040, "", 60}},
+		},
+		{
+			name: "p50 per step in Go",
+			q:    Query{Names: []string{"cpu.usage"}, From: 1000, To: 1050, Step: 30, Agg: "p50"},
+			want: []point{{990, "", 15}, {1020, "", 40}, {1050, "", 60}},
+		},
+		{
+			name: "last per step in Go",
+			q:    Query{Names: []string{"cpu.usage"}, From: 1000, To: 1050, Step: 30, Agg: "last"},
+			want: []point{{990, "", 20}, {1020, "", 50}, {1050, "", 60}},
+		},
+		{
+			name: "rate skips counter reset",
+			q:    Query{Names: []string{"net.rx_bytes"}, From: 1000, To: 1040, Fn: "rate"},
+			want: []point{
+				{1010, "iface=eth0", 10}, {1010, "iface=eth1", 1},
+				{1020, "iface=eth0", 10}, {1020, "iface=eth1", 1},
+				{1030, "iface=eth1", 1},
+				{1040, "iface=eth0", 10}, {1040, "iface=eth1", 1},
+			},
+		},
+		{
+			name: "derivative keeps decrease",
+			q:    Query{Names: []string{"net.rx_bytes"}, From: 1000, To: 1040, Fn: "derivative", Step: 20, Agg: "min"},
+			want: []point{
+				{1000, "iface=eth0", 10}, {1000, "iface=eth1", 1},
+				{1020, "iface=eth0", -25}, {1020, "iface=eth1", 1},
+				{1040, "iface=eth0", 10}, {1040, "iface=eth1", 1},
+			},
+		},
+		{
+			name: "reduce sum of rates",
+			q:    Query{Names: []string{"net.rx_bytes"}, From: 1000, To: 1040, Fn: "rate", Reduce: "sum"},
+			want: []point{{1010, "", 11}, {1020, "", 11}, {1030, "", 1}, {1040, "", 11}},
+		},
+		{
+			name:      "auto step",
+			q:         Query{Names: []string{"cpu.usage"}, From: 1000, To: 1050},
+			maxPoints: 3,
+			want:      []point{{986, "", 10}, {1003, "", 20}, {1020, "", 35}, {1037, "", 55}},
+		},
+		{
+			name:    "unknown agg",
+			q:       Query{Names: []string{"cpu.usage"}, Agg: "median"},
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name:    "unknown fn",
+			q:       Query{Names: []string{"cpu.usage"}, Fn: "delta"},
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name:    "reduce last",
+			q:       Query{Names: []string{"cpu.usage"}, Reduce: "last"},
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name:    "negative step",
+			q:       Query{Names: []string{"cpu.usage"}, Step: -1},
+			wantErr: ErrInvalidQuery,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxPoints := tt.maxPoints
+			if maxPoints == 0 {
+				maxPoints = DefaultMaxPoints
+			}
+			s.SetMaxPoints(maxPoints)
+
+			got, err := s.Query(context.Background(), tt.q)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if gp := samplePoints(got); !equalPoints(gp, tt.want) {
+				t.Errorf("got %v, want %v", gp, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuerySeriesReduceName(t *testing.T) {
+	s := seedQueryStore(t)
+	series, err := s.QuerySeries(context.Background(), Query{Names: []string{"net.*"}, From: 1000, To: 1000, Reduce: "max"})
+	if err != nil {
+		t.Fatalf("QuerySeries: %v", err)
+	}
+	if len(series) != 1 || series[0].Name != "net.*" || series[0].Collector != "network" {
+		t.Fatalf("got %+v, want one series named net.* from network", series)
+	}
+	if got, want := seriesPoints(series[0]), []point{{1000, "", 100}}; !equalPoints(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAutoStep(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxPoints int
+		from, to  int64
+		step      int
+		want      int
+	}{
+		{"within limit raw", 100, 0, 50, 0, 0},
+		{"within limit stepped", 100, 0, 1000, 20, 20},
+		{"raw raised", 100, 0, 1000, 0, 10},
+		{"step raised", 100, 0, 1000, 5, 10},
+		{"rounds up", 100, 0, 1001, 0, 11},
+		{"empty span", 100, 1000, 1000, 0, 0},
+		{"inverted span", 100, 1000, 0, 5, 5},
+		{"disabled", 0, 0, 1 << 30, 0, 0},
+	}
+	s := newTestStore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.SetMaxPoints(tt.maxPoints)
+			if got := s.AutoStep(tt.from, tt.to, tt.step); got != tt.want {
+				t.Errorf("AutoStep(%d, %d, %d) = %d, want %d", tt.from, tt.to, tt.step, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDifferentiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		counter bool
+		ts      []int64
+		vals    []float64
+		want    []point
+	}{
+		{"empty", true, nil, nil, []point{}},
+		{"single point", true, []int64{10}, []float64{5}, []point{}},
+		{"steady", true, []int64{0, 10, 20}, []float64{0, 50, 150}, []point{{10, "", 5}, {20, "", 10}}},
+		{"counter reset skipped", true, []int64{0, 10, 20, 30}, []float64{100, 200, 20, 40}, []point{{10, "", 10}, {30, "", 2}}},
+		{"derivative keeps decrease", false, []int64{0, 10, 20}, []float64{100, 200, 20}, []point{{10, "", 10}, {20, "", -18}}},
+		{"duplicate timestamp skipped", false, []int64{0, 0, 10}, []float64{1, 2, 12}, []point{{10, "", 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := &Series{Timestamps: tt.ts, Values: tt.vals}
+			sp.differentiate(tt.counter)
+			if got := seriesPoints(sp); !equalPoints(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		name string
+		step int64
+		agg  string
+		ts   []int64
+		vals []float64
+		want []point
+	}{
+		{"empty", 60, "avg", nil, nil, []point{}},
+		{"aligned", 60, "avg", []int64{0, 30, 60, 90}, []float64{1, 3, 5, 7}, []point{{0, "", 2}, {60, "", 6}}},
+		{"gap", 60, "sum", []int64{10, 200, 230}, []float64{1, 2, 3}, []point{{0, "", 1}, {180, "", 5}}},
+		{"last", 10, "last", []int64{1, 5, 12}, []float64{1, 2, 3}, []point{{0, "", 2}, {10, "", 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := &Series{Timestamps: tt.ts, Values: tt.vals}
+			sp.bucket(tt.step, tt.agg)
+			if got := seriesPoints(sp); !equalPoints(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	vals := []float64{4, 1, 3, 2}
+	tests := []struct {
+		agg  string
+		vals []float64
+		want float64
+	}{
+		{"avg", vals, 2.5},
+		{"min", vals, 1},
+		{"max", vals, 4},
+		{"sum", vals, 10},
+		{"count", vals, 4},
+		{"last", vals, 2},
+		{"p50", vals, 2.5},
+		{"p95", vals, 3.85},
+		{"p99", vals, 3.97},
+		{"avg", nil, 0},
+		{"p99", nil, 0},
+		{"unknown", vals, 0},
+	}
+	for _, tt := range tests {
+		if got := aggregate(tt.vals, tt.agg); !approxEqual(got, tt.want) {
+			t.Errorf("aggregate(%v, %q) = %v, want %v", tt.vals, tt.agg, got, tt.want)
+		}
+	}
+	if vals[0] != 4 {
+		t.Errorf("aggregate sorted its input: %v", vals)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 0.5, math.NaN()},
+		{[]float64{7}, 0.99, 7},
+		{[]float64{1, 2, 3, 4}, 0, 1},
+		{[]float64{1, 2, 3, 4}, 1, 4},
+		{[]float64{1, 2, 3, 4}, 0.5, 2.5},
+		{[]float64{1, 2, 3, 4}, 0.99, 3.97},
+		{[]float64{10, 20, 30}, 0.5, 20},
+	}
+	for _, tt := range tests {
+		if got := Percentile(tt.sorted, tt.p); !approxEqual(got, tt.want) {
+			t.Errorf("Percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestReduceSeries(t *testing.T) {
+	a := &Series{Collector: "network", Name: "net.rx", Labels: "iface=eth0", Timestamps: []int64{0, 10, 20}, Values: []float64{1, 2, 3}}
+	b := &Series{Collector: "network", Name: "net.rx", Labels: "iface=eth1", Timestamps: []int64{10, 30}, Values: []float64{4, 5}}
+	tests := []struct {
+		name   string
+		series []*Series
+		agg    string
+		want   []point
+	}{
+		{"sum", []*Series{a, b}, "sum", []point{{0, "", 1}, {10, "", 6}, {20, "", 3}, {30, "", 5}}},
+		{"avg", []*Series{a, b}, "avg", []point{{0, "", 1}, {10, "", 3}, {20, "", 3}, {30, "", 5}}},
+		{"count", []*Series{a, b}, "count", []point{{0, "", 1}, {10, "", 2}, {20, "", 1}, {30, "", 1}}},
+		{"single", []*Series{b}, "max", []point{{10, "", 4}, {30, "", 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := reduceSeries(tt.series, "net.*", tt.agg)
+			if len(out) != 1 || out[0].Name != "net.*" || out[0].Collector != "network" || out[0].Labels != "" {
+				t.Fatalf("got %+v, want one unlabeled series named net.*", out)
+			}
+			if got := seriesPoints(out[0]); !equalPoints(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if out := reduceSeries(nil, "net.*", "sum"); out != nil {
+		t.Errorf("reduceSeries(nil) = %+v, want nil", out)
+	}
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxSeries is the default limit on the number of series one query may
+// select.
+const DefaultMaxSeries = 500
+
+// ErrTooManySeries is returned when the selectors of a query match more series
+// than the configured limit.
+var ErrTooManySeries = errors.New("too many series")
+
+// selector matches metric names. A name is either exact, a glob such as
+// cpu.core.*.usage or a regular expression between slashes such as
+// /cpu\.core\.[0-3]\.usage/, which must match the whole name. Globs use
+// SQLite GLOB syntax (*, ? and [...]) except that * and ? stay within one
+// dot-separated segment, as in alert rule patterns: disk.*.used_pct does not
+// match disk.dm.0.used_pct.
+type selector struct {
+	exact string
+	re    *regexp.Regexp
+}
+
+// isRegex reports whether name is written as /regex/.
+func isRegex(name string) bool {
+	return len(name) >= 2 && name[0] == '/' && name[len(name)-1] == '/'
+}
+
+func isGlob(name string) bool { return strings.ContainsAny(name, "*?[") }
+
+func parseSelector(name string) (selector, error) {
+	switch {
+	case isRegex(name):
+		re, err := regexp.Compile("^(?:" + name[1:len(name)-1] + ")$")
+		if err != nil {
+			return selector{}, fmt.Errorf("%w: bad regex %s: %v", ErrInvalidQuery, name, err)
+		}
+		return selector{re: re}, nil
+	case isGlob(name):
+		re, err := regexp.Compile("^" + globToRegexp(name) + "$")
+		if err != nil {
+			return selector{}, fmt.Errorf("%w: bad pattern %s: %v", ErrInvalidQuery, name, err)
+		}
+		return selector{re: re}, nil
+	}
+	return selector{exact: name}, nil
+}
+
+func (sel selector) match(name string) bool {
+	if sel.re != nil {
+		return sel.re.MatchString(name)
+	}
+	return sel.exact == name
+}
+
+// globToRegexp translates a glob to a regular expression in which * and ?
+// do not match ".".
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(`[^.]*`)
+		case '?':
+			b.WriteString(`[^.]`)
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") || strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// SetMaxSeries sets the limit on series selected per query; n <= 0 disables it.
+func (s *Store) SetMaxSeries(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.maxSeries.Store(int64(n))
+}
+
+// resolveNames expands glob and regex selectors against the known series and
+// returns the matching metric names, sorted. Queries of exact names only are
+// returned unchanged. It fails with ErrTooManySeries when the selectors match
+// more series than the limit.
+func (s *Store) resolveNames(ctx context.Context, names []string) ([]string, error) {
+	sels := make([]selector, len(names))
+	patterns := false
+	for i, n := range names {
+		sel, err := parseSelector(n)
+		if err != nil {
+			return nil, err
+		}
+		sels[i] = sel
+		patterns = patterns || sel.re != nil
+	}
+	if !patterns {
+		return names, nil
+	}
+
+	ctx, cancel := s.readCtx(ctx)
+	defer cancel()
+	query := "SELECT name, collector, labels FROM series"
+	if s.legacy.Load() {
+		query += " UNION SELECT DISTINCT metric_name, collector, COALESCE(labels, '') FROM metric_samples"
+	}
+	rows, err := s.rdb.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matched := make(map[string]bool)
+	var count int64
+	for rows.Next() {
+		var k seriesKey
+		if err := rows.Scan(&k.name, &k.collector, &k.labels); err != nil {
+			return nil, err
+		}
+		for _, sel := range sels {
+			if sel.match(k.name) {
+				matched[k.name] = true
+				count++
+				break
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if limit := s.maxSeries.Load(); limit > 0 && count > limit {
+		return nil, fmt.Errorf("%w: %s matches %d series, limit is %d; narrow the selector",
+			ErrTooManySeries, strings.Join(names, ","), count, limit)
+	}
+
+	out := make([]string, 0, len(matched))
+	for n := range matched {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+func TestSelectorMatch(t *testing.T) {
+	tests := []struct {
+		sel   string
+		match []string
+		miss  []string
+	}{
+		{
+			sel:   "cpu.total.usage",
+			match: []string{"cpu.total.usage"},
+			miss:  []string{"cpu.total.usage2", "cpu.total"},
+		},
+		{
+			sel:   "cpu.core.*.usage",
+			match: []string{"cpu.core.0.usage", "cpu.core.15.usage", "cpu.core..usage"},
+			miss:  []string{"cpu.core.0.1.usage", "cpu.core.0.usage_pct", "cpu.total.usage"},
+		},
+		{
+			// * stays within a segment, as in alert rule patterns
+			sel:   "disk.*.used_pct",
+			match: []string{"disk.sda1.used_pct", "disk.dm-0.used_pct"},
+			miss:  []string{"disk.data.vol.used_pct"},
+		},
+		{
+			sel:   "cpu.*",
+			match: []string{"cpu.usage"},
+			miss:  []string{"cpu.core.0.usage", "cpu"},
+		},
+		{
+			sel:   "net.eth?.bytes_recv",
+			match: []string{"net.eth0.bytes_recv"},
+			miss:  []string{"net.eth10.bytes_recv", "net.eth.bytes_recv", "net.eth..bytes_recv"},
+		},
+		{
+			sel:   "net.eth[0-9].bytes_recv",
+			match: []string{"net.eth0.bytes_recv", "net.eth9.bytes_recv"},
+			miss:  []string{"net.ethx.bytes_recv", "net.eth10.bytes_recv"},
+		},
+		{
+			sel:   "net.eth[^0].bytes_recv",
+			match: []string{"net.eth1.bytes_recv"},
+			miss:  []string{"net.eth0.bytes_recv"},
+		},
+		{
+			sel:   "net.eth[!0].bytes_recv",
+			match: []string{"net.eth1.bytes_recv"},
+			miss:  []string{"net.eth0.bytes_recv"},
+		},
+		{
+			// An unterminated class is a literal "["
+			sel:   "app.[x*",
+			match: []string{"app.[x", "app.[xy"},
+			miss:  []string{"app.x"},
+		},
+		{
+			// Metacharacters other than * ? [ are literal
+			sel:   "app.a+b.*",
+			match: []string{"app.a+b.c"},
+			miss:  []string{"app.aab.c", "app.a+b.c.d"},
+		},
+		{
+			sel:   `/cpu\.core\.([0-9]|1[0-5])\.usage/`,
+			match: []string{"cpu.core.3.usage", "cpu.core.15.usage"},
+			miss:  []string{"cpu.core.16.usage", "xcpu.core.3.usage", "cpu.core.3.usage_pct"},
+		},
+		{
+			// Regexes are matched as written, so .* crosses segments
+			sel:   "/disk\\..*/",
+			match: []string{"disk.sda1.used_pct", "disk.data.vol.used_pct"},
+			miss:  []string{"diskio.sda"},
+		},
+	}
+	for _, tt := range tests {
+		sel, err := parseSelector(tt.sel)
+		if err != nil {
+			t.Errorf("parseSelector(%q): %v", tt.sel, err)
+			continue
+		}
+		for _, n := range tt.match {
+			if !sel.match(n) {
+				t.Errorf("%q does not match %q", tt.sel, n)
+			}
+		}
+		for _, n := range tt.miss {
+			if sel.match(n) {
+				t.Errorf("%q matches %q", tt.sel, n)
+			}
+		}
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, sel := range []string{"/cpu.(/", "/[z-a]/", "cpu.[z-a]"} {
+		if _, err := parseSelector(sel); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("parseSelector(%q) = %v, want ErrInvalidQuery", sel, err)
+		}
+	}
+}
+
+func TestResolveNames(t *testing.T) {
+	s := newTestStore(t)
+	var samples []model.MetricSample
+	for _, n := range []string{"cpu.core.0.usage", "cpu.core.1.usage", "cpu.total.usage", "disk.sda1.used_pct", "disk.data.vol.used_pct"} {
+		samples = append(samples, model.MetricSample{Timestamp: 1000, Collector: "test", MetricName: n, Value: 1})
+	}
+	for _, l := range []string{"iface=eth0", "iface=eth1", "iface=eth2"} {
+		samples = append(samples, model.MetricSample{Timestamp: 1000, Collector: "test", MetricName: "net.rx_bytes", Value: 1, Labels: l})
+	}
+	if err := s.InsertSamples(samples); err != nil {
+		t.Fatalf("InsertSamples: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		names     []string
+		maxSeries int
+		want      []string
+		wantErr   error
+	}{
+		{
+			name:  "exact names are returned unchanged",
+			names: []string{"mem.used", "cpu.total.usage"},
+			want:  []string{"mem.used", "cpu.total.usage"},
+		},
+		{
+			name:  "glob",
+			names: []string{"cpu.core.*.usage"},
+			want:  []string{"cpu.core.0.usage", "cpu.core.1.usage"},
+		},
+		{
+			name:  "glob within one segment",
+			names: []string{"disk.*.used_pct"},
+			want:  []string{"disk.sda1.used_pct"},
+		},
+		{
+			name:  "regex and exact name",
+			names: []string{`/cpu\..*/`, "disk.sda1.used_pct"},
+			want:  []string{"cpu.core.0.usage", "cpu.core.1.usage", "cpu.total.usage", "disk.sda1.used_pct"},
+		},
+		{
+			name:  "no match",
+			names: []string{"mem.*"},
+			want:  []string{},
+		},
+		{
+			name:      "within the limit",
+			names:     []string{"cpu.*.*.usage"},
+			maxSeries: 3,
+			want:      []string{"cpu.core.0.usage", "cpu.core.1.usage"},
+		},
+		{
+			// The limit counts series, so one name with three label sets
+			// exceeds a limit of two
+			name:      "series over the limit",
+			names:     []string{"net.*"},
+			maxSeries: 2,
+			wantErr:   ErrTooManySeries,
+		},
+		{
+			name:    "bad regex",
+			names:   []string{"/(/"},
+			wantErr: ErrInvalidQuery,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.SetMaxSeries(tt.maxSeries)
+			got, err := s.resolveNames(context.Background(), tt.names)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveNames: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Samples are stored in two tables: series holds one row per distinct
+// (name, collector, labels) and samples holds (series_id, timestamp, value)
+// in a WITHOUT ROWID table clustered on its primary key. Databases created
+// before this layout keep their rows in metric_samples until the background
+// legacy migration has moved them over.
+
+const (
+	// legacyChunk is the number of metric_samples rows moved per transaction.
+	legacyChunk = 20000
+	// legacyPause lets queued inserts and UI queries through between chunks.
+	legacyPause = 50 * time.Millisecond
+)
+
+// SeriesInfoFunc returns the display unit ("" if unknown) and the type
+// ("gauge" or "counter") of a metric name.
+type SeriesInfoFunc func(name string) (unit, typ string)
+
+type seriesKey struct {
+	name      string
+	collector string
+	labels    string
+}
+
+// SetSeriesInfo sets the function used to fill series.unit and series.type
+// and backfills series created before it was set.
+func (s *Store) SetSeriesInfo(fn SeriesInfoFunc) {
+	s.seriesMu.Lock()
+	s.seriesInfo = fn
+	s.seriesMu.Unlock()
+	if err := s.backfillSeriesInfo(); err != nil {
+		log.Printf("[store] series info backfill: %v", err)
+	}
+}
+
+// seriesID returns the id for a series, creating it inside tx if needed.
+// Caller must hold s.seriesMu; newly created ids are recorded in created and
+// only added to the cache once the transaction has committed.
+func (s *Store) seriesID(tx *sql.Tx, k seriesKey, created map[seriesKey]int64) (int64, error) {
+	if id, ok := s.seriesIDs[k]; ok {
+		return id, nil
+	}
+	if id, ok := created[k]; ok {
+		return id, nil
+	}
+	unit, typ := "", "gauge"
+	if s.seriesInfo != nil {
+		unit, typ = s.seriesInfo(k.name)
+	}
+	var id int64
+	err := tx.QueryRow(`INSERT INTO series (name, collector, labels, unit, type) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name, collector, labels) DO UPDATE SET name = excluded.name
+		RETURNING id`, k.name, k.collector, k.labels, unit, typ).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	created[k] = id
+	return id, nil
+}
+
+// pruneSeries deletes series that no longer have any samples and resets the
+// id cache. Runs after purges so dead series do not linger in the dictionary.
+func (s *Store) pruneSeries() error {
+	s.seriesMu.Lock()
+	defer s.seriesMu.Unlock()
+	_, err := s.db.Exec(`DELETE FROM series WHERE NOT EXISTS (SELECT 1 FROM samples WHERE series_id = series.id)`)
+	s.seriesIDs = make(map[seriesKey]int64)
+	return err
+}
+
+// backfillSeriesInfo fills the unit and type of series created without the
+// info function, e.g. before descriptions for their metric were added.
+func (s *Store) backfillSeriesInfo() error {
+	s.seriesMu.Lock()
+	fn := s.seriesInfo
+	s.seriesMu.Unlock()
+	if fn == nil {
+		return nil
+	}
+	rows, err := s.db.Query("SELECT id, name, unit, type FROM series")
+	if err != nil {
+		return err
+	}
+	type info struct{ unit, typ string }
+	updates := make(map[int64]info)
+	for rows.Next() {
+		var id int64
+		var name, unit, typ string
+		if err := rows.Scan(&id, &name, &unit, &typ); err != nil {
+			rows.Close()
+			return err
+		}
+		u, t := fn(name)
+		if u == "" {
+			u = unit // keep a unit the function no longer knows
+		}
+		if u != unit || t != typ {
+			updates[id] = info{u, t}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, in := range updates {
+		if _, err := s.db.Exec("UPDATE series SET unit = ?, type = ? WHERE id = ?", in.unit, in.typ, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Legacy metric_samples migration ---
+
+// startLegacyMigration checks for a pre-series metric_samples table. An empty
+// one is dropped right away; otherwise its rows are moved in the background
+// while queries read from both layouts.
+func (s *Store) startLegacyMigration() error {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'metric_samples')`).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	var hasRows bool
+	if err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM metric_samples)").Scan(&hasRows); err != nil {
+		return err
+	}
+	if !hasRows {
+		_, err := s.db.Exec("DROP TABLE metric_samples")
+		return err
+	}
+
+	s.legacy.Store(true)
+	s.wg.Add(1)
+	go s.migrateLegacy()
+	return nil
+}
+
+func (s *Store) migrateLegacy() {
+	defer s.wg.Done()
+
+	var total int64
+	s.db.QueryRow("SELECT COUNT(*) FROM metric_samples").Scan(&total)
+	log.Printf("[store] migrating %d samples to the series layout", total)
+	start := time.Now()
+
+	var moved int64
+	for {
+		select {
+		case <-s.stop:
+			log.Printf("[store] legacy migration paused after %d samples; resumes on next start", moved)
+			return
+		default:
+		}
+		n, err := s.migrateLegacyChunk()
+		if err != nil {
+			log.Printf("[store] legacy migration error: %v", err)
+			return
+		}
+		if n == 0 {
+			break
+		}
+		moved += n
+		time.Sleep(legacyPause)
+	}
+
+	// Switch readers over before the table disappears.
+	s.legacy.Store(false)
+	if _, err := s.db.Exec("DROP TABLE metric_samples"); err != nil {
+		log.Printf("[store] drop metric_samples: %v", err)
+		return
+	}
+	before, _ := s.FileSizes()
+	if _, err := s.db.Exec("VACUUM"); err != nil {
+		log.Printf("[store] vacuum after migration: %v", err)
+	}
+	after, _ := s.FileSizes()
+	log.Printf("[store] legacy migration done: %d samples in %v, db %d -> %d bytes",
+		moved, time.Since(start).Round(time.Millisecond), before, after)
+}
+
+// migrateLegacyChunk moves the oldest legacyChunk rows of metric_samples.
+// It returns the number of rows moved; 0 means the table is empty.
+func (s *Store) migrateLegacyChunk() (int64, error) {
+	s.seriesMu.Lock()
+	defer s.seriesMu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var minID sql.NullInt64
+	if err := tx.QueryRow("SELECT MIN(id) FROM metric_samples").Scan(&minID); err != nil {
+		return 0, err
+	}
+	if !minID.Valid {
+		return 0, nil
+	}
+	upper := minID.Int64 + legacyChunk
+
+	// Series are created like those of new samples, with unit and type
+	rows, err := tx.Query(`SELECT DISTINCT metric_name, collector, COALESCE(labels, '') FROM metric_samples WHERE id < ?`, upper)
+	if err != nil {
+		return 0, err
+	}
+	var keys []seriesKey
+	for rows.Next() {
+		var k seriesKey
+		if err := rows.Scan(&k.name, &k.collector, &k.labels); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	created := make(map[seriesKey]int64)
+	for _, k := range keys {
+		if _, err := s.seriesID(tx, k, created); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO samples (series_id, timestamp, value)
+		SELECT se.id, m.timestamp, m.value
+		FROM metric_samples m
+		JOIN series se ON se.name = m.metric_name AND se.collector = m.collector AND se.labels = COALESCE(m.labels, '')
+		WHERE m.id < ?`, upper); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec("DELETE FROM metric_samples WHERE id < ?", upper)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for k, id := range created {
+		s.seriesIDs[k] = id
+	}
+	return n, nil
+}
+
+// --- Size reporting ---
+
+// StorageStats describes how much space the sample data takes.
+type StorageStats struct {
+	Series         int64   `json:"series"`
+	Samples        int64   `json:"samples"`
+	LegacySamples  int64   `json:"legacy_samples,omitempty"` // rows still awaiting migration
+	BytesPerSample float64 `json:"bytes_per_sample"`
+	// LegacyBytesPerSample is the same figure for the old metric_samples
+	// layout while rows remain to be migrated, for comparison.
+	LegacyBytesPerSample float64          `json:"legacy_bytes_per_sample,omitempty"`
+	Tables               map[string]int64 `json:"tables"` // bytes per table/index, from dbstat
+}
+
+// StorageStats reports row counts and per-table sizes. Counting samples scans
+// the primary key, so this is meant for the settings page, not hot paths.
+func (s *Store) StorageStats(ctx context.Context) (*StorageStats, error) {
+	ctx, cancel := s.readCtx(ctx)
+	defer cancel()
+
+	st := &StorageStats{Tables: make(map[string]int64)}
+	if err := s.rdb.QueryRowContext(ctx, "SELECT COUNT(*) FROM series").Scan(&st.Series); err != nil {
+		return nil, err
+	}
+	if err := s.rdb.QueryRowContext(ctx, "SELECT COUNT(*) FROM samples").Scan(&st.Samples); err != nil {
+		return nil, err
+	}
+	if s.legacy.Load() {
+		s.rdb.QueryRowContext(ctx, "SELECT COUNT(*) FROM metric_samples").Scan(&st.LegacySamples)
+	}
+
+	rows, err := s.rdb.QueryContext(ctx, "SELECT name, SUM(pgsize) FROM dbstat GROUP BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			return nil, err
+		}
+		st.Tables[name] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if st.Samples > 0 {
+		bytes := st.Tables["samples"] + st.Tables["series"] + st.Tables["sqlite_autoindex_series_1"]
+		st.BytesPerSample = float64(bytes) / float64(st.Samples)
+	}
+	if st.LegacySamples > 0 {
+		bytes := st.Tables["metric_samples"] + st.Tables["idx_samples_name_ts"] + st.Tables["idx_samples_ts"]
+		st.LegacyBytesPerSample = float64(bytes) / float64(st.LegacySamples)
+	}
+	return st, nil
+}
@@ -1,24 +1,59 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"strings"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/playok/only1mon/internal/model"
 	_ "modernc.org/sqlite"
 )
 
-// Store provides database operations.
+const (
+	// readPoolSize is the number of read-only connections. WAL mode lets them
+	// run concurrently with each other and with the single writer.
+	readPoolSize = 4
+	// DefaultQueryTimeout bounds read queries issued through the read pool.
+	DefaultQueryTimeout = 30 * time.Second
+)
+
+// Store provides database operations. Writes go through a single connection
+// (SQLite allows one writer); history and metadata reads use a separate pool
+// of read-only connections so they do not queue behind inserts.
 type Store struct {
-	db     *sql.DB
-	dbPath string
+	db           *sql.DB // writer
+	rdb          *sql.DB // read-only pool
+	dbPath       string
+	queryTimeout atomic.Int64 // time.Duration; 0 disables
+	maxSeries    atomic.Int64 // series per query; 0 disables
+	maxPoints    atomic.Int64 // points per series per query; 0 disables
+
+	seriesMu   sync.Mutex // guards seriesIDs and seriesInfo; held across sample writes
+	seriesIDs  map[seriesKey]int64
+	seriesInfo SeriesInfoFunc
+	legacy     atomic.Bool // metric_samples still holds rows awaiting migration
+	stop       chan struct{}
+	wg         sync.WaitGroup
+
+	samplesWritten atomic.Uint64
+	inserts        atomic.Uint64
+	insertNanos    atomic.Uint64
+}
+
+// WriteStats holds cumulative sample write counters since the store was opened.
+type WriteStats struct {
+	SamplesWritten uint64 // samples committed to the samples table
+	Inserts        uint64 // committed InsertSamples transactions
+	InsertNanos    uint64 // total time spent in those transactions
 }
 
 // New opens (or creates) the SQLite database and runs migrations.
 func New(dbPath string) (*Store, error) {
-	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
@@ -27,150 +62,176 @@ func New(dbPath string) (*Store, error) {
 		db.Close()
 		return nil, fmt.Errorf("migrations: %w", err)
 	}
-	return &Store{db: db, dbPath: dbPath}, nil
+
+	// Opened after migrations so the file and WAL mode already exist.
+	rdb, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open read pool: %w", err)
+	}
+	rdb.SetMaxOpenConns(readPoolSize)
+	rdb.SetMaxIdleConns(readPoolSize)
+
+	s := &Store{db: db, rdb: rdb, dbPath: dbPath, seriesIDs: make(map[seriesKey]int64), stop: make(chan struct{})}
+	s.queryTimeout.Store(int64(DefaultQueryTimeout))
+	s.maxSeries.Store(DefaultMaxSeries)
+	s.maxPoints.Store(DefaultMaxPoints)
+	if err := s.startLegacyMigration(); err != nil {
+		rdb.Close()
+		db.Close()
+		return nil, fmt.Errorf("legacy migration: %w", err)
+	}
+	return s, nil
+}
+
+// SetQueryTimeout sets the per-query timeout for read-pool queries.
+// d <= 0 disables it, leaving only the caller's context.
+func (s *Store) SetQueryTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	s.queryTimeout.Store(int64(d))
+}
+
+// readCtx derives the context for a read-pool query from the caller's
+// context, applying the per-query timeout.
+func (s *Store) readCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d := time.Duration(s.queryTimeout.Load()); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
 }
 
 // DBPath returns the database file path.
 func (s *Store) DBPath() string { return s.dbPath }
 
+// WriteStats returns the cumulative sample write counters.
+func (s *Store) WriteStats() WriteStats {
+	return WriteStats{
+		SamplesWritten: s.samplesWritten.Load(),
+		Inserts:        s.inserts.Load(),
+		InsertNanos:    s.insertNanos.Load(),
+	}
+}
+
+// FileSizes returns the size in bytes of the database file and its WAL file.
+// A missing WAL file (e.g. right after a checkpoint) reports 0.
+func (s *Store) FileSizes() (db, wal int64) {
+	if fi, err := os.Stat(s.dbPath); err == nil {
+		db = fi.Size()
+	}
+	if fi, err := os.Stat(s.dbPath + "-wal"); err == nil {
+		wal = fi.Size()
+	}
+	return db, wal
+}
+
 // Close closes the database.
 func (s *Store) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+	s.rdb.Close()
 	return s.db.Close()
 }
 
-// InsertSamples batch-inserts metric samples.
+// InsertSamples batch-inserts metric samples, creating series as needed.
+// A sample for an existing (series, timestamp) replaces the stored value.
 func (s *Store) InsertSamples(samples []model.MetricSample) error {
 	if len(samples) == 0 {
 		return nil
 	}
+	start := time.Now()
+	s.seriesMu.Lock()
+	defer s.seriesMu.Unlock()
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare("INSERT INTO metric_samples (timestamp, collector, metric_name, value, labels) VALUES (?, ?, ?, ?, ?)")
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO samples (series_id, timestamp, value) VALUES (?, ?, ?)")
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
+	created := make(map[seriesKey]int64)
 	for _, m := range samples {
-		if _, err := stmt.Exec(m.Timestamp, m.Collector, m.MetricName, m.Value, m.Labels); err != nil {
+		id, err := s.seriesID(tx, seriesKey{m.MetricName, m.Collector, m.Labels}, created)
+		if err != nil {
 			tx.Rollback()
 			return err
 		}
-	}
-	return tx.Commit()
-}
-
-// QueryMetrics retrieves metric samples with optional downsampling.
-// step is in seconds; if step > 0, data is averaged per step.
-func (s *Store) QueryMetrics(name string, from, to int64, step int) ([]model.MetricSample, error) {
-	var rows *sql.Rows
-	var err error
-
-	if step > 0 {
-		rows, err = s.db.Query(`
-			SELECT 0, (timestamp / ? * ?) as ts, collector, metric_name, AVG(value), labels
-			FROM metric_samples
-			WHERE metric_name = ? AND timestamp >= ? AND timestamp <= ?
-			GROUP BY ts, labels
-			ORDER BY ts`,
-			step, step, name, from, to)
-	} else {
-		rows, err = s.db.Query(`
-			SELECT id, timestamp, collector, metric_name, value, labels
-			FROM metric_samples
-			WHERE metric_name = ? AND timestamp >= ? AND timestamp <= ?
-			ORDER BY timestamp`,
-			name, from, to)
-	}
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var result []model.MetricSample
-	for rows.Next() {
-		var m model.MetricSample
-		if err := rows.Scan(&m.ID, &m.Timestamp, &m.Collector, &m.MetricName, &m.Value, &m.Labels); err != nil {
-			return nil, err
+		if _, err := stmt.Exec(id, m.Timestamp, m.Value); err != nil {
+			tx.Rollback()
+			return err
 		}
-		result = append(result, m)
 	}
-	return result, rows.Err()
-}
-
-// QueryMultiMetrics retrieves samples for multiple metric names.
-func (s *Store) QueryMultiMetrics(names []string, from, to int64, step int) ([]model.MetricSample, error) {
-	if len(names) == 0 {
-		return nil, nil
-	}
-	placeholders := make([]string, len(names))
-	args := make([]interface{}, 0, len(names)+2)
-	for i, n := range names {
-		placeholders[i] = "?"
-		args = append(args, n)
-	}
-	args = append(args, from, to)
-
-	var query string
-	if step > 0 {
-		query = fmt.Sprintf(`
-			SELECT 0, (timestamp / %d * %d) as ts, collector, metric_name, AVG(value), labels
-			FROM metric_samples
-			WHERE metric_name IN (%s) AND timestamp >= ? AND timestamp <= ?
-			GROUP BY metric_name, ts, labels
-			ORDER BY ts`, step, step, strings.Join(placeholders, ","))
-	} else {
-		query = fmt.Sprintf(`
-			SELECT id, timestamp, collector, metric_name, value, labels
-			FROM metric_samples
-			WHERE metric_name IN (%s) AND timestamp >= ? AND timestamp <= ?
-			ORDER BY timestamp`, strings.Join(placeholders, ","))
-	}
-
-	rows, err := s.db.Query(query, args...)
-	if err != nil {
-		return nil, err
+	if err := tx.Commit(); err != nil {
+		return err
 	}
-	defer rows.Close()
-
-	var result []model.MetricSample
-	for rows.Next() {
-		var m model.MetricSample
-		if err := rows.Scan(&m.ID, &m.Timestamp, &m.Collector, &m.MetricName, &m.Value, &m.Labels); err != nil {
-			return nil, err
-		}
-		result = append(result, m)
+	for k, id := range created {
+		s.seriesIDs[k] = id
 	}
-	return result, rows.Err()
+	s.samplesWritten.Add(uint64(len(samples)))
+	s.inserts.Add(1)
+	s.insertNanos.Add(uint64(time.Since(start)))
+	return nil
 }
 
 // PurgeOlderThan removes samples older than the given duration.
 func (s *Store) PurgeOlderThan(hours int) (int64, error) {
 	cutoff := time.Now().Unix() - int64(hours*3600)
-	res, err := s.db.Exec("DELETE FROM metric_samples WHERE timestamp < ?", cutoff)
+	// Driving the delete from series lets each range use the primary key.
+	res, err := s.db.Exec("DELETE FROM samples WHERE series_id IN (SELECT id FROM series) AND timestamp < ?", cutoff)
 	if err != nil {
 		return 0, err
 	}
-	return res.RowsAffected()
+	n, _ := res.RowsAffected()
+	if s.legacy.Load() {
+		if res, err := s.db.Exec("DELETE FROM metric_samples WHERE timestamp < ?", cutoff); err == nil {
+			m, _ := res.RowsAffected()
+			n += m
+		}
+	}
+	if n > 0 {
+		if err := s.pruneSeries(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
 }
 
 // PurgeAllMetricSamples deletes all metric sample data and reclaims disk space.
 func (s *Store) PurgeAllMetricSamples() (int64, error) {
-	res, err := s.db.Exec("DELETE FROM metric_samples")
+	res, err := s.db.Exec("DELETE FROM samples")
 	if err != nil {
 		return 0, err
 	}
+	n, _ := res.RowsAffected()
+	if s.legacy.Load() {
+		if res, err := s.db.Exec("DELETE FROM metric_samples"); err == nil {
+			m, _ := res.RowsAffected()
+			n += m
+		}
+	}
+	if err := s.pruneSeries(); err != nil {
+		return n, err
+	}
 	// Reclaim disk space
 	s.db.Exec("VACUUM")
-	return res.RowsAffected()
+	return n, nil
 }
 
 // GetDistinctMetrics returns all distinct (collector, metric_name) pairs.
-func (s *Store) GetDistinctMetrics() ([]model.MetricMeta, error) {
-	rows, err := s.db.Query("SELECT DISTINCT collector, metric_name FROM metric_samples ORDER BY collector, metric_name")
+func (s *Store) GetDistinctMetrics(ctx context.Context) ([]model.MetricMeta, error) {
+	ctx, cancel := s.readCtx(ctx)
+	defer cancel()
+	query := "SELECT DISTINCT collector, name FROM series"
+	if s.legacy.Load() {
+		query += " UNION SELECT DISTINCT collector, metric_name FROM metric_samples"
+	}
+	rows, err := s.rdb.QueryContext(ctx, query+" ORDER BY 1, 2")
 	if err != nil {
 		return nil, err
 	}
@@ -190,16 +251,17 @@ func (s *Store) GetDistinctMetrics() ([]model.MetricMeta, error) {
 
 // GetCollectorState returns the state for a collector.
 func (s *Store) GetCollectorState(id string) (*model.CollectorState, error) {
-	row := s.db.QueryRow("SELECT collector_id, enabled, config_json FROM collector_state WHERE collector_id = ?", id)
+	row := s.db.QueryRow("SELECT collector_id, enabled, enabled_set, config_json FROM collector_state WHERE collector_id = ?", id)
 	var cs model.CollectorState
-	var enabled int
-	if err := row.Scan(&cs.CollectorID, &enabled, &cs.ConfigJSON); err != nil {
+	var enabled, enabledSet int
+	if err := row.Scan(&cs.CollectorID, &enabled, &enabledSet, &cs.ConfigJSON); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
 	cs.Enabled = enabled != 0
+	cs.EnabledSet = enabledSet != 0
 	return &cs, nil
 }
 
@@ -210,15 +272,25 @@ func (s *Store) SetCollectorEnabled(id string, enabled bool) error {
 		enabledInt = 1
 	}
 	_, err := s.db.Exec(`
-		INSERT INTO collector_state (collector_id, enabled) VALUES (?, ?)
-		ON CONFLICT(collector_id) DO UPDATE SET enabled = excluded.enabled`,
+		INSERT INTO collector_state (collector_id, enabled, enabled_set) VALUES (?, ?, 1)
+		ON CONFLICT(collector_id) DO UPDATE SET enabled = excluded.enabled, enabled_set = 1`,
 		id, enabledInt)
 	return err
 }
 
+// SetCollectorConfig stores the JSON configuration of a collector. A row it
+// creates does not count as an enabled state (see CollectorState.EnabledSet).
+func (s *Store) SetCollectorConfig(id, configJSON string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO collector_state (collector_id, config_json, enabled_set) VALUES (?, ?, 0)
+		ON CONFLICT(collector_id) DO UPDATE SET config_json = excluded.config_json`,
+		id, configJSON)
+	return err
+}
+
 // GetAllCollectorStates returns all saved collector states.
 func (s *Store) GetAllCollectorStates() ([]model.CollectorState, error) {
-	rows, err := s.db.Query("SELECT collector_id, enabled, config_json FROM collector_state")
+	rows, err := s.db.Query("SELECT collector_id, enabled, enabled_set, config_json FROM collector_state")
 	if err != nil {
 		return nil, err
 	}
@@ -226,16 +298,23 @@ func (s *Store) GetAllCollectorStates() ([]model.CollectorState, error) {
 	var result []model.CollectorState
 	for rows.Next() {
 		var cs model.CollectorState
-		var enabled int
-		if err := rows.Scan(&cs.CollectorID, &enabled, &cs.ConfigJSON); err != nil {
+		var enabled, enabledSet int
+		if err := rows.Scan(&cs.CollectorID, &enabled, &enabledSet, &cs.ConfigJSON); err != nil {
 			return nil, err
 		}
 		cs.Enabled = enabled != 0
+		cs.EnabledSet = enabledSet != 0
 		result = append(result, cs)
 	}
 	return result, rows.Err()
 }
 
+// DeleteCollectorState removes the saved state of a collector.
+func (s *Store) DeleteCollectorState(id string) error {
+	_, err := s.db.Exec("DELETE FROM collector_state WHERE collector_id = ?", id)
+	return err
+}
+
 // --- Settings ---
 
 // GetSetting returns a setting value.
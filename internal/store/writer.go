@@ -0,0 +1,176 @@
+package store
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+const (
+	// writerBatchSize triggers a commit as soon as this many samples are queued.
+	writerBatchSize = 2000
+	// writerFlushInterval is the longest a sample waits in the queue.
+	writerFlushInterval = time.Second
+	// writerMaxQueued bounds queue memory. When the database cannot keep up,
+	// incoming samples are dropped until the queue drains.
+	writerMaxQueued = 200000
+	// writerInsertAttempts is how often a batch is tried before it is
+	// dropped, so a transient error such as a busy database loses nothing.
+	writerInsertAttempts = 3
+	// writerRetryDelay is the wait before the first retry; it doubles after.
+	writerRetryDelay = 100 * time.Millisecond
+)
+
+// Writer is a write-behind queue between the collectors and the store.
+// Enqueue never blocks on the database, so a slow UI query holding the single
+// SQLite connection does not stall collection. Samples are committed in
+// batches when writerBatchSize is reached or every writerFlushInterval.
+type Writer struct {
+	store *Store
+
+	mu         sync.Mutex
+	queue      []model.MetricSample
+	overflowed bool // samples were dropped since the queue was last flushed
+
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	started atomic.Bool
+	once    sync.Once
+
+	dropped atomic.Uint64 // samples discarded because the queue was full
+	failed  atomic.Uint64 // samples lost to insert errors
+}
+
+// WriterStats describes the state of the write-behind queue.
+type WriterStats struct {
+	Queued  int    `json:"queued"`
+	Dropped uint64 `json:"dropped"`
+	Failed  uint64 `json:"failed"`
+}
+
+// NewWriter creates a writer for s. Call Start to begin flushing.
+func NewWriter(s *Store) *Writer {
+	return &Writer{
+		store: s,
+		kick:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start launches the flush goroutine.
+func (w *Writer) Start() {
+	if w.started.CompareAndSwap(false, true) {
+		go w.loop()
+	}
+}
+
+// Enqueue adds samples to the queue. If the queue is full the samples that
+// do not fit are dropped and counted.
+func (w *Writer) Enqueue(samples []model.MetricSample) {
+	if len(samples) == 0 {
+		return
+	}
+	w.mu.Lock()
+	if room := max(writerMaxQueued-len(w.queue), 0); len(samples) > room {
+		dropped := w.dropped.Add(uint64(len(samples) - room))
+		samples = samples[:room]
+		if !w.overflowed {
+			w.overflowed = true
+			log.Printf("[writer] queue full (%d samples), dropping new samples (%d dropped so far)", writerMaxQueued, dropped)
+		}
+	}
+	w.queue = append(w.queue, samples...)
+	full := len(w.queue) >= writerBatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stats returns the current queue depth and drop counters.
+func (w *Writer) Stats() WriterStats {
+	w.mu.Lock()
+	n := len(w.queue)
+	w.mu.Unlock()
+	return WriterStats{Queued: n, Dropped: w.dropped.Load(), Failed: w.failed.Load()}
+}
+
+// Close stops the flush goroutine after writing out everything still queued.
+// Samples enqueued after Close are not written.
+func (w *Writer) Close() {
+	w.once.Do(func() {
+		close(w.stop)
+		if w.started.Load() {
+			<-w.done
+		} else {
+			w.flush()
+		}
+	})
+}
+
+func (w *Writer) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(writerFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			w.flush()
+			return
+		case <-w.kick:
+			w.flush()
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+// flush commits everything queued, in transactions of at most writerBatchSize.
+func (w *Writer) flush() {
+	w.mu.Lock()
+	batch := w.queue
+	w.queue = nil
+	if w.overflowed {
+		w.overflowed = false
+		log.Printf("[writer] queue drained, accepting samples again (%d dropped so far)", w.dropped.Load())
+	}
+	w.mu.Unlock()
+
+	for len(batch) > 0 {
+		n := len(batch)
+		if n > writerBatchSize {
+			n = writerBatchSize
+		}
+		w.insert(batch[:n])
+		batch = batch[n:]
+	}
+}
+
+// insert commits one batch, retrying with backoff. A batch that keeps
+// failing is dropped and counted.
+func (w *Writer) insert(batch []model.MetricSample) {
+	delay := writerRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := w.store.InsertSamples(batch)
+		if err == nil {
+			return
+		}
+		if attempt == writerInsertAttempts {
+			failed := w.failed.Add(uint64(len(batch)))
+			log.Printf("[writer] dropped %d samples after %d failed inserts (%d dropped so far): %v", len(batch), attempt, failed, err)
+			return
+		}
+		log.Printf("[writer] insert of %d samples failed, retrying in %v: %v", len(batch), delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/playok/only1mon/internal/model"
+)
+
+// writerSamples returns n samples of one series at consecutive timestamps
+// from ts, with value v.
+func writerSamples(n int, ts int64, v float64) []model.MetricSample {
+	out := make([]model.MetricSample, n)
+	for i := range out {
+		out[i] = model.MetricSample{Timestamp: ts + int64(i), Collector: "test", MetricName: "writer.test", Value: v}
+	}
+	return out
+}
+
+// waitWritten waits up to timeout for the store to have written n samples and
+// returns how long that took.
+func waitWritten(t *testing.T, s *Store, n uint64, timeout time.Duration) time.Duration {
+	t.Helper()
+	start := time.Now()
+	for s.WriteStats().SamplesWritten < n {
+		if time.Since(start) > timeout {
+			t.Fatalf("%d of %d samples written after %v", s.WriteStats().SamplesWritten, n, timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return time.Since(start)
+}
+
+func TestWriterBatchSize(t *testing.T) {
+	s := newTestStore(t)
+	w := NewWriter(s)
+	w.Start()
+	defer w.Close()
+
+	// A full batch is committed right away rather than on the next tick
+	w.Enqueue(writerSamples(writerBatchSize-1, 1000, 1))
+	w.Enqueue(writerSamples(1, 5000, 1))
+	if d := waitWritten(t, s, writerBatchSize, writerFlushInterval/2); d >= writerFlushInterval/2 {
+		t.Errorf("full batch written after %v", d)
+	}
+	if got := s.WriteStats().Inserts; got != 1 {
+		t.Errorf("inserts = %d, want 1", got)
+	}
+}
+
+func TestWriterFlushSplitsBatches(t *testing.T) {
+	s := newTestStore(t)
+	w := NewWriter(s)
+	w.Enqueue(writerSamples(2*writerBatchSize+5, 1000, 1))
+	if got := w.Stats().Queued; got != 2*writerBatchSize+5 {
+		t.Fatalf("queued = %d before a flush", got)
+	}
+	w.flush()
+	if st := s.WriteStats(); st.SamplesWritten != 2*writerBatchSize+5 || st.Inserts != 3 {
+		t.Errorf("written %d samples in %d inserts, want %d in 3", st.SamplesWritten, st.Inserts, 2*writerBatchSize+5)
+	}
+	if got := w.Stats(); got != (WriterStats{}) {
+		t.Errorf("stats after flush = %+v", got)
+	}
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	s := newTestStore(t)
+	w := NewWriter(s)
+	w.Start()
+	defer w.Close()
+
+	// Fewer samples than a batch wait for the ticker
+	w.Enqueue(writerSamples(10, 1000, 1))
+	time.Sleep(writerFlushInterval / 4)
+	if got := s.WriteStats().SamplesWritten; got != 0 {
+		t.Fatalf("%d samples written before the flush interval", got)
+	}
+	waitWritten(t, s, 10, 2*writerFlushInterval)
+	if got := w.Stats().Queued; got != 0 {
+		t.Errorf("queued = %d after the flush", got)
+	}
+}
+
+func TestWriterQueueLimit(t *testing.T) {
+	s := newTestStore(t)
+	w := NewWriter(s)
+	full := writerSamples(writerMaxQueued-10, 1000, 1)
+
+	tests := []struct {
+		name        string
+		enqueue     int
+		wantQueued  int
+		wantDropped uint64
+	}{
+		{"below the limit", len(full), writerMaxQueued - 10, 0},
+		{"samples that do not fit are dropped", 25, writerMaxQueued, 15},
+		{"a full queue drops everything", 5, writerMaxQueued, 20},
+		{"empty batch", 0, writerMaxQueued, 20},
+	}
+	for _, tt := range tests {
+		samples := full[:tt.enqueue]
+		w.Enqueue(samples)
+		if got, want := w.Stats(), (WriterStats{Queued: tt.wantQueued, Dropped: tt.wantDropped}); got != want {
+			t.Errorf("%s: stats = %+v, want %+v", tt.name, got, want)
+		}
+	}
+
+	// Draining the queue accepts samples again; the drop count is cumulative
+	w.flush()
+	w.Enqueue(writerSamples(5, 1000, 2))
+	if got, want := w.Stats(), (WriterStats{Queued: 5, Dropped: 20}); got != want {
+		t.Errorf("after draining: stats = %+v, want %+v", got, want)
+	}
+	if got := s.WriteStats().SamplesWritten; got != writerMaxQueued {
+		t.Errorf("written = %d, want %d", got, writerMaxQueued)
+	}
+}
+
+func TestWriterInsertFailure(t *testing.T) {
+	s := newTestStore(t)
+	// Make every insert of a negative value fail
+	if _, err := s.db.Exec(`CREATE TRIGGER reject_negative BEFORE INSERT ON samples
+		WHEN NEW.value < 0 BEGIN SELECT RAISE(ABORT, 'negative value'); END`); err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(s)
+
+	// The first batch is good; the second holds a bad sample and is retried
+	// and then dropped whole, without affecting the first.
+	w.Enqueue(writerSamples(writerBatchSize, 1000, 1))
+	w.Enqueue(writerSamples(4, 5000, 1))
+	w.Enqueue(writerSamples(1, 6000, -1))
+	start := time.Now()
+	w.flush()
+	// Retries wait writerRetryDelay, then twice that
+	if d := time.Since(start); d < 3*writerRetryDelay {
+		t.Errorf("flush took %v, want retries with backoff", d)
+	}
+	if got := s.WriteStats().SamplesWritten; got != writerBatchSize {
+		t.Errorf("written = %d, want %d", got, writerBatchSize)
+	}
+	if got, want := w.Stats(), (WriterStats{Failed: 5}); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	// Later batches are written again
+	w.Enqueue(writerSamples(3, 7000, 1))
+	w.flush()
+	if got := s.WriteStats().SamplesWritten; got != writerBatchSize+3 {
+		t.Errorf("written = %d, want %d", got, writerBatchSize+3)
+	}
+}
+
+func TestWriterClose(t *testing.T) {
+	tests := []struct {
+		name  string
+		start bool
+	}{
+		{"started", true},
+		{"never started", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			w := NewWriter(s)
+			if tt.start {
+				w.Start()
+			}
+			w.Enqueue(writerSamples(500, 1000, 1))
+			w.Close()
+			if got := s.WriteStats().SamplesWritten; got != 500 {
+				t.Errorf("written = %d after Close, want 500", got)
+			}
+
+			// Close is idempotent, and samples enqueued after it stay queued
+			w.Close()
+			w.Enqueue(writerSamples(5, 2000, 1))
+			time.Sleep(10 * time.Millisecond)
+			if got := s.WriteStats().SamplesWritten; got != 500 {
+				t.Errorf("written = %d after a late Enqueue, want 500", got)
+			}
+		})
+	}
+}
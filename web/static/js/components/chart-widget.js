@@ -4,6 +4,9 @@ class ChartWidget {
         this.container = container;
         this.title = options.title || 'Chart';
         this.metricNames = options.metrics || [];
+        // Expression widgets plot the result of /metrics/eval; their series
+        // are only known once the expression has been evaluated.
+        this.expr = options.expr || '';
         this.metricMeta = options.metricMeta || {};
         this.fixedAxis = options.fixedAxis || false;
         this.live = options.live !== undefined ? options.live : true;
@@ -23,7 +26,11 @@ class ChartWidget {
         }
 
         this._initPlot();
-        this._bindWS();
+        if (this.expr) {
+            this._startPolling();
+        } else {
+            this._bindWS();
+        }
         this._observeResize();
     }
 
@@ -273,6 +280,31 @@ class ChartWidget {
         window.wsClient.subscribe(this.metricNames);
     }
 
+    // Expressions are evaluated server-side, so live expression charts
+    // re-evaluate the current window periodically instead of using WebSocket.
+    _startPolling() {
+        this._pollTimer = setInterval(() => {
+            if (!this.live) return;
+            const now = Math.floor(Date.now() / 1000);
+            this.loadHistory(now - (this._window || 3600), now);
+        }, 5000);
+    }
+
+    // Rebuild the plot when an expression yields a different set of series.
+    _setSeries(names) {
+        if (names.length === this.metricNames.length && names.every((n, i) => n === this.metricNames[i])) return;
+        this.metricNames = names;
+        this.seriesMap = {};
+        names.forEach((n, i) => { this.seriesMap[n] = i + 1; });
+        this._unit = this._detectUnit();
+        if (this.tooltip && this.tooltip.parentNode) {
+            this.tooltip.parentNode.removeChild(this.tooltip);
+        }
+        if (this.plot) this.plot.destroy();
+        this.data = [[]].concat(names.map(() => []));
+        this._initPlot();
+    }
+
     _observeResize() {
         this._resizeObs = new ResizeObserver((entries) => {
             for (const entry of entries) {
@@ -302,8 +334,13 @@ class ChartWidget {
             this._resizeObs.disconnect();
             this._resizeObs = null;
         }
-        window.wsClient.off('metrics', this._wsHandler);
-        window.wsClient.unsubscribe(this.metricNames);
+        if (this._pollTimer) {
+            clearInterval(this._pollTimer);
+            this._pollTimer = null;
+        } else {
+            window.wsClient.off('metrics', this._wsHandler);
+            window.wsClient.unsubscribe(this.metricNames);
+        }
         if (this.tooltip && this.tooltip.parentNode) {
             this.tooltip.parentNode.removeChild(this.tooltip);
         }
@@ -324,37 +361,39 @@ class ChartWidget {
             from = now - 3600;
             to = now;
         }
+        this._window = to - from;
         try {
-            const samples = await API.queryMetrics(this.metricNames.join(','), from, to, 0);
-            if (!samples || samples.length === 0) return;
-
-            // Reset data
-            this.data = [[]];
-            for (let i = 0; i < this.metricNames.length; i++) {
-                this.data.push([]);
+            let series;
+            if (this.expr) {
+                series = await API.evalExpr(this.expr, from, to);
+                if (!series) return;
+                this._setSeries([...new Set(series.map(s => s.name))].sort());
+            } else {
+                series = await API.queryMetrics(this.metricNames.join(','), from, to, 0);
             }
+            if (!series || series.length === 0) return;
 
-            // Group by timestamp
+            // Merge the timestamps of all series
             const tsSet = new Set();
-            for (const s of samples) {
-                tsSet.add(s.timestamp);
+            for (const s of series) {
+                for (const t of s.timestamps) tsSet.add(t);
             }
             const timestamps = [...tsSet].sort((a, b) => a - b);
-            this.data[0] = timestamps;
+            const tsIndex = new Map(timestamps.map((t, i) => [t, i]));
 
-            // Initialize series with nulls
-            for (let i = 1; i < this.data.length; i++) {
-                this.data[i] = new Array(timestamps.length).fill(null);
+            // Reset data, one null-filled row per series
+            this.data = [timestamps];
+            for (let i = 0; i < this.metricNames.length; i++) {
+                this.data.push(new Array(timestamps.length).fill(null));
             }
 
             // Fill values
-            for (const s of samples) {
-                const seriesIdx = this.seriesMap[s.metric_name];
+            for (const s of series) {
+                const seriesIdx = this.seriesMap[s.name];
                 if (seriesIdx === undefined) continue;
-                const tsIdx = timestamps.indexOf(s.timestamp);
-                if (tsIdx >= 0) {
-                    this.data[seriesIdx][tsIdx] = s.value;
-                }
+                s.timestamps.forEach((t, i) => {
+                    this.data[seriesIdx][tsIndex.get(t)] = s.values[i];
+                });
             }
 
             this.plot.setData(this.data);
@@ -174,13 +174,19 @@ class IoTopWidget {
             to = now;
         }
         try {
-            const samples = await API.queryMetrics(this.metricNames.join(','), from, to, 0);
-            if (!samples || samples.length === 0) return;
-            for (const s of samples) {
-                if (s.metric_name.endsWith('.name') && s.labels) {
-                    this.procNames[s.metric_name] = s.labels;
+            const series = await API.queryMetrics(this.metricNames.join(','), from, to, 0);
+            if (!series || series.length === 0) return;
+            // A metric can have several series (process names live in labels);
+            // keep the one with the most recent sample.
+            const lastTs = {};
+            for (const s of series) {
+                const n = s.values.length;
+                if (n === 0 || s.timestamps[n - 1] < (lastTs[s.name] || 0)) continue;
+                lastTs[s.name] = s.timestamps[n - 1];
+                if (s.name.endsWith('.name') && s.labels) {
+                    this.procNames[s.name] = s.labels;
                 }
-                this.values[s.metric_name] = s.value;
+                this.values[s.name] = s.values[n - 1];
             }
             this._render();
         } catch (e) {
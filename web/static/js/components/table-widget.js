@@ -147,12 +147,12 @@ class TableWidget {
             to = now;
         }
         try {
-            const samples = await API.queryMetrics(this.metricNames.join(','), from, to, 0);
-            if (!samples || samples.length === 0) return;
+            const series = await API.queryMetrics(this.metricNames.join(','), from, to, 0);
+            if (!series || series.length === 0) return;
             // Take the latest value per metric
-            for (const s of samples) {
-                if (this.rows[s.metric_name] !== undefined) {
-                    this.values[s.metric_name] = s.value;
+            for (const s of series) {
+                if (this.rows[s.name] !== undefined && s.values.length > 0) {
+                    this.values[s.name] = s.values[s.values.length - 1];
                 }
             }
             this._renderValues();
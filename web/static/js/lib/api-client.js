@@ -38,6 +38,9 @@ const API = {
     getCollectors() { return this.get('/collectors'); },
     enableCollector(id) { return this.put(`/collectors/${id}/enable`); },
     disableCollector(id) { return this.put(`/collectors/${id}/disable`); },
+    setCollectorInterval(id, interval) { return this.put(`/collectors/${id}`, { interval }); },
+    getCollectorConfig(id) { return this.get(`/collectors/${id}/config`); },
+    setCollectorConfig(id, config) { return this.put(`/collectors/${id}/config`, config); },
 
     enableMetric(name) { return this.put(`/metrics/state/${name}/enable`); },
     disableMetric(name) { return this.put(`/metrics/state/${name}/disable`); },
@@ -56,12 +59,32 @@ const API = {
 
     // Metrics
     getAvailableMetrics() { return this.get('/metrics/available'); },
-    queryMetrics(name, from, to, step) {
-        const params = new URLSearchParams({ name });
+    // opts: { agg, fn, reduce } — see README "Metrics" API section.
+    // Resolves to [{ name, labels, unit, timestamps, values }], one entry per series.
+    async queryMetrics(name, from, to, step, opts = {}) {
+        const params = new URLSearchParams({ name, format: 'compact' });
         if (from) params.set('from', from);
         if (to) params.set('to', to);
         if (step) params.set('step', step);
-        return this.get('/metrics/query?' + params.toString());
+        for (const k of ['agg', 'fn', 'reduce']) {
+            if (opts[k]) params.set(k, opts[k]);
+        }
+        const series = await this.get('/metrics/query?' + params.toString());
+        // Compact timestamps are delta-encoded; restore absolute values
+        for (const s of series) {
+            for (let i = 1; i < s.timestamps.length; i++) {
+                s.timestamps[i] += s.timestamps[i - 1];
+            }
+        }
+        return series;
+    },
+    // expr: e.g. "mem.used / mem.total * 100" — see README "Expressions"
+    evalExpr(expr, from, to, step) {
+        const params = new URLSearchParams({ expr });
+        if (from) params.set('from', from);
+        if (to) params.set('to', to);
+        if (step) params.set('step', step);
+        return this.get('/metrics/eval?' + params.toString());
     },
 
     // Settings
@@ -43,6 +43,8 @@ const translations = {
         'widget.iotop_title': 'Disk I/O Top',
         'widget.unit_prefix': 'Unit: ',
         'widget.fixed_axis': 'Fix Y-axis range 0\u2013100%',
+        'widget.expr_label': 'Expression (optional, replaces selected metrics)',
+        'widget.expr_placeholder': 'e.g. mem.used / mem.total * 100',
 
         // Metrics page
         'metrics.title': 'Collectors',
@@ -56,6 +58,12 @@ const translations = {
         'impact.medium': 'medium impact',
         'impact.high': 'high impact',
         'metrics.more': 'more',
+        'metrics.interval': 'Interval (s, 0 = default)',
+        'metrics.interval_saved': 'collection interval updated',
+        'metrics.last_run': 'Last run',
+        'metrics.samples': 'samples',
+        'metrics.errors': 'Failing',
+        'metrics.backoff_until': 'paused until',
 
         // Settings page
         'settings.title': 'Settings',
@@ -162,6 +170,8 @@ const translations = {
         'widget.iotop_title': '디스크 I/O Top',
         'widget.unit_prefix': '단위: ',
         'widget.fixed_axis': 'Y축 범위 0~100% 고정',
+        'widget.expr_label': '수식 (선택 사항, 선택한 메트릭 대신 사용)',
+        'widget.expr_placeholder': '예: mem.used / mem.total * 100',
 
         // Metrics page
         'metrics.title': '수집기',
@@ -175,6 +185,12 @@ const translations = {
         'impact.medium': '부하 주의',
         'impact.high': '부하 높음',
         'metrics.more': '더보기',
+        'metrics.interval': '수집 간격 (초, 0 = 기본값)',
+        'metrics.interval_saved': '수집 간격이 변경되었습니다',
+        'metrics.last_run': '최근 실행',
+        'metrics.samples': '샘플',
+        'metrics.errors': '수집 실패',
+        'metrics.backoff_until': '일시 중지:',
 
         // Settings page
         'settings.title': '설정',
@@ -13,10 +13,11 @@ document.addEventListener('alpine:init', () => {
     Alpine.data('dashboardPage', () => ({
         grid: null,
         widgets: {},
-        newWidget: { title: '', metrics: '', fixedAxis: false },
+        newWidget: { title: '', metrics: '', expr: '', fixedAxis: false },
         metricGroups: [],
         selectedMetrics: [],
         editTitle: '',
+        editExpr: '',
         editFixedAxis: false,
 
         // Context menu state
@@ -32,7 +33,7 @@ document.addEventListener('alpine:init', () => {
                     await this.loadAvailableMetrics();
                 } else {
                     this.selectedMetrics = [];
-                    this.newWidget = { title: '', metrics: '' };
+                    this.newWidget = { title: '', metrics: '', expr: '' };
                 }
             });
 
@@ -43,6 +44,7 @@ document.addEventListener('alpine:init', () => {
                 } else {
                     this.selectedMetrics = [];
                     this.editTitle = '';
+                    this.editExpr = '';
                 }
             });
 
@@ -189,8 +191,9 @@ document.addEventListener('alpine:init', () => {
             const chart = this.widgets[id];
             this.store.editWidgetId = id;
             this.editTitle = chart.title;
+            this.editExpr = chart.expr || '';
             this.editFixedAxis = chart.fixedAxis || false;
-            this.selectedMetrics = [...chart.metricNames];
+            this.selectedMetrics = chart.expr ? [] : [...chart.metricNames];
             this.store.showEditWidget = true;
         },
 
@@ -203,11 +206,12 @@ document.addEventListener('alpine:init', () => {
         applyEditWidget() {
             const id = this.store.editWidgetId;
             if (!id) return;
-            const metrics = [...this.selectedMetrics];
-            if (metrics.length === 0) return;
-            const title = this.editTitle || metrics.slice(0, 2).join(', ') + (metrics.length > 2 ? '...' : '');
+            const expr = this.editExpr.trim();
+            const metrics = expr ? [] : [...this.selectedMetrics];
+            if (!expr && metrics.length === 0) return;
+            const title = this.editTitle || expr || metrics.slice(0, 2).join(', ') + (metrics.length > 2 ? '...' : '');
 
-            this._ensureMetricsEnabled(metrics);
+            if (!expr) this._ensureMetricsEnabled(metrics);
 
             // Destroy old chart
             if (this.widgets[id]) {
@@ -229,7 +233,7 @@ document.addEventListener('alpine:init', () => {
                 if (container) {
                     // Clear old chart DOM
                     container.innerHTML = '';
-                    const chart = new ChartWidget(container, { title, metrics, metricMeta: editMetricMeta, fixedAxis: this.editFixedAxis, live: this._currentLive() });
+                    const chart = new ChartWidget(container, { title, metrics, expr, metricMeta: editMetricMeta, fixedAxis: this.editFixedAxis, live: this._currentLive() });
                     chart.loadHistory(this._currentFrom(), this._currentTo());
                     this.widgets[id] = chart;
                 }
@@ -276,13 +280,14 @@ document.addEventListener('alpine:init', () => {
         },
 
         addWidget() {
-            const metrics = this.selectedMetrics.length > 0
+            const expr = (this.newWidget.expr || '').trim();
+            const metrics = expr ? [] : this.selectedMetrics.length > 0
                 ? [...this.selectedMetrics]
                 : this.newWidget.metrics.split(',').map(m => m.trim()).filter(Boolean);
-            if (metrics.length === 0) return;
-            const title = this.newWidget.title || metrics.slice(0, 2).join(', ') + (metrics.length > 2 ? '...' : '');
+            if (!expr && metrics.length === 0) return;
+            const title = this.newWidget.title || expr || metrics.slice(0, 2).join(', ') + (metrics.length > 2 ? '...' : '');
 
-            this._ensureMetricsEnabled(metrics);
+            if (!expr) this._ensureMetricsEnabled(metrics);
 
             const id = 'w-' + Date.now();
 
@@ -301,6 +306,7 @@ document.addEventListener('alpine:init', () => {
                     const chart = new ChartWidget(container, {
                         title: title,
                         metrics: metrics,
+                        expr: expr,
                         metricMeta: metricMeta,
                         fixedAxis: this.newWidget.fixedAxis,
                         live: this._currentLive(),
@@ -312,7 +318,7 @@ document.addEventListener('alpine:init', () => {
 
             this.store.showAddWidget = false;
             this.selectedMetrics = [];
-            this.newWidget = { title: '', metrics: '', fixedAxis: false };
+            this.newWidget = { title: '', metrics: '', expr: '', fixedAxis: false };
         },
 
         addTableWidget(sub) {
@@ -356,7 +362,7 @@ document.addEventListener('alpine:init', () => {
 
             this.store.showAddWidget = false;
             this.selectedMetrics = [];
-            this.newWidget = { title: '', metrics: '' };
+            this.newWidget = { title: '', metrics: '', expr: '' };
         },
 
         addTopWidget() {
@@ -448,6 +454,9 @@ document.addEventListener('alpine:init', () => {
                     type: w.type || 'chart',
                     fixedAxis: w.fixedAxis || false,
                 };
+                if (w.expr) {
+                    widgetMeta[id].expr = w.expr;
+                }
                 if (w.metricMeta && Object.keys(w.metricMeta).length > 0) {
                     widgetMeta[id].metricMeta = w.metricMeta;
                 }
@@ -549,7 +558,8 @@ document.addEventListener('alpine:init', () => {
                                 } else {
                                     widget = new ChartWidget(container, {
                                         title: meta.title,
-                                        metrics: meta.metrics,
+                                        metrics: meta.expr ? [] : meta.metrics,
+                                        expr: meta.expr || '',
                                         metricMeta: metricMeta,
                                         fixedAxis: meta.fixedAxis || false,
                                         live: live,
@@ -49,6 +49,23 @@ document.addEventListener('alpine:init', () => {
             }
         },
 
+        async saveInterval(collector, value) {
+            const t = Alpine.store('i18n').t.bind(Alpine.store('i18n'));
+            const interval = parseInt(value, 10) || 0;
+            try {
+                await API.setCollectorInterval(collector.id, interval);
+                collector.interval = interval;
+                window.dispatchEvent(new CustomEvent('toast', {
+                    detail: { msg: `${collector.name} ${t('metrics.interval_saved')}`, type: 'success' },
+                }));
+            } catch (e) {
+                window.dispatchEvent(new CustomEvent('toast', {
+                    detail: { msg: e.message, type: 'error' },
+                }));
+                await this.fetch();
+            }
+        },
+
         async toggleMetric(collector, ms) {
             const t = Alpine.store('i18n').t.bind(Alpine.store('i18n'));
             try {
@@ -96,6 +113,24 @@ document.addEventListener('alpine:init', () => {
             return collector.metric_states.some(ms => !ms.enabled);
         },
 
+        runText(collector) {
+            const t = Alpine.store('i18n').t.bind(Alpine.store('i18n'));
+            const h = collector.health;
+            if (!h) return '';
+            return `${t('metrics.last_run')}: ${h.last_duration_ms.toFixed(1)} ms, ${h.last_sample_count} ${t('metrics.samples')}`;
+        },
+
+        errorText(collector) {
+            const t = Alpine.store('i18n').t.bind(Alpine.store('i18n'));
+            const h = collector.health;
+            if (!h || !h.consecutive_errors) return '';
+            let msg = `${t('metrics.errors')} (${h.consecutive_errors}): ${h.last_error}`;
+            if (h.backoff_until) {
+                msg += ` — ${t('metrics.backoff_until')} ${new Date(h.backoff_until * 1000).toLocaleTimeString()}`;
+            }
+            return msg;
+        },
+
         enabledMetricCount(collector) {
             if (!collector.metric_states) return 0;
             return collector.metric_states.filter(ms => ms.enabled).length;